@@ -33,11 +33,20 @@ type PublishedStorage interface {
 	// CreateFile creates file for writing under public path
 	CreateFile(path string) (*os.File, error)
 	// RemoveDirs removes directory structure under public path
-	RemoveDirs(path string) error
+	RemoveDirs(path string, progress Progress) error
+	// Remove removes single file under public path
+	Remove(path string) error
 	// LinkFromPool links package file from pool to dist's pool location
-	LinkFromPool(prefix string, component string, poolDirectory string, sourcePool PackagePool, sourcePath string) (string, error)
+	LinkFromPool(prefix string, component string, poolDirectory string, sourcePool PackagePool, sourcePath string,
+		sourceChecksums utils.ChecksumInfo) (string, error)
 	// ChecksumsForFile proxies requests to utils.ChecksumsForFile, joining public path
 	ChecksumsForFile(path string) (utils.ChecksumInfo, error)
+	// Filelist returns list of files under prefix
+	Filelist(prefix string) ([]string, error)
+	// RenameFile renames (moves) file
+	RenameFile(oldName, newName string) error
+	// HardLink creates hardlink newName pointing to oldName, replacing newName if it exists
+	HardLink(oldName, newName string) error
 }
 
 // Progress is a progress displaying entity, it allows progress bars & simple prints
@@ -52,6 +61,8 @@ type Progress interface {
 	Flush()
 	// InitBar starts progressbar for count bytes or count items
 	InitBar(count int64, isBytes bool)
+	// InitBarWithPrefix starts progressbar with text displayed in front of it
+	InitBarWithPrefix(count int64, isBytes bool, prefix string)
 	// ShutdownBar stops progress bar and hides it
 	ShutdownBar()
 	// AddBar increments progress for progress bar
@@ -79,4 +90,6 @@ type Downloader interface {
 	Shutdown()
 	// GetProgress returns Progress object
 	GetProgress() Progress
+	// BarPrefix returns text to display in front of download progress bars
+	BarPrefix() string
 }
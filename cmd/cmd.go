@@ -8,6 +8,7 @@ import (
 	"github.com/smira/aptly/aptly"
 	"github.com/smira/aptly/debian"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -36,6 +37,24 @@ func ListPackagesRefList(reflist *debian.PackageRefList) (err error) {
 	return
 }
 
+// stringsFlag collects values of flag which could be specified multiple times
+type stringsFlag struct {
+	values []string
+}
+
+func (s *stringsFlag) Set(value string) error {
+	s.values = append(s.values, value)
+	return nil
+}
+
+func (s *stringsFlag) Get() interface{} {
+	return s.values
+}
+
+func (s *stringsFlag) String() string {
+	return strings.Join(s.values, ",")
+}
+
 // RootCommand creates root command in command tree
 func RootCommand() *commander.Command {
 	cmd := &commander.Command{
@@ -57,7 +76,9 @@ package environment to new version.`,
 		Subcommands: []*commander.Command{
 			makeCmdDb(),
 			makeCmdGraph(),
+			makeCmdKeyring(),
 			makeCmdMirror(),
+			makeCmdPackage(),
 			makeCmdRepo(),
 			makeCmdServe(),
 			makeCmdSnapshot(),
@@ -9,7 +9,9 @@ import (
 	"github.com/smira/aptly/debian"
 	"github.com/smira/aptly/files"
 	"github.com/smira/aptly/http"
+	"github.com/smira/aptly/s3"
 	"github.com/smira/aptly/utils"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -24,7 +26,7 @@ var context struct {
 	downloader        aptly.Downloader
 	database          database.Storage
 	packagePool       aptly.PackagePool
-	publishedStorage  aptly.PublishedStorage
+	publishedStorages map[string]aptly.PublishedStorage
 	collectionFactory *debian.CollectionFactory
 	dependencyOptions int
 	architecturesList []string
@@ -61,8 +63,6 @@ func InitContext(cmd *commander.Command) error {
 	context.progress = console.NewProgress()
 	context.progress.Start()
 
-	context.downloader = http.NewDownloader(utils.Config.DownloadConcurrency, context.progress)
-
 	context.database, err = database.OpenDB(filepath.Join(utils.Config.RootDir, "db"))
 	if err != nil {
 		return fmt.Errorf("can't open database: %s", err)
@@ -71,7 +71,7 @@ func InitContext(cmd *commander.Command) error {
 	context.collectionFactory = debian.NewCollectionFactory(context.database)
 
 	context.packagePool = files.NewPackagePool(utils.Config.RootDir)
-	context.publishedStorage = files.NewPublishedStorage(utils.Config.RootDir)
+	context.publishedStorages = map[string]aptly.PublishedStorage{}
 
 	if aptly.EnableDebug {
 		cpuprofile := cmd.Flag.Lookup("cpuprofile").Value.String()
@@ -124,6 +124,76 @@ func InitContext(cmd *commander.Command) error {
 	return nil
 }
 
+// getDownloader creates downloader for the mirror: global download settings
+// are combined with mirror-specific transport settings
+func getDownloader(repo *debian.RemoteRepo) (aptly.Downloader, error) {
+	globalTransport := http.TransportOptions{
+		Proxy:      utils.Config.DownloadProxy,
+		CABundle:   utils.Config.DownloadCABundle,
+		ClientCert: utils.Config.DownloadClientCert,
+		ClientKey:  utils.Config.DownloadClientKey,
+		Netrc:      utils.Config.DownloadNetrc,
+	}
+
+	concurrency := utils.Config.DownloadConcurrency
+	if repo.DownloadConcurrency > 0 {
+		concurrency = repo.DownloadConcurrency
+	}
+
+	// mirror could be limited further, but not above global limit
+	speedLimit := utils.Config.DownloadSpeedLimit
+	if repo.DownloadSpeedLimit > 0 && (speedLimit == 0 || repo.DownloadSpeedLimit < speedLimit) {
+		speedLimit = repo.DownloadSpeedLimit
+	}
+
+	downloader, err := http.NewDownloaderWithOptions(concurrency, context.progress, http.DownloaderOptions{
+		Retries:        utils.Config.DownloadRetries,
+		RetryDelay:     time.Second,
+		ConnectTimeout: time.Duration(utils.Config.DownloadConnectTimeout) * time.Second,
+		ReadTimeout:    time.Duration(utils.Config.DownloadReadTimeout) * time.Second,
+		LinkLocal:      repo.LinkLocal,
+		SpeedLimit:     speedLimit,
+		Transport:      repo.TransportOptions().Merge(globalTransport),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// downloader is shut down in ShutdownContext
+	context.downloader = downloader
+	return downloader, nil
+}
+
+// getPublishedStorage returns published storage by name: empty name is
+// local filesystem storage, "s3:<endpoint>" is S3 endpoint from configuration
+func getPublishedStorage(name string) (aptly.PublishedStorage, error) {
+	publishedStorage, ok := context.publishedStorages[name]
+	if ok {
+		return publishedStorage, nil
+	}
+
+	if name == "" {
+		publishedStorage = files.NewPublishedStorage(utils.Config.RootDir)
+	} else if strings.HasPrefix(name, "s3:") {
+		params, ok := utils.Config.S3PublishEndpoints[name[3:]]
+		if !ok {
+			return nil, fmt.Errorf("published S3 storage %s not configured", name[3:])
+		}
+
+		var err error
+		publishedStorage, err = s3.NewPublishedStorage(params.Endpoint, params.Region, params.AccessKeyID,
+			params.SecretAccessKey, params.Bucket, params.Prefix, !params.DisableSSL)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("unknown published storage format: %s", name)
+	}
+
+	context.publishedStorages[name] = publishedStorage
+	return publishedStorage, nil
+}
+
 // ShutdownContext shuts context down
 func ShutdownContext() {
 	if aptly.EnableDebug {
@@ -145,6 +215,11 @@ func ShutdownContext() {
 	if context.database != nil {
 		context.database.Close()
 	}
+	for _, publishedStorage := range context.publishedStorages {
+		if closer, ok := publishedStorage.(io.Closer); ok {
+			closer.Close()
+		}
+	}
 	if context.downloader != nil {
 		context.downloader.Shutdown()
 	}
@@ -18,6 +18,11 @@ func graphvizEscape(s string) string {
 	return fmt.Sprintf("\"%s\"", strings.Replace(s, "\"", "\\\"", 0))
 }
 
+// graphvizRecordEscape escapes characters which have special meaning in record labels
+func graphvizRecordEscape(s string) string {
+	return strings.NewReplacer("{", "\\{", "}", "\\}", "|", "\\|", "<", "\\<", ">", "\\>").Replace(s)
+}
+
 func aptlyGraph(cmd *commander.Command, args []string) error {
 	var err error
 
@@ -93,7 +98,7 @@ func aptlyGraph(cmd *commander.Command, args []string) error {
 			return err
 		}
 
-		description := snapshot.Description
+		description := graphvizRecordEscape(snapshot.Description)
 		if snapshot.SourceKind == "repo" {
 			description = "Snapshot from repo"
 		}
@@ -129,12 +134,14 @@ func aptlyGraph(cmd *commander.Command, args []string) error {
 			"shape":     "Mrecord",
 			"style":     "filled",
 			"fillcolor": "darkolivegreen1",
-			"label":     graphvizEscape(fmt.Sprintf("{Published %s/%s|comp: %s|arch: %s}", repo.Prefix, repo.Distribution, repo.Component, strings.Join(repo.Architectures, ", "))),
+			"label":     graphvizEscape(fmt.Sprintf("{Published %s/%s|comp: %s|arch: %s}", repo.StoragePrefix(), repo.Distribution, strings.Join(repo.Components(), " "), strings.Join(repo.Architectures, ", "))),
 		})
 
-		_, exists := existingNodes[repo.SourceUUID]
-		if exists {
-			graph.AddEdge(graphvizEscape(repo.SourceUUID), "", graphvizEscape(repo.UUID), "", true, nil)
+		for _, uuid := range repo.Sources {
+			_, exists := existingNodes[uuid]
+			if exists {
+				graph.AddEdge(graphvizEscape(uuid), "", graphvizEscape(repo.UUID), "", true, nil)
+			}
 		}
 
 		return nil
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+	"github.com/smira/aptly/utils"
+	"path/filepath"
+)
+
+// getKeyring loads aptly keyring with trusted keys
+func getKeyring() (*utils.Keyring, error) {
+	return utils.NewKeyring(filepath.Join(utils.Config.RootDir, "keyring", "trustedkeys.gpg"))
+}
+
+func makeCmdKeyring() *commander.Command {
+	return &commander.Command{
+		UsageLine: "keyring",
+		Short:     "manage trusted keys for mirror verification",
+		Subcommands: []*commander.Command{
+			makeCmdKeyringImport(),
+			makeCmdKeyringList(),
+			makeCmdKeyringRemove(),
+		},
+		Flag: *flag.NewFlagSet("aptly-keyring", flag.ExitOnError),
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+	"github.com/smira/aptly/utils"
+	"os"
+)
+
+func aptlyKeyringImport(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) < 1 {
+		cmd.Usage()
+		return err
+	}
+
+	keyring, err := getKeyring()
+	if err != nil {
+		return fmt.Errorf("unable to import: %s", err)
+	}
+
+	for _, filename := range args {
+		f, err := os.Open(filename)
+		if err != nil {
+			return fmt.Errorf("unable to import: %s", err)
+		}
+
+		imported, err := keyring.Import(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("unable to import %s: %s", filename, err)
+		}
+
+		for _, entity := range imported {
+			fmt.Printf("Imported key %s: %s\n", utils.KeyFingerprint(entity), utils.KeyDescription(entity))
+		}
+	}
+
+	err = keyring.Save()
+	if err != nil {
+		return fmt.Errorf("unable to save keyring: %s", err)
+	}
+
+	return err
+}
+
+func makeCmdKeyringImport() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyKeyringImport,
+		UsageLine: "import <file> [<file> ...]",
+		Short:     "import keys into aptly keyring",
+		Long: `
+Command import adds public keys from files (armored or binary) to aptly
+keyring stored under rootDir/keyring. Keys from aptly keyring could be bound
+to mirrors with -trusted-key flag of 'aptly mirror create'.
+
+Example:
+
+  $ aptly keyring import /usr/share/keyrings/debian-archive-keyring.gpg
+`,
+		Flag: *flag.NewFlagSet("aptly-keyring-import", flag.ExitOnError),
+	}
+
+	return cmd
+}
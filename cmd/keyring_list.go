@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+	"github.com/smira/aptly/utils"
+)
+
+func aptlyKeyringList(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 0 {
+		cmd.Usage()
+		return err
+	}
+
+	keyring, err := getKeyring()
+	if err != nil {
+		return fmt.Errorf("unable to list: %s", err)
+	}
+
+	if len(keyring.Keys()) > 0 {
+		fmt.Printf("List of trusted keys:\n")
+		for _, entity := range keyring.Keys() {
+			fmt.Printf(" * %s: %s\n", utils.KeyFingerprint(entity), utils.KeyDescription(entity))
+		}
+	} else {
+		fmt.Printf("No keys found, import some with `aptly keyring import ...`.\n")
+	}
+
+	return err
+}
+
+func makeCmdKeyringList() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyKeyringList,
+		UsageLine: "list",
+		Short:     "list keys in aptly keyring",
+		Long: `
+List shows fingerprints and user IDs of keys in aptly keyring.
+
+Example:
+
+  $ aptly keyring list
+`,
+		Flag: *flag.NewFlagSet("aptly-keyring-list", flag.ExitOnError),
+	}
+
+	return cmd
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+	"github.com/smira/aptly/debian"
+	"github.com/smira/aptly/utils"
+)
+
+func aptlyKeyringRemove(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) < 1 {
+		cmd.Usage()
+		return err
+	}
+
+	keyring, err := getKeyring()
+	if err != nil {
+		return fmt.Errorf("unable to remove: %s", err)
+	}
+
+	force := cmd.Flag.Lookup("force").Value.Get().(bool)
+	repoCollection := debian.NewRemoteRepoCollection(context.database)
+
+	for _, keyRef := range args {
+		entity, err := keyring.Find(keyRef)
+		if err != nil {
+			return fmt.Errorf("unable to remove: %s", err)
+		}
+
+		fingerprint := utils.KeyFingerprint(entity)
+
+		if !force {
+			err = repoCollection.ForEach(func(repo *debian.RemoteRepo) error {
+				if utils.StrSliceHasItem(repo.TrustedKeys, fingerprint) {
+					return fmt.Errorf("key %s is trusted by mirror %s, use -force to remove anyway", fingerprint, repo.Name)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("unable to remove: %s", err)
+			}
+		}
+
+		_, err = keyring.Remove(fingerprint)
+		if err != nil {
+			return fmt.Errorf("unable to remove: %s", err)
+		}
+
+		fmt.Printf("Removed key %s: %s\n", fingerprint, utils.KeyDescription(entity))
+	}
+
+	err = keyring.Save()
+	if err != nil {
+		return fmt.Errorf("unable to save keyring: %s", err)
+	}
+
+	return err
+}
+
+func makeCmdKeyringRemove() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyKeyringRemove,
+		UsageLine: "remove <key> [<key> ...]",
+		Short:     "remove keys from aptly keyring",
+		Long: `
+Command remove deletes keys from aptly keyring. Key could be specified by
+fingerprint, key ID or part of user ID. Keys which are trusted by some mirrors
+can't be removed unless -force flag is given.
+
+Example:
+
+  $ aptly keyring remove 9D6D8F6BC857C906
+`,
+		Flag: *flag.NewFlagSet("aptly-keyring-remove", flag.ExitOnError),
+	}
+
+	cmd.Flag.Bool("force", false, "remove key even if it's trusted by some mirrors")
+
+	return cmd
+}
@@ -1,28 +1,120 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/gonuts/commander"
 	"github.com/gonuts/flag"
+	"github.com/smira/aptly/debian"
 	"github.com/smira/aptly/utils"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
-func getVerifier(cmd *commander.Command) (utils.Verifier, error) {
-	if utils.Config.GpgDisableVerify || cmd.Flag.Lookup("ignore-signatures").Value.Get().(bool) {
-		return nil, nil
+// newVerifier creates verifier according to configured gpg provider
+func newVerifier() (utils.Verifier, error) {
+	switch utils.Config.GpgProvider {
+	case "", "gpg":
+		return &utils.GpgVerifier{}, nil
+	case "internal":
+		return &utils.GoVerifier{}, nil
 	}
 
-	verifier := &utils.GpgVerifier{}
-	for _, keyRing := range keyRings.keyRings {
-		verifier.AddKeyring(keyRing)
+	return nil, fmt.Errorf("unknown gpg provider: %s", utils.Config.GpgProvider)
+}
+
+// getVerifier creates verifier for the mirror: if trustedKeys are specified,
+// only those keys from aptly keyring are accepted, otherwise keyrings from
+// flags (or default one) are used
+//
+// cleanup should be called when verifier is no longer needed
+func getVerifier(cmd *commander.Command, trustedKeys []string) (verifier utils.Verifier, cleanup func(), err error) {
+	cleanup = func() {}
+
+	if utils.Config.GpgDisableVerify || cmd.Flag.Lookup("ignore-signatures").Value.Get().(bool) {
+		return
 	}
 
-	err := verifier.InitKeyring()
+	verifier, err = newVerifier()
 	if err != nil {
-		return nil, err
+		return
+	}
+
+	if len(trustedKeys) > 0 {
+		var (
+			keyring        *utils.Keyring
+			trustedKeyring string
+		)
+
+		keyring, err = getKeyring()
+		if err != nil {
+			return
+		}
+
+		trustedKeyring, err = keyring.ExportTemp(trustedKeys)
+		if err != nil {
+			return
+		}
+		cleanup = func() { os.Remove(trustedKeyring) }
+
+		verifier.AddKeyring(trustedKeyring)
+	} else {
+		for _, keyRing := range keyRings.keyRings {
+			verifier.AddKeyring(keyRing)
+		}
+	}
+
+	err = verifier.InitKeyring()
+	return
+}
+
+// getIndexDir returns directory where raw index files of mirrors are kept
+// between updates
+func getIndexDir() string {
+	return filepath.Join(utils.Config.RootDir, "indexes")
+}
+
+// addTransportFlags adds flags to configure HTTP transport of the mirror
+func addTransportFlags(cmd *commander.Command) {
+	cmd.Flag.String("proxy", "", "HTTP proxy URL to use when downloading from the mirror")
+	cmd.Flag.String("ca-bundle", "", "PEM file with CA certificates to verify mirror's TLS certificate")
+	cmd.Flag.String("client-cert", "", "PEM file with TLS client certificate")
+	cmd.Flag.String("client-key", "", "PEM file with TLS client key")
+	cmd.Flag.String("netrc", "", "netrc-style file with credentials for the mirror")
+}
+
+// setTransportOptions stores transport settings from flags in the mirror,
+// settings which weren't specified are left untouched
+func setTransportOptions(cmd *commander.Command, repo *debian.RemoteRepo) error {
+	if proxy := cmd.Flag.Lookup("proxy").Value.String(); proxy != "" {
+		repo.Proxy = proxy
 	}
 
-	return verifier, nil
+	paths := []struct {
+		flag  string
+		value *string
+	}{
+		{"ca-bundle", &repo.CABundle},
+		{"client-cert", &repo.ClientCert},
+		{"client-key", &repo.ClientKey},
+		{"netrc", &repo.Netrc},
+	}
+
+	for _, path := range paths {
+		value := cmd.Flag.Lookup(path.flag).Value.String()
+		if value == "" {
+			continue
+		}
+
+		// paths are stored, so they should not depend on current directory
+		absolute, err := filepath.Abs(value)
+		if err != nil {
+			return err
+		}
+		*path.value = absolute
+	}
+
+	return nil
 }
 
 type keyRingsFlag struct {
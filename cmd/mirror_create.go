@@ -7,6 +7,7 @@ import (
 	"github.com/smira/aptly/debian"
 	"github.com/smira/aptly/utils"
 	"strings"
+	"time"
 )
 
 func aptlyMirrorCreate(cmd *commander.Command, args []string) error {
@@ -17,6 +18,7 @@ func aptlyMirrorCreate(cmd *commander.Command, args []string) error {
 	}
 
 	downloadSources := utils.Config.DownloadSourcePackages || cmd.Flag.Lookup("with-sources").Value.Get().(bool)
+	downloadUdebs := cmd.Flag.Lookup("with-udebs").Value.Get().(bool)
 
 	var (
 		mirrorName, archiveURL, distribution string
@@ -33,21 +35,70 @@ func aptlyMirrorCreate(cmd *commander.Command, args []string) error {
 		archiveURL, distribution, components = args[1], args[2], args[3:]
 	}
 
-	repo, err := debian.NewRemoteRepo(mirrorName, archiveURL, distribution, components, context.architecturesList, downloadSources)
+	repo, err := debian.NewRemoteRepo(mirrorName, archiveURL, distribution, components, context.architecturesList, downloadSources, downloadUdebs)
 	if err != nil {
 		return fmt.Errorf("unable to create mirror: %s", err)
 	}
 
-	verifier, err := getVerifier(cmd)
+	trustedKeys := cmd.Flag.Lookup("trusted-key").Value.Get().([]string)
+	if len(trustedKeys) > 0 {
+		keyring, err := getKeyring()
+		if err != nil {
+			return fmt.Errorf("unable to create mirror: %s", err)
+		}
+
+		for _, keyRef := range trustedKeys {
+			entity, err := keyring.Find(keyRef)
+			if err != nil {
+				return fmt.Errorf("unable to create mirror: %s", err)
+			}
+			repo.TrustedKeys = append(repo.TrustedKeys, utils.KeyFingerprint(entity))
+		}
+	}
+
+	err = setTransportOptions(cmd, repo)
+	if err != nil {
+		return fmt.Errorf("unable to create mirror: %s", err)
+	}
+
+	repo.LinkLocal = cmd.Flag.Lookup("hardlink").Value.Get().(bool)
+	if repo.LinkLocal && !repo.IsLocal() {
+		return fmt.Errorf("unable to create mirror: -hardlink is supported only for local archives")
+	}
+
+	repo.Filter = cmd.Flag.Lookup("filter").Value.String()
+	repo.FilterWithDeps = cmd.Flag.Lookup("filter-with-deps").Value.Get().(bool)
+	if repo.FilterWithDeps && repo.Filter == "" {
+		return fmt.Errorf("unable to create mirror: -filter-with-deps requires -filter")
+	}
+	if repo.Filter != "" {
+		_, err = debian.ParseQuery(repo.Filter)
+		if err != nil {
+			return fmt.Errorf("unable to create mirror: %s", err)
+		}
+	}
+
+	verifier, cleanup, err := getVerifier(cmd, repo.TrustedKeys)
+	defer cleanup()
 	if err != nil {
 		return fmt.Errorf("unable to initialize GPG verifier: %s", err)
 	}
 
-	err = repo.Fetch(context.downloader, verifier)
+	downloader, err := getDownloader(repo)
+	if err != nil {
+		return fmt.Errorf("unable to initialize downloader: %s", err)
+	}
+
+	err = repo.Fetch(downloader, verifier)
 	if err != nil {
 		return fmt.Errorf("unable to fetch mirror: %s", err)
 	}
 
+	err = repo.CheckFreshness(time.Now(), false, cmd.Flag.Lookup("allow-expired").Value.Get().(bool))
+	if err != nil {
+		return fmt.Errorf("unable to fetch mirror: %s (use -allow-expired to override)", err)
+	}
+
 	repoCollection := debian.NewRemoteRepoCollection(context.database)
 
 	err = repoCollection.Add(repo)
@@ -68,6 +119,22 @@ func makeCmdMirrorCreate() *commander.Command {
 Creates mirror <name> of remote repository, aptly supports both regular and flat Debian repositories exported
 via HTTP. aptly would try download Release file from remote repository and verify its signature.
 
+Archive could be also located on local filesystem: <archive url> could be file:// URL or path to directory,
+either absolute or starting with ./ (URL without scheme is rejected, so typos are not taken for paths).
+Package files from local archive are copied into package pool, or hardlinked if -hardlink flag is given.
+
+Mirror could be bound to keys from aptly keyring (see 'aptly keyring') with -trusted-key flag,
+in that case Release file should be signed by one of these keys on every update.
+
+HTTP proxy, CA bundle, TLS client certificate and netrc file with credentials could be
+set for the mirror with flags, otherwise settings from configuration file are used. Settings
+are saved with the mirror and used on every update.
+
+Only packages matching package query given with -filter are downloaded on update, e.g.
+'nginx (>= 1.4) | Priority (required)'. With -filter-with-deps dependencies of matching packages
+are downloaded as well, following dependency options (e.g. -dep-follow-recommends)
+given to 'aptly mirror update'.
+
 PPA urls could specified in short format:
 
   $ aptly mirror create <name> ppa:<user>/<project>
@@ -75,13 +142,22 @@ PPA urls could specified in short format:
 Example:
 
   $ aptly mirror create wheezy-main http://mirror.yandex.ru/debian/ wheezy main
+  $ aptly mirror create -hardlink vendor-dvd /media/cdrom/ stable main
+  $ aptly mirror create -filter='nginx | nginx-common' -filter-with-deps wheezy-nginx http://mirror.yandex.ru/debian/ wheezy main
 `,
 		Flag: *flag.NewFlagSet("aptly-mirror-create", flag.ExitOnError),
 	}
 
+	cmd.Flag.Bool("allow-expired", false, "accept Release file with Valid-Until in the past")
 	cmd.Flag.Bool("ignore-signatures", false, "disable verification of Release file signatures")
 	cmd.Flag.Bool("with-sources", false, "download source packages in addition to binary packages")
+	cmd.Flag.Bool("with-udebs", false, "download .udeb packages (Debian installer support)")
 	cmd.Flag.Var(&keyRings, "keyring", "gpg keyring to use when verifying Release file (could be specified multiple times)")
+	cmd.Flag.String("filter", "", "download only packages matching query")
+	cmd.Flag.Bool("filter-with-deps", false, "when filtering, include dependencies of matching packages as well")
+	cmd.Flag.Bool("hardlink", false, "hardlink package files from local archive into package pool instead of copying")
+	addTransportFlags(cmd)
+	cmd.Flag.Var(&stringsFlag{}, "trusted-key", "fingerprint of key from aptly keyring trusted to sign Release file (could be specified multiple times)")
 
 	return cmd
 }
@@ -42,6 +42,11 @@ func aptlyMirrorDrop(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to drop: %s", err)
 	}
 
+	err = repo.DropIndexCache(getIndexDir())
+	if err != nil {
+		return fmt.Errorf("unable to drop: %s", err)
+	}
+
 	fmt.Printf("Mirror `%s` has been removed.\n", repo.Name)
 
 	return err
@@ -5,6 +5,7 @@ import (
 	"github.com/gonuts/commander"
 	"github.com/gonuts/flag"
 	"github.com/smira/aptly/debian"
+	"github.com/smira/aptly/http"
 	"github.com/smira/aptly/utils"
 	"strings"
 )
@@ -30,7 +31,7 @@ func aptlyMirrorShow(cmd *commander.Command, args []string) error {
 	}
 
 	fmt.Printf("Name: %s\n", repo.Name)
-	fmt.Printf("Archive Root URL: %s\n", repo.ArchiveRoot)
+	fmt.Printf("Archive Root URL: %s\n", http.SanitizeURL(repo.ArchiveRoot))
 	fmt.Printf("Distribution: %s\n", repo.Distribution)
 	fmt.Printf("Components: %s\n", strings.Join(repo.Components, ", "))
 	fmt.Printf("Architectures: %s\n", strings.Join(repo.Architectures, ", "))
@@ -39,6 +40,43 @@ func aptlyMirrorShow(cmd *commander.Command, args []string) error {
 		downloadSources = "yes"
 	}
 	fmt.Printf("Download Sources: %s\n", downloadSources)
+	downloadUdebs := "no"
+	if repo.DownloadUdebs {
+		downloadUdebs = "yes"
+	}
+	fmt.Printf("Download .udebs: %s\n", downloadUdebs)
+	if len(repo.TrustedKeys) > 0 {
+		fmt.Printf("Trusted keys: %s\n", strings.Join(repo.TrustedKeys, ", "))
+	}
+	if repo.Filter != "" {
+		fmt.Printf("Filter: %s\n", repo.Filter)
+		filterWithDeps := "no"
+		if repo.FilterWithDeps {
+			filterWithDeps = "yes"
+		}
+		fmt.Printf("Filter With Deps: %s\n", filterWithDeps)
+	}
+	if repo.LinkLocal {
+		fmt.Printf("Hardlink package files: yes\n")
+	}
+	if repo.Proxy != "" {
+		fmt.Printf("Proxy: %s\n", http.SanitizeURL(repo.Proxy))
+	}
+	if repo.CABundle != "" {
+		fmt.Printf("CA bundle: %s\n", repo.CABundle)
+	}
+	if repo.ClientCert != "" {
+		fmt.Printf("Client certificate: %s (key %s)\n", repo.ClientCert, repo.ClientKey)
+	}
+	if repo.Netrc != "" {
+		fmt.Printf("Credentials from: %s\n", repo.Netrc)
+	}
+	if repo.DownloadConcurrency > 0 {
+		fmt.Printf("Download concurrency: %d\n", repo.DownloadConcurrency)
+	}
+	if repo.DownloadSpeedLimit > 0 {
+		fmt.Printf("Download speed limit: %s/s\n", utils.HumanBytes(repo.DownloadSpeedLimit))
+	}
 	if repo.LastDownloadDate.IsZero() {
 		fmt.Printf("Last update: never\n")
 	} else {
@@ -5,6 +5,7 @@ import (
 	"github.com/gonuts/commander"
 	"github.com/gonuts/flag"
 	"github.com/smira/aptly/debian"
+	"time"
 )
 
 func aptlyMirrorUpdate(cmd *commander.Command, args []string) error {
@@ -29,19 +30,43 @@ func aptlyMirrorUpdate(cmd *commander.Command, args []string) error {
 
 	ignoreMismatch := cmd.Flag.Lookup("ignore-checksums").Value.Get().(bool)
 
-	verifier, err := getVerifier(cmd)
+	err = setTransportOptions(cmd, repo)
+	if err != nil {
+		return fmt.Errorf("unable to update: %s", err)
+	}
+
+	if concurrency := cmd.Flag.Lookup("download-concurrency").Value.Get().(int); concurrency > 0 {
+		repo.DownloadConcurrency = concurrency
+	}
+	if speedLimit := cmd.Flag.Lookup("download-limit").Value.Get().(int64); speedLimit > 0 {
+		repo.DownloadSpeedLimit = speedLimit
+	}
+
+	verifier, cleanup, err := getVerifier(cmd, repo.TrustedKeys)
+	defer cleanup()
 	if err != nil {
 		return fmt.Errorf("unable to initialize GPG verifier: %s", err)
 	}
 
-	err = repo.Fetch(context.downloader, verifier)
+	downloader, err := getDownloader(repo)
+	if err != nil {
+		return fmt.Errorf("unable to initialize downloader: %s", err)
+	}
+
+	err = repo.Fetch(downloader, verifier)
 	if err != nil {
 		return fmt.Errorf("unable to update: %s", err)
 	}
 
+	err = repo.CheckFreshness(time.Now(), cmd.Flag.Lookup("allow-rollback").Value.Get().(bool),
+		cmd.Flag.Lookup("allow-expired").Value.Get().(bool))
+	if err != nil {
+		return fmt.Errorf("unable to update: %s (use -allow-rollback or -allow-expired to override)", err)
+	}
+
 	packageCollection := debian.NewPackageCollection(context.database)
 
-	err = repo.Download(context.progress, context.downloader, packageCollection, context.packagePool, ignoreMismatch)
+	err = repo.Download(context.progress, downloader, packageCollection, context.packagePool, getIndexDir(), context.dependencyOptions, ignoreMismatch)
 	if err != nil {
 		return fmt.Errorf("unable to update: %s", err)
 	}
@@ -65,6 +90,21 @@ Updates remote mirror (downloads package files and meta information). When mirro
 this command should be run for the first time to fetch mirror contents. This command could be
 run many times to get updated repository contents. If interrupted, command could be restarted safely.
 
+Index files from previous update are kept in aptly root directory, if remote repository publishes
+pdiffs (Packages.diff/Index), index files are updated incrementally instead of downloading them again.
+
+If mirror was created with -filter, only matching packages are downloaded.
+
+Release file is rejected if its Date is older than Date of Release file accepted by previous update
+(protection against rollback attacks) or if Valid-Until date has passed, use -allow-rollback and
+-allow-expired flags to override.
+
+Transport settings (-proxy, -ca-bundle, -client-cert, -client-key, -netrc) given to update
+replace settings saved with the mirror. The same applies to -download-concurrency and
+-download-limit (bandwidth cap in bytes/sec), which override downloadConcurrency and
+downloadSpeedLimit from configuration file for the mirror. Mirror limit can't exceed global
+limit.
+
 Example:
 
   $ aptly mirror update wheezy-main
@@ -72,9 +112,14 @@ Example:
 		Flag: *flag.NewFlagSet("aptly-mirror-update", flag.ExitOnError),
 	}
 
+	cmd.Flag.Bool("allow-expired", false, "accept Release file with Valid-Until in the past")
+	cmd.Flag.Bool("allow-rollback", false, "accept Release file older than the one from previous update")
+	cmd.Flag.Int("download-concurrency", 0, "number of parallel downloads for the mirror (saved for future updates)")
+	cmd.Flag.Int64("download-limit", 0, "bandwidth limit for the mirror in bytes/sec (saved for future updates)")
 	cmd.Flag.Bool("ignore-checksums", false, "ignore checksum mismatches while downloading package files and metadata")
 	cmd.Flag.Bool("ignore-signatures", false, "disable verification of Release file signatures")
 	cmd.Flag.Var(&keyRings, "keyring", "gpg keyring to use when verifying Release file (could be specified multiple times)")
+	addTransportFlags(cmd)
 
 	return cmd
 }
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+	"github.com/smira/aptly/debian"
+)
+
+// queryAllPackages runs package query over all packages in the database
+func queryAllPackages(query string) (*debian.PackageList, error) {
+	q, err := debian.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	packageCollection := context.collectionFactory.PackageCollection()
+
+	list, err := debian.NewPackageListFromRefList(packageCollection.AllPackageRefs(), packageCollection, context.progress)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load packages: %s", err)
+	}
+
+	list.PrepareIndex()
+
+	return list.Query(q), nil
+}
+
+func aptlyPackageSearch(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 1 {
+		cmd.Usage()
+		return err
+	}
+
+	result, err := queryAllPackages(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to search: %s", err)
+	}
+
+	if result.Len() == 0 {
+		return fmt.Errorf("no results")
+	}
+
+	return result.ForEachSorted(func(p *debian.Package) error {
+		fmt.Printf("%s\n", p)
+		return nil
+	})
+}
+
+func makeCmdPackageSearch() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPackageSearch,
+		UsageLine: "search <package-query>",
+		Short:     "search for packages matching query",
+		Long: `
+Command search displays list of packages in the whole database that
+match package query, regardless of which mirrors, local repos or snapshots
+they belong to. Query syntax is the same as for 'aptly snapshot filter'.
+
+Example:
+
+    $ aptly package search '$Architecture (i386), Package (% *-dev)'
+    $ aptly package search 'openssl (1.0.1e-2+deb7u4)'
+`,
+		Flag: *flag.NewFlagSet("aptly-package-search", flag.ExitOnError),
+	}
+
+	return cmd
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+	"github.com/smira/aptly/debian"
+	"os"
+)
+
+// printReferencedBy shows all mirrors, local repos, snapshots and published repos that contain package
+func printReferencedBy(p *debian.Package, mirrors []*debian.RemoteRepo, localRepos []*debian.LocalRepo,
+	snapshots []*debian.Snapshot, published []*debian.PublishedRepo) {
+	fmt.Printf("References to package:\n")
+
+	for _, repo := range mirrors {
+		if repo.RefList() != nil && repo.RefList().Has(p) {
+			fmt.Printf("  mirror %s\n", repo)
+		}
+	}
+
+	for _, repo := range localRepos {
+		if repo.RefList() != nil && repo.RefList().Has(p) {
+			fmt.Printf("  local repo %s\n", repo)
+		}
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.RefList().Has(p) {
+			fmt.Printf("  snapshot %s\n", snapshot)
+		}
+	}
+
+	for _, repo := range published {
+		for _, component := range repo.Components() {
+			if repo.RefList(component).Has(p) {
+				fmt.Printf("  published %s, component %s\n", repo, component)
+			}
+		}
+	}
+}
+
+func aptlyPackageShow(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 1 {
+		cmd.Usage()
+		return err
+	}
+
+	result, err := queryAllPackages(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to show: %s", err)
+	}
+
+	if result.Len() == 0 {
+		return fmt.Errorf("no results")
+	}
+
+	// load everything that might reference packages
+	mirrors := []*debian.RemoteRepo{}
+	err = context.collectionFactory.RemoteRepoCollection().ForEach(func(repo *debian.RemoteRepo) error {
+		mirrors = append(mirrors, repo)
+		return context.collectionFactory.RemoteRepoCollection().LoadComplete(repo)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to load mirrors: %s", err)
+	}
+
+	localRepos := []*debian.LocalRepo{}
+	err = context.collectionFactory.LocalRepoCollection().ForEach(func(repo *debian.LocalRepo) error {
+		localRepos = append(localRepos, repo)
+		return context.collectionFactory.LocalRepoCollection().LoadComplete(repo)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to load local repos: %s", err)
+	}
+
+	snapshots := []*debian.Snapshot{}
+	err = context.collectionFactory.SnapshotCollection().ForEach(func(snapshot *debian.Snapshot) error {
+		snapshots = append(snapshots, snapshot)
+		return context.collectionFactory.SnapshotCollection().LoadComplete(snapshot)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to load snapshots: %s", err)
+	}
+
+	published := []*debian.PublishedRepo{}
+	err = context.collectionFactory.PublishedRepoCollection().ForEach(func(repo *debian.PublishedRepo) error {
+		published = append(published, repo)
+		return context.collectionFactory.PublishedRepoCollection().LoadComplete(repo, context.collectionFactory)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to load published repos: %s", err)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+
+	return result.ForEachSorted(func(p *debian.Package) error {
+		err := p.Stanza().WriteTo(w)
+		if err != nil {
+			return err
+		}
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Files in the pool:\n")
+		for _, f := range p.Files() {
+			path, err := context.packagePool.Path(f.Filename, f.Checksums.MD5)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("  %s\n", path)
+			fmt.Printf("    Size: %d\n", f.Checksums.Size)
+			fmt.Printf("    MD5: %s\n", f.Checksums.MD5)
+			fmt.Printf("    SHA1: %s\n", f.Checksums.SHA1)
+			fmt.Printf("    SHA256: %s\n", f.Checksums.SHA256)
+		}
+
+		printReferencedBy(p, mirrors, localRepos, snapshots, published)
+		fmt.Printf("\n")
+
+		return nil
+	})
+}
+
+func makeCmdPackageShow() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPackageShow,
+		UsageLine: "show <package-query>",
+		Short:     "show details about packages matching query",
+		Long: `
+Command show displays full information about every package matching
+package query: control stanza, files in the package pool with their
+checksums and list of mirrors, local repos, snapshots and published
+repositories containing the package.
+
+Example:
+
+    $ aptly package show 'openssl_1.0.1e-2+deb7u4_amd64'
+    $ aptly package show '$Source (openssl)'
+`,
+		Flag: *flag.NewFlagSet("aptly-package-show", flag.ExitOnError),
+	}
+
+	return cmd
+}
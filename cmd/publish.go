@@ -1,18 +1,39 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/gonuts/commander"
 	"github.com/gonuts/flag"
 	"github.com/smira/aptly/utils"
+	"strings"
+	"time"
 )
 
-func getSigner(cmd *commander.Command) (utils.Signer, error) {
+// getSigningKeys returns list of keys specified with -gpg-key flags
+func getSigningKeys(cmd *commander.Command) []string {
+	return cmd.Flag.Lookup("gpg-key").Value.Get().([]string)
+}
+
+// getSigner creates signer which signs with keys, if keys are empty, default key is used
+func getSigner(cmd *commander.Command, keys []string) (utils.Signer, error) {
 	if cmd.Flag.Lookup("skip-signing").Value.Get().(bool) || utils.Config.GpgDisableSign {
 		return nil, nil
 	}
 
-	signer := &utils.GpgSigner{}
-	signer.SetKey(cmd.Flag.Lookup("gpg-key").Value.String())
+	var signer utils.Signer
+
+	switch utils.Config.GpgProvider {
+	case "", "gpg":
+		signer = &utils.GpgSigner{}
+	case "internal":
+		goSigner := &utils.GoSigner{}
+		goSigner.SetPassphrase("", cmd.Flag.Lookup("passphrase-file").Value.String())
+		signer = goSigner
+	default:
+		return nil, fmt.Errorf("unknown gpg provider: %s", utils.Config.GpgProvider)
+	}
+
+	signer.SetKeys(keys)
 	signer.SetKeyRing(cmd.Flag.Lookup("keyring").Value.String(), cmd.Flag.Lookup("secret-keyring").Value.String())
 
 	err := signer.Init()
@@ -24,14 +45,41 @@ func getSigner(cmd *commander.Command) (utils.Signer, error) {
 
 }
 
+func getReleaseDate(cmd *commander.Command) (time.Time, error) {
+	releaseDate := cmd.Flag.Lookup("release-date").Value.String()
+	if releaseDate == "" {
+		return time.Time{}, nil
+	}
+
+	return utils.ParseEpoch(releaseDate)
+}
+
+// parsePrefix splits [<storage>:]<prefix> into storage & prefix
+func parsePrefix(param string) (storage, prefix string) {
+	i := strings.LastIndex(param, ":")
+	if i == -1 {
+		return "", param
+	}
+
+	storage, prefix = param[:i], param[i+1:]
+	if prefix == "" {
+		prefix = "."
+	}
+
+	return
+}
+
 func makeCmdPublish() *commander.Command {
 	return &commander.Command{
 		UsageLine: "publish",
 		Short:     "manage published repositories",
 		Subcommands: []*commander.Command{
+			makeCmdPublishRepo(),
 			makeCmdPublishSnapshot(),
 			makeCmdPublishList(),
 			makeCmdPublishDrop(),
+			makeCmdPublishSwitch(),
+			makeCmdPublishUpdate(),
 		},
 		Flag: *flag.NewFlagSet("aptly-publish", flag.ExitOnError),
 	}
@@ -15,20 +15,25 @@ func aptlyPublishDrop(cmd *commander.Command, args []string) error {
 	}
 
 	distribution := args[0]
-	prefix := "."
+	storage, prefix := "", "."
 
 	if len(args) == 2 {
-		prefix = args[1]
+		storage, prefix = parsePrefix(args[1])
 	}
 
 	publishedCollecton := debian.NewPublishedRepoCollection(context.database)
 
-	err = publishedCollecton.Remove(context.publishedStorage, prefix, distribution)
+	publishedStorage, err := getPublishedStorage(storage)
 	if err != nil {
 		return fmt.Errorf("unable to remove: %s", err)
 	}
 
-	fmt.Printf("\nPublished repositroy has been removed successfully.\n")
+	err = publishedCollecton.Remove(publishedStorage, storage, prefix, distribution, context.progress)
+	if err != nil {
+		return fmt.Errorf("unable to remove: %s", err)
+	}
+
+	context.progress.Printf("\nPublished repositroy has been removed successfully.\n")
 
 	return err
 }
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+)
+
+func makeCmdPublishRepo() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPublishSnapshotOrRepo,
+		UsageLine: "repo <name> [[<name> ...] <prefix>]",
+		Short:     "publish local repository",
+		Long: `
+Command publish publishes current state of local repository ready to be
+consumed by apt tools. Published repostiories appear under rootDir/public
+directory. Valid GPG key is required for publishing. To sign Release files
+with several keys, specify -gpg-key flag multiple times.
+
+Prefix could be prepended with storage name to publish to S3 endpoint
+configured in s3PublishEndpoints section of config: s3:<endpoint>:<prefix>.
+
+Published local repository could be updated after changes to the local
+repository with command 'aptly publish update'.
+
+Multiple component repository could be published by specifying several
+components split by commas via -component flag and multiple local
+repositories as the arguments:
+
+    aptly publish repo -component=main,contrib repo-main repo-contrib
+
+Example:
+
+    $ aptly publish repo testing
+`,
+		Flag: *flag.NewFlagSet("aptly-publish-repo", flag.ExitOnError),
+	}
+	cmd.Flag.String("distribution", "", "distribution name to publish")
+	cmd.Flag.String("component", "", "component name to publish (for multi-component publishing, separate components with commas)")
+	cmd.Flag.Var(&stringsFlag{}, "gpg-key", "GPG key ID to use when signing the release (could be specified multiple times)")
+	cmd.Flag.String("keyring", "", "GPG keyring to use (instead of default)")
+	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
+	cmd.Flag.String("passphrase-file", "", "file with passphrase for the signing key (internal gpg provider only)")
+	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
+	cmd.Flag.String("release-date", "", "pin Date field of Release file to specified number of seconds since Unix epoch (default is SOURCE_DATE_EPOCH or current time)")
+	cmd.Flag.String("compression", "", "comma-separated list of compression formats for indexes: none, gz, bz2, xz (default from configuration)")
+	cmd.Flag.Bool("acquire-by-hash", false, "store indexes under by-hash/SHA256/<digest> as well and advertise Acquire-By-Hash in Release")
+	cmd.Flag.String("origin", "", "value of Origin field in Release file (default is '<prefix> <distribution>')")
+	cmd.Flag.String("label", "", "value of Label field in Release file (default is '<prefix> <distribution>')")
+	cmd.Flag.String("suite", "", "value of Suite field in Release file (omitted by default)")
+	cmd.Flag.String("version", "", "value of Version field in Release file (omitted by default)")
+	cmd.Flag.Bool("notautomatic", false, "set NotAutomatic: yes in Release file")
+	cmd.Flag.Bool("butautomaticupgrades", false, "set ButAutomaticUpgrades: yes in Release file (requires -notautomatic)")
+	cmd.Flag.String("valid-for", "", "validity period of Release file to generate Valid-Until field, e.g. 168h")
+
+	return cmd
+}
@@ -7,40 +7,119 @@ import (
 	"github.com/smira/aptly/debian"
 	"github.com/smira/aptly/utils"
 	"strings"
+	"time"
 )
 
-func aptlyPublishSnapshot(cmd *commander.Command, args []string) error {
+func aptlyPublishSnapshotOrRepo(cmd *commander.Command, args []string) error {
 	var err error
-	if len(args) < 1 || len(args) > 2 {
+
+	components := strings.Split(cmd.Flag.Lookup("component").Value.String(), ",")
+
+	if len(args) < len(components) || len(args) > len(components)+1 {
 		cmd.Usage()
 		return err
 	}
 
-	name := args[0]
-
-	var prefix string
-	if len(args) == 2 {
-		prefix = args[1]
+	var storage, prefix string
+	if len(args) == len(components)+1 {
+		storage, prefix = parsePrefix(args[len(components)])
+		args = args[0:len(components)]
 	} else {
 		prefix = ""
 	}
 
-	snapshot, err := context.collectionFactory.SnapshotCollection().ByName(name)
-	if err != nil {
-		return fmt.Errorf("unable to publish: %s", err)
+	var (
+		sources = []interface{}{}
+		message string
+	)
+
+	if cmd.Name() == "snapshot" {
+		var (
+			snapshot *debian.Snapshot
+			parts    = []string{}
+		)
+
+		for _, name := range args {
+			snapshot, err = context.collectionFactory.SnapshotCollection().ByName(name)
+			if err != nil {
+				return fmt.Errorf("unable to publish: %s", err)
+			}
+
+			err = context.collectionFactory.SnapshotCollection().LoadComplete(snapshot)
+			if err != nil {
+				return fmt.Errorf("unable to publish: %s", err)
+			}
+
+			sources = append(sources, snapshot)
+			parts = append(parts, snapshot.Name)
+		}
+
+		if len(parts) == 1 {
+			message = fmt.Sprintf("Snapshot %s has", parts[0])
+		} else {
+			message = fmt.Sprintf("Snapshots %s have", strings.Join(parts, ", "))
+		}
+	} else if cmd.Name() == "repo" {
+		var (
+			localRepo *debian.LocalRepo
+			parts     = []string{}
+		)
+
+		for _, name := range args {
+			localRepo, err = context.collectionFactory.LocalRepoCollection().ByName(name)
+			if err != nil {
+				return fmt.Errorf("unable to publish: %s", err)
+			}
+
+			err = context.collectionFactory.LocalRepoCollection().LoadComplete(localRepo)
+			if err != nil {
+				return fmt.Errorf("unable to publish: %s", err)
+			}
+
+			sources = append(sources, localRepo)
+			parts = append(parts, localRepo.Name)
+		}
+
+		if len(parts) == 1 {
+			message = fmt.Sprintf("Local repo %s has", parts[0])
+		} else {
+			message = fmt.Sprintf("Local repos %s have", strings.Join(parts, ", "))
+		}
+	} else {
+		panic("unknown command")
 	}
 
-	err = context.collectionFactory.SnapshotCollection().LoadComplete(snapshot)
+	distribution := cmd.Flag.Lookup("distribution").Value.String()
+
+	published, err := debian.NewPublishedRepo(storage, prefix, distribution, context.architecturesList, components, sources, context.collectionFactory)
 	if err != nil {
 		return fmt.Errorf("unable to publish: %s", err)
 	}
 
-	component := cmd.Flag.Lookup("component").Value.String()
-	distribution := cmd.Flag.Lookup("distribution").Value.String()
+	compression := cmd.Flag.Lookup("compression").Value.String()
+	if compression != "" {
+		published.Compression = strings.Split(compression, ",")
+	}
 
-	published, err := debian.NewPublishedRepo(prefix, distribution, component, context.architecturesList, snapshot, context.collectionFactory)
-	if err != nil {
-		return fmt.Errorf("unable to publish: %s", err)
+	published.AcquireByHash = cmd.Flag.Lookup("acquire-by-hash").Value.Get().(bool)
+
+	published.Origin = cmd.Flag.Lookup("origin").Value.String()
+	published.Label = cmd.Flag.Lookup("label").Value.String()
+	published.Suite = cmd.Flag.Lookup("suite").Value.String()
+	published.Version = cmd.Flag.Lookup("version").Value.String()
+	published.NotAutomatic = cmd.Flag.Lookup("notautomatic").Value.Get().(bool)
+	published.ButAutomaticUpgrades = cmd.Flag.Lookup("butautomaticupgrades").Value.Get().(bool)
+
+	if published.ButAutomaticUpgrades && !published.NotAutomatic {
+		return fmt.Errorf("unable to publish: -butautomaticupgrades requires -notautomatic")
+	}
+
+	validFor := cmd.Flag.Lookup("valid-for").Value.String()
+	if validFor != "" {
+		published.ValidFor, err = time.ParseDuration(validFor)
+		if err != nil {
+			return fmt.Errorf("unable to publish: invalid validity period: %s", err)
+		}
 	}
 
 	duplicate := context.collectionFactory.PublishedRepoCollection().CheckDuplicate(published)
@@ -49,12 +128,24 @@ func aptlyPublishSnapshot(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("prefix/distribution already used by another published repo: %s", duplicate)
 	}
 
-	signer, err := getSigner(cmd)
+	publishedStorage, err := getPublishedStorage(published.Storage)
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	published.SigningKeys = getSigningKeys(cmd)
+
+	signer, err := getSigner(cmd, published.SigningKeys)
 	if err != nil {
 		return fmt.Errorf("unable to initialize GPG signer: %s", err)
 	}
 
-	err = published.Publish(context.packagePool, context.publishedStorage, context.collectionFactory, signer, context.progress)
+	published.ReleaseDate, err = getReleaseDate(cmd)
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	err = published.Publish(context.packagePool, publishedStorage, context.collectionFactory, signer, context.progress)
 	if err != nil {
 		return fmt.Errorf("unable to publish: %s", err)
 	}
@@ -64,15 +155,20 @@ func aptlyPublishSnapshot(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to save to DB: %s", err)
 	}
 
-	prefix, component, distribution = published.Prefix, published.Component, published.Distribution
+	prefix, distribution = published.Prefix, published.Distribution
+	component := strings.Join(published.Components(), " ")
 	if prefix == "." {
 		prefix = ""
 	} else if !strings.HasSuffix(prefix, "/") {
 		prefix += "/"
 	}
 
-	context.progress.Printf("\nSnapshot %s has been successfully published.\nPlease setup your webserver to serve directory '%s' with autoindexing.\n",
-		snapshot.Name, context.publishedStorage.PublicPath())
+	if published.Storage == "" {
+		context.progress.Printf("\n%s been successfully published.\nPlease setup your webserver to serve directory '%s' with autoindexing.\n",
+			message, publishedStorage.PublicPath())
+	} else {
+		context.progress.Printf("\n%s been successfully published to %s.\n", message, publishedStorage.PublicPath())
+	}
 	context.progress.Printf("Now you can add following line to apt sources:\n")
 	context.progress.Printf("  deb http://your-server/%s %s %s\n", prefix, distribution, component)
 	if utils.StrSliceHasItem(published.Architectures, "source") {
@@ -86,13 +182,23 @@ func aptlyPublishSnapshot(cmd *commander.Command, args []string) error {
 
 func makeCmdPublishSnapshot() *commander.Command {
 	cmd := &commander.Command{
-		Run:       aptlyPublishSnapshot,
-		UsageLine: "snapshot <name> [<prefix>]",
+		Run:       aptlyPublishSnapshotOrRepo,
+		UsageLine: "snapshot <name> [[<name> ...] <prefix>]",
 		Short:     "publish snapshot",
 		Long: `
 Command publish publishes snapshot as Debian repository ready to be consumed
 by apt tools. Published repostiories appear under rootDir/public directory.
-Valid GPG key is required for publishing.
+Valid GPG key is required for publishing. To sign Release files with several
+keys (e.g. during key rotation), specify -gpg-key flag multiple times.
+
+Prefix could be prepended with storage name to publish to S3 endpoint
+configured in s3PublishEndpoints section of config: s3:<endpoint>:<prefix>.
+
+Multiple component repository could be published by specifying several
+components split by commas via -component flag and multiple snapshots
+as the arguments:
+
+    aptly publish snapshot -component=main,contrib snap-main snap-contrib
 
 Example:
 
@@ -101,11 +207,22 @@ Example:
 		Flag: *flag.NewFlagSet("aptly-publish-snapshot", flag.ExitOnError),
 	}
 	cmd.Flag.String("distribution", "", "distribution name to publish")
-	cmd.Flag.String("component", "", "component name to publish")
-	cmd.Flag.String("gpg-key", "", "GPG key ID to use when signing the release")
+	cmd.Flag.String("component", "", "component name to publish (for multi-component publishing, separate components with commas)")
+	cmd.Flag.Var(&stringsFlag{}, "gpg-key", "GPG key ID to use when signing the release (could be specified multiple times)")
 	cmd.Flag.String("keyring", "", "GPG keyring to use (instead of default)")
 	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
+	cmd.Flag.String("passphrase-file", "", "file with passphrase for the signing key (internal gpg provider only)")
 	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
+	cmd.Flag.String("release-date", "", "pin Date field of Release file to specified number of seconds since Unix epoch (default is SOURCE_DATE_EPOCH or current time)")
+	cmd.Flag.String("compression", "", "comma-separated list of compression formats for indexes: none, gz, bz2, xz (default from configuration)")
+	cmd.Flag.Bool("acquire-by-hash", false, "store indexes under by-hash/SHA256/<digest> as well and advertise Acquire-By-Hash in Release")
+	cmd.Flag.String("origin", "", "value of Origin field in Release file (default is '<prefix> <distribution>')")
+	cmd.Flag.String("label", "", "value of Label field in Release file (default is '<prefix> <distribution>')")
+	cmd.Flag.String("suite", "", "value of Suite field in Release file (omitted by default)")
+	cmd.Flag.String("version", "", "value of Version field in Release file (omitted by default)")
+	cmd.Flag.Bool("notautomatic", false, "set NotAutomatic: yes in Release file")
+	cmd.Flag.Bool("butautomaticupgrades", false, "set ButAutomaticUpgrades: yes in Release file (requires -notautomatic)")
+	cmd.Flag.String("valid-for", "", "validity period of Release file to generate Valid-Until field, e.g. 168h")
 
 	return cmd
 }
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+	"github.com/smira/aptly/utils"
+	"strings"
+)
+
+func aptlyPublishSwitch(cmd *commander.Command, args []string) error {
+	var err error
+
+	components := strings.Split(cmd.Flag.Lookup("component").Value.String(), ",")
+
+	if len(args) < len(components)+1 || len(args) > len(components)+2 {
+		cmd.Usage()
+		return err
+	}
+
+	distribution := args[0]
+	storage, prefix := "", "."
+
+	var names []string
+
+	if len(args) == len(components)+2 {
+		storage, prefix = parsePrefix(args[1])
+		names = args[2:]
+	} else {
+		names = args[1:]
+	}
+
+	publishedCollection := context.collectionFactory.PublishedRepoCollection()
+
+	published, err := publishedCollection.ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		return fmt.Errorf("unable to switch: %s", err)
+	}
+
+	if published.SourceKind != "snapshot" {
+		return fmt.Errorf("unable to switch: not a snapshot publish")
+	}
+
+	err = publishedCollection.LoadComplete(published, context.collectionFactory)
+	if err != nil {
+		return fmt.Errorf("unable to switch: %s", err)
+	}
+
+	publishedComponents := published.Components()
+	if len(components) == 1 && components[0] == "" && len(publishedComponents) == 1 {
+		components = publishedComponents
+	}
+
+	if len(names) != len(components) {
+		return fmt.Errorf("mismatch in number of components (%d) and snapshots (%d)", len(components), len(names))
+	}
+
+	for i, component := range components {
+		if !utils.StrSliceHasItem(publishedComponents, component) {
+			return fmt.Errorf("unable to switch: component %s is not in published repository", component)
+		}
+
+		snapshot, err := context.collectionFactory.SnapshotCollection().ByName(names[i])
+		if err != nil {
+			return fmt.Errorf("unable to switch: %s", err)
+		}
+
+		err = context.collectionFactory.SnapshotCollection().LoadComplete(snapshot)
+		if err != nil {
+			return fmt.Errorf("unable to switch: %s", err)
+		}
+
+		published.UpdateSnapshot(component, snapshot)
+	}
+
+	if signingKeys := getSigningKeys(cmd); len(signingKeys) > 0 {
+		published.SigningKeys = signingKeys
+	}
+
+	signer, err := getSigner(cmd, published.SigningKeys)
+	if err != nil {
+		return fmt.Errorf("unable to initialize GPG signer: %s", err)
+	}
+
+	published.ReleaseDate, err = getReleaseDate(cmd)
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	publishedStorage, err := getPublishedStorage(published.Storage)
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	err = published.Publish(context.packagePool, publishedStorage, context.collectionFactory, signer, context.progress)
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	err = publishedCollection.Update(published)
+	if err != nil {
+		return fmt.Errorf("unable to save to DB: %s", err)
+	}
+
+	err = publishedCollection.CleanupPrefixComponentFiles(published.Storage, published.Prefix, components,
+		publishedStorage, context.collectionFactory, context.progress)
+	if err != nil {
+		return fmt.Errorf("unable to switch: %s", err)
+	}
+
+	context.progress.Printf("\nPublish for snapshot %s has been successfully switched to new snapshot.\n", published)
+
+	return err
+}
+
+func makeCmdPublishSwitch() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPublishSwitch,
+		UsageLine: "switch <distribution> [<prefix>] <new-snapshot>",
+		Short:     "update published repository by switching to new snapshot",
+		Long: `
+Command switches in-place published repository with new snapshot contents. All
+publishing parameters are preserved (architecture list, distribution,
+component, signing keys unless new ones are given with -gpg-key).
+
+Indexes are regenerated first and replace the old ones only when completely
+written and signed, so clients never see partially updated repository. Package
+files which are no longer referenced are removed from the pool.
+
+For multiple component published repositories, specify list of components via
+-component flag (comma-separated) and list of new snapshots in the same order:
+
+    aptly publish switch -component=main,contrib wheezy wh-main wh-contrib
+
+Example:
+
+    $ aptly publish switch wheezy ppa wheezy-7.5
+`,
+		Flag: *flag.NewFlagSet("aptly-publish-switch", flag.ExitOnError),
+	}
+	cmd.Flag.Var(&stringsFlag{}, "gpg-key", "GPG key ID to use when signing the release (could be specified multiple times)")
+	cmd.Flag.String("keyring", "", "GPG keyring to use (instead of default)")
+	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
+	cmd.Flag.String("passphrase-file", "", "file with passphrase for the signing key (internal gpg provider only)")
+	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
+	cmd.Flag.String("release-date", "", "pin Date field of Release file to specified number of seconds since Unix epoch (default is SOURCE_DATE_EPOCH or current time)")
+	cmd.Flag.String("component", "", "component names to update (for multi-component publishing, separate components with commas)")
+
+	return cmd
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/gonuts/commander"
+	"github.com/gonuts/flag"
+)
+
+func aptlyPublishUpdate(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) < 1 || len(args) > 2 {
+		cmd.Usage()
+		return err
+	}
+
+	distribution := args[0]
+	storage, prefix := "", "."
+
+	if len(args) == 2 {
+		storage, prefix = parsePrefix(args[1])
+	}
+
+	publishedCollection := context.collectionFactory.PublishedRepoCollection()
+
+	published, err := publishedCollection.ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		return fmt.Errorf("unable to update: %s", err)
+	}
+
+	if published.SourceKind != "local" {
+		return fmt.Errorf("unable to update: not a local repository publish")
+	}
+
+	err = publishedCollection.LoadComplete(published, context.collectionFactory)
+	if err != nil {
+		return fmt.Errorf("unable to update: %s", err)
+	}
+
+	components := published.Components()
+
+	if signingKeys := getSigningKeys(cmd); len(signingKeys) > 0 {
+		published.SigningKeys = signingKeys
+	}
+
+	signer, err := getSigner(cmd, published.SigningKeys)
+	if err != nil {
+		return fmt.Errorf("unable to initialize GPG signer: %s", err)
+	}
+
+	published.ReleaseDate, err = getReleaseDate(cmd)
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	publishedStorage, err := getPublishedStorage(published.Storage)
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	err = published.Publish(context.packagePool, publishedStorage, context.collectionFactory, signer, context.progress)
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	err = publishedCollection.Update(published)
+	if err != nil {
+		return fmt.Errorf("unable to save to DB: %s", err)
+	}
+
+	err = publishedCollection.CleanupPrefixComponentFiles(published.Storage, published.Prefix, components,
+		publishedStorage, context.collectionFactory, context.progress)
+	if err != nil {
+		return fmt.Errorf("unable to update: %s", err)
+	}
+
+	context.progress.Printf("\nPublish for local repo %s has been successfully updated.\n", published)
+
+	return err
+}
+
+func makeCmdPublishUpdate() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPublishUpdate,
+		UsageLine: "update <distribution> [<prefix>]",
+		Short:     "update published local repository",
+		Long: `
+Command re-publishes (updates) published local repository. <distribution>
+and <prefix> should be occupied with local repository published
+using command 'aptly publish repo'. Update happens in-place with
+minimum possible downtime for published repository.
+
+Release files are signed with the same keys as when publishing, unless
+new list of keys is specified with -gpg-key flags.
+
+Example:
+
+    $ aptly publish update wheezy ppa
+`,
+		Flag: *flag.NewFlagSet("aptly-publish-update", flag.ExitOnError),
+	}
+	cmd.Flag.Var(&stringsFlag{}, "gpg-key", "GPG key ID to use when signing the release (could be specified multiple times)")
+	cmd.Flag.String("keyring", "", "GPG keyring to use (instead of default)")
+	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
+	cmd.Flag.String("passphrase-file", "", "file with passphrase for the signing key (internal gpg provider only)")
+	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
+	cmd.Flag.String("release-date", "", "pin Date field of Release file to specified number of seconds since Unix epoch (default is SOURCE_DATE_EPOCH or current time)")
+
+	return cmd
+}
@@ -21,7 +21,10 @@ func aptlyRepoAdd(cmd *commander.Command, args []string) error {
 
 	name := args[0]
 
-	verifier := &utils.GpgVerifier{}
+	verifier, err := newVerifier()
+	if err != nil {
+		return fmt.Errorf("unable to add: %s", err)
+	}
 
 	localRepoCollection := debian.NewLocalRepoCollection(context.database)
 	repo, err := localRepoCollection.ByName(name)
@@ -59,14 +62,16 @@ func aptlyRepoAdd(cmd *commander.Command, args []string) error {
 					return nil
 				}
 
-				if strings.HasSuffix(info.Name(), ".deb") || strings.HasSuffix(info.Name(), ".dsc") {
+				if strings.HasSuffix(info.Name(), ".deb") || strings.HasSuffix(info.Name(), ".udeb") ||
+					strings.HasSuffix(info.Name(), ".dsc") {
 					packageFiles = append(packageFiles, path)
 				}
 
 				return nil
 			})
 		} else {
-			if strings.HasSuffix(info.Name(), ".deb") || strings.HasSuffix(info.Name(), ".dsc") {
+			if strings.HasSuffix(info.Name(), ".deb") || strings.HasSuffix(info.Name(), ".udeb") ||
+				strings.HasSuffix(info.Name(), ".dsc") {
 				packageFiles = append(packageFiles, location)
 			} else {
 				context.progress.ColoredPrintf("@y[!]@| @!Unknwon file extenstion: %s@|", location)
@@ -87,6 +92,7 @@ func aptlyRepoAdd(cmd *commander.Command, args []string) error {
 
 		candidateProcessedFiles := []string{}
 		isSourcePackage := strings.HasSuffix(file, ".dsc")
+		isUdebPackage := strings.HasSuffix(file, ".udeb")
 
 		if isSourcePackage {
 			stanza, err = debian.GetControlFileFromDsc(file, verifier)
@@ -99,7 +105,11 @@ func aptlyRepoAdd(cmd *commander.Command, args []string) error {
 			}
 		} else {
 			stanza, err = debian.GetControlFileFromDeb(file)
-			p = debian.NewPackageFromControlFile(stanza)
+			if isUdebPackage {
+				p = debian.NewUdebPackageFromControlFile(stanza)
+			} else {
+				p = debian.NewPackageFromControlFile(stanza)
+			}
 		}
 		if err != nil {
 			context.progress.ColoredPrintf("@y[!]@| @!Unable to read file %s: %s@|", file, err)
@@ -187,9 +197,9 @@ func makeCmdRepoAdd() *commander.Command {
 		UsageLine: "add <name> <package file.deb>|<directory> ...",
 		Short:     "add packages to local repository",
 		Long: `
-Command adds packages to local repository from .deb (binary packages) and .dsc (source packages) files.
-When importing from directory aptly would do recursive scan looking for all files matching *.deb or *.dsc
-patterns. Every file discovered would be analyzed to extract metadata, package would be created and added
+Command adds packages to local repository from .deb (binary packages), .udeb (debian-installer packages)
+and .dsc (source packages) files. When importing from directory aptly would do recursive scan looking for
+all files matching *.deb, *.udeb or *.dsc patterns. Every file discovered would be analyzed to extract metadata, package would be created and added
 to database. Files would be imported to internal package pool. For source packages, all required files are
 added as well automatically. Extra files for source package should be in the same directory as *.dsc file.
 
@@ -22,6 +22,21 @@ func aptlyRepoDrop(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to drop: %s", err)
 	}
 
+	published := context.collectionFactory.PublishedRepoCollection().ByLocalRepo(repo)
+
+	if len(published) > 0 {
+		fmt.Printf("Local repo `%s` is published currently:\n", repo.Name)
+		for _, p := range published {
+			err = context.collectionFactory.PublishedRepoCollection().LoadComplete(p, context.collectionFactory)
+			if err != nil {
+				return fmt.Errorf("unable to load published: %s", err)
+			}
+			fmt.Printf(" * %s\n", p)
+		}
+
+		return fmt.Errorf("unable to drop: local repo is published")
+	}
+
 	force := cmd.Flag.Lookup("force").Value.Get().(bool)
 	if !force {
 		snapshotCollection := debian.NewSnapshotCollection(context.database)
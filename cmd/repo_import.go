@@ -14,6 +14,10 @@ func makeCmdRepoImport() *commander.Command {
 Command import looks up packages matching <package-spec> in mirror <src-mirror>
 and copies them to local repo <dst-repo>.
 
+<package-spec> is package query: package name, dependency like 'myapp (>= 0.1.12)',
+package reference 'myapp_0.1.12_i386' or condition on fields, e.g. '$Source (myapp), !Section (debug)'.
+Conditions could be combined with ',' (and), '|' (or), '!' (not) and parentheses.
+
 Example:
 
   $ aptly repo import wheezy-main testing nginx
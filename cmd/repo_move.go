@@ -171,6 +171,10 @@ func makeCmdRepoMove() *commander.Command {
 Command move moves packages matching <package-spec> from local repo
 <src-name> to local repo <dst-name>.
 
+<package-spec> is package query: package name, dependency like 'myapp (>= 0.1.12)',
+package reference 'myapp_0.1.12_i386' or condition on fields, e.g. '$Source (myapp), !Section (debug)'.
+Conditions could be combined with ',' (and), '|' (or), '!' (not) and parentheses.
+
 Example:
 
   $ aptly repo move testing stable 'myapp (=0.1.12)'
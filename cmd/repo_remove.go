@@ -72,6 +72,10 @@ Commands removes packages matching <package-spec> from local repository
 snapshots, they can be removed completely (including files) by running
 'aptly db cleanup'.
 
+<package-spec> is package query: package name, dependency like 'myapp (>= 0.1.12)',
+package reference 'myapp_0.1.12_i386' or condition on fields, e.g. '$Source (myapp), !Section (debug)'.
+Conditions could be combined with ',' (and), '|' (or), '!' (not) and parentheses.
+
 Example:
 
   $ aptly repo remove testing 'myapp (=0.1.12)'
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"strings"
 )
 
 func aptlyServe(cmd *commander.Command, args []string) error {
@@ -46,6 +47,11 @@ func aptlyServe(cmd *commander.Command, args []string) error {
 			return err
 		}
 
+		if repo.Storage != "" {
+			// published to remote storage, can't be served locally
+			return nil
+		}
+
 		sources = append(sources, repo.String())
 		published[repo.String()] = repo
 
@@ -69,19 +75,24 @@ func aptlyServe(cmd *commander.Command, args []string) error {
 		}
 
 		fmt.Printf("# %s\ndeb http://%s:%s/%s %s %s\n",
-			repo, listenHost, listenPort, prefix, repo.Distribution, repo.Component)
+			repo, listenHost, listenPort, prefix, repo.Distribution, strings.Join(repo.Components(), " "))
 
 		if utils.StrSliceHasItem(repo.Architectures, "source") {
 			fmt.Printf("deb-src http://%s:%s/%s %s %s\n",
-				listenHost, listenPort, prefix, repo.Distribution, repo.Component)
+				listenHost, listenPort, prefix, repo.Distribution, strings.Join(repo.Components(), " "))
 		}
 	}
 
+	publishedStorage, err := getPublishedStorage("")
+	if err != nil {
+		return fmt.Errorf("unable to serve: %s", err)
+	}
+
 	context.database.Close()
 
 	fmt.Printf("\nStarting web server at: %s (press Ctrl+C to quit)...\n", listen)
 
-	err = http.ListenAndServe(listen, http.FileServer(http.Dir(context.publishedStorage.PublicPath())))
+	err = http.ListenAndServe(listen, http.FileServer(http.Dir(publishedStorage.PublicPath())))
 	if err != nil {
 		return fmt.Errorf("unable to serve: %s", err)
 	}
@@ -17,6 +17,7 @@ func makeCmdSnapshot() *commander.Command {
 			makeCmdSnapshotPull(),
 			makeCmdSnapshotDiff(),
 			makeCmdSnapshotMerge(),
+			makeCmdSnapshotFilter(),
 			makeCmdSnapshotDrop(),
 		},
 		Flag: *flag.NewFlagSet("aptly-snapshot", flag.ExitOnError),
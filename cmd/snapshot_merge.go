@@ -1,13 +1,52 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/gonuts/commander"
 	"github.com/gonuts/flag"
 	"github.com/smira/aptly/debian"
+	"os"
 	"strings"
 )
 
+// loadPrecedenceFile reads file with lines '<package-name> <snapshot>', returns
+// list of package names for each snapshot name
+func loadPrecedenceFile(filename string) (map[string][]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make(map[string][]string)
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected '<package-name> <snapshot>'", filename, lineNo)
+		}
+		if seen[fields[0]] {
+			return nil, fmt.Errorf("%s:%d: duplicate entry for package %s", filename, lineNo, fields[0])
+		}
+		seen[fields[0]] = true
+
+		result[fields[1]] = append(result[fields[1]], fields[0])
+	}
+
+	return result, scanner.Err()
+}
+
 func aptlySnapshotMerge(cmd *commander.Command, args []string) error {
 	var err error
 	if len(args) < 2 {
@@ -15,6 +54,22 @@ func aptlySnapshotMerge(cmd *commander.Command, args []string) error {
 		return err
 	}
 
+	latest := cmd.Flag.Lookup("latest").Value.Get().(bool)
+	noRemove := cmd.Flag.Lookup("no-remove").Value.Get().(bool)
+	precedenceFile := cmd.Flag.Lookup("precedence").Value.String()
+
+	if latest && noRemove {
+		return fmt.Errorf("-no-remove and -latest can't be specified together")
+	}
+
+	var precedence map[string][]string
+	if precedenceFile != "" {
+		precedence, err = loadPrecedenceFile(precedenceFile)
+		if err != nil {
+			return fmt.Errorf("unable to load precedence file: %s", err)
+		}
+	}
+
 	snapshotCollection := debian.NewSnapshotCollection(context.database)
 
 	sources := make([]*debian.Snapshot, len(args)-1)
@@ -34,7 +89,27 @@ func aptlySnapshotMerge(cmd *commander.Command, args []string) error {
 	result := sources[0].RefList()
 
 	for i := 1; i < len(sources); i++ {
-		result = result.Merge(sources[i].RefList(), true)
+		result = result.Merge(sources[i].RefList(), !(latest || noRemove))
+	}
+
+	if latest {
+		result = result.FilterLatestRefs()
+	}
+
+	for snapshotName, packages := range precedence {
+		var source *debian.Snapshot
+		for _, s := range sources {
+			if s.Name == snapshotName {
+				source = s
+				break
+			}
+		}
+
+		if source == nil {
+			return fmt.Errorf("precedence file refers to snapshot %s, which is not merged", snapshotName)
+		}
+
+		result = result.Override(source.RefList(), packages)
 	}
 
 	sourceDescription := make([]string, len(sources))
@@ -42,9 +117,24 @@ func aptlySnapshotMerge(cmd *commander.Command, args []string) error {
 		sourceDescription[i] = fmt.Sprintf("'%s'", s.Name)
 	}
 
+	description := fmt.Sprintf("Merged from sources: %s", strings.Join(sourceDescription, ", "))
+
+	policy := []string{}
+	if latest {
+		policy = append(policy, "latest versions")
+	}
+	if noRemove {
+		policy = append(policy, "all versions kept")
+	}
+	if precedenceFile != "" {
+		policy = append(policy, fmt.Sprintf("precedence from '%s'", precedenceFile))
+	}
+	if len(policy) > 0 {
+		description += fmt.Sprintf(" (%s)", strings.Join(policy, ", "))
+	}
+
 	// Create <destination> snapshot
-	destination := debian.NewSnapshotFromRefList(args[0], sources, result,
-		fmt.Sprintf("Merged from sources: %s", strings.Join(sourceDescription, ", ")))
+	destination := debian.NewSnapshotFromRefList(args[0], sources, result, description)
 
 	err = snapshotCollection.Add(destination)
 	if err != nil {
@@ -68,12 +158,26 @@ pair are replaced during merge (package from latest snapshot on the list
 wins). If run with only one source snapshot, merge copies <source> into
 <destination>.
 
+With -latest, the highest version of each package (by name and architecture)
+is kept, regardless of order of snapshots. With -no-remove, all versions are
+kept in <destination>.
+
+Precedence file given with -precedence lists packages which should be taken
+from specific snapshot, one per line: '<package-name> <snapshot>' ('#' starts
+a comment). All versions of listed package are replaced
+with versions from that snapshot, policy above applies to other packages.
+
 Example:
 
     $ aptly snapshot merge wheezy-w-backports wheezy-main wheezy-backports
+    $ aptly snapshot merge -latest wheezy-w-security wheezy-main wheezy-security
 `,
 		Flag: *flag.NewFlagSet("aptly-snapshot-merge", flag.ExitOnError),
 	}
 
+	cmd.Flag.Bool("latest", false, "use only the latest version of each package")
+	cmd.Flag.Bool("no-remove", false, "don't remove duplicate versions of packages, keep all of them")
+	cmd.Flag.String("precedence", "", "file with list of packages which should be taken from specific snapshots")
+
 	return cmd
 }
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"path/filepath"
+)
+
+type SnapshotMergeSuite struct {
+	filename string
+}
+
+var _ = Suite(&SnapshotMergeSuite{})
+
+func (s *SnapshotMergeSuite) SetUpTest(c *C) {
+	s.filename = filepath.Join(c.MkDir(), "precedence")
+}
+
+func (s *SnapshotMergeSuite) writePrecedence(c *C, contents string) {
+	c.Assert(ioutil.WriteFile(s.filename, []byte(contents), 0644), IsNil)
+}
+
+func (s *SnapshotMergeSuite) TestLoadPrecedenceFile(c *C) {
+	s.writePrecedence(c, "# packages from backports\n"+
+		"nginx wheezy-backports\n"+
+		"\n"+
+		"  nginx-common\twheezy-backports  # same source\n"+
+		"libc6 wheezy-security\n"+
+		"   # indented comment\n")
+
+	precedence, err := loadPrecedenceFile(s.filename)
+	c.Assert(err, IsNil)
+	c.Check(precedence, DeepEquals, map[string][]string{
+		"wheezy-backports": {"nginx", "nginx-common"},
+		"wheezy-security":  {"libc6"},
+	})
+}
+
+func (s *SnapshotMergeSuite) TestLoadPrecedenceFileEmpty(c *C) {
+	s.writePrecedence(c, "# nothing here\n\n")
+
+	precedence, err := loadPrecedenceFile(s.filename)
+	c.Assert(err, IsNil)
+	c.Check(precedence, HasLen, 0)
+}
+
+func (s *SnapshotMergeSuite) TestLoadPrecedenceFileMalformed(c *C) {
+	s.writePrecedence(c, "nginx wheezy-backports\nlibc6\n")
+
+	_, err := loadPrecedenceFile(s.filename)
+	c.Check(err, ErrorMatches, ".*/precedence:2: expected '<package-name> <snapshot>'")
+
+	s.writePrecedence(c, "nginx wheezy-backports wheezy-main\n")
+
+	_, err = loadPrecedenceFile(s.filename)
+	c.Check(err, ErrorMatches, ".*/precedence:1: expected '<package-name> <snapshot>'")
+}
+
+func (s *SnapshotMergeSuite) TestLoadPrecedenceFileDuplicate(c *C) {
+	s.writePrecedence(c, "nginx wheezy-backports\n# comment\nnginx wheezy-main\n")
+
+	_, err := loadPrecedenceFile(s.filename)
+	c.Check(err, ErrorMatches, ".*/precedence:3: duplicate entry for package nginx")
+}
+
+func (s *SnapshotMergeSuite) TestLoadPrecedenceFileMissing(c *C) {
+	_, err := loadPrecedenceFile(s.filename)
+	c.Check(err, ErrorMatches, ".*no such file or directory")
+}
@@ -78,10 +78,10 @@ func aptlySnapshotPull(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to determine list of architectures, please specify explicitly")
 	}
 
-	// Initial dependencies out of arguments
-	initialDependencies := make([]debian.Dependency, len(args)-3)
+	// Initial queries out of arguments
+	queries := make([]debian.PackageQuery, len(args)-3)
 	for i, arg := range args[3:] {
-		initialDependencies[i], err = debian.ParseDependency(arg)
+		queries[i], err = debian.ParseQuery(arg)
 		if err != nil {
 			return fmt.Errorf("unable to parse argument: %s", err)
 		}
@@ -89,10 +89,23 @@ func aptlySnapshotPull(cmd *commander.Command, args []string) error {
 
 	// Perform pull
 	for _, arch := range architecturesList {
-		dependencies := make([]debian.Dependency, len(initialDependencies), 128)
-		for i := range dependencies {
-			dependencies[i] = initialDependencies[i]
-			dependencies[i].Architecture = arch
+		dependencies := make([]debian.Dependency, 0, 128)
+		for _, q := range queries {
+			if depQuery, ok := q.(*debian.DependencyQuery); ok {
+				dep := depQuery.Dep
+				dep.Architecture = arch
+				dependencies = append(dependencies, dep)
+				continue
+			}
+
+			// other queries are resolved into exact package versions
+			sourcePackageList.Query(q).ForEachSorted(func(p *debian.Package) error {
+				if p.MatchesArchitecture(arch) {
+					dependencies = append(dependencies, debian.Dependency{Pkg: p.Name, Relation: debian.VersionEqual,
+						Version: p.Version, Architecture: arch})
+				}
+				return nil
+			})
 		}
 
 		// Go over list of initial dependencies + list of dependencies found
@@ -176,7 +189,8 @@ Command pull pulls new packages along with its dependencies to snapshot <name>
 from snapshot <source>. Pull can upgrade package version in <name> with
 versions from <source> following dependencies. New snapshot <destination>
 is created as result of this process. Packages could be specified simply
-as 'package-name' or as dependency 'package-name (>= version)'.
+as 'package-name', as dependency 'package-name (>= version)' or with package
+query, e.g. '$Source (xorg-server), !Priority (extra)'.
 
 Example:
 
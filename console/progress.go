@@ -66,6 +66,11 @@ func (p *Progress) Flush() {
 
 // InitBar starts progressbar for count bytes or count items
 func (p *Progress) InitBar(count int64, isBytes bool) {
+	p.InitBarWithPrefix(count, isBytes, "")
+}
+
+// InitBarWithPrefix starts progressbar with text displayed in front of it
+func (p *Progress) InitBarWithPrefix(count int64, isBytes bool, prefix string) {
 	if p.bar != nil {
 		panic("bar already initialized")
 	}
@@ -74,7 +79,7 @@ func (p *Progress) InitBar(count int64, isBytes bool) {
 		p.bar.Total = count
 		p.bar.NotPrint = true
 		p.bar.Callback = func(out string) {
-			p.queue <- printTask{code: codeProgress, message: out}
+			p.queue <- printTask{code: codeProgress, message: prefix + out}
 		}
 
 		if isBytes {
@@ -0,0 +1,63 @@
+package debian
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ContentsIndex calculates mapping from files to packages, with sorted output
+type ContentsIndex struct {
+	index map[string][]string
+}
+
+// NewContentsIndex creates empty ContentsIndex
+func NewContentsIndex() *ContentsIndex {
+	return &ContentsIndex{index: make(map[string][]string)}
+}
+
+// Push adds package files to the index
+func (index *ContentsIndex) Push(p *Package, contents []string) {
+	qualifiedName := p.QualifiedName()
+
+	for _, path := range contents {
+		index.index[path] = append(index.index[path], qualifiedName)
+	}
+}
+
+// Empty checks whether index contains no packages
+func (index *ContentsIndex) Empty() bool {
+	return len(index.index) == 0
+}
+
+// WriteTo dumps sorted mapping of files to qualified package names
+func (index *ContentsIndex) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+
+	paths := make([]string, 0, len(index.index))
+	for path := range index.index {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	nn, err := fmt.Fprintf(w, "%s %s\n", "FILE", "LOCATION")
+	n += int64(nn)
+	if err != nil {
+		return n, err
+	}
+
+	for _, path := range paths {
+		packages := index.index[path]
+		sort.Strings(packages)
+
+		nn, err = fmt.Fprintf(w, "%s %s\n", path, strings.Join(packages, ","))
+		n += int64(nn)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,34 @@
+package debian
+
+import (
+	"bytes"
+	. "launchpad.net/gocheck"
+)
+
+type ContentsIndexSuite struct {
+	PackageListMixinSuite
+}
+
+var _ = Suite(&ContentsIndexSuite{})
+
+func (s *ContentsIndexSuite) SetUpTest(c *C) {
+	s.SetUpPackages()
+}
+
+func (s *ContentsIndexSuite) TestWriteTo(c *C) {
+	index := NewContentsIndex()
+	c.Check(index.Empty(), Equals, true)
+
+	index.Push(s.p1, []string{"usr/share/games/alien-arena/data.pak", "usr/share/doc/alien-arena-common/copyright"})
+	index.Push(s.p2, []string{"usr/bin/mars-invaders", "usr/share/doc/alien-arena-common/copyright"})
+	c.Check(index.Empty(), Equals, false)
+
+	var buf bytes.Buffer
+	n, err := index.WriteTo(&buf)
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, int64(buf.Len()))
+	c.Check(buf.String(), Equals, "FILE LOCATION\n"+
+		"usr/bin/mars-invaders contrib/games/mars-invaders\n"+
+		"usr/share/doc/alien-arena-common/copyright contrib/games/alien-arena-common,contrib/games/mars-invaders\n"+
+		"usr/share/games/alien-arena/data.pak contrib/games/alien-arena-common\n")
+}
@@ -3,10 +3,13 @@ package debian
 import (
 	"archive/tar"
 	"bufio"
+	"compress/bzip2"
 	"compress/gzip"
 	"fmt"
 	"github.com/mkrautz/goar"
 	"github.com/smira/aptly/utils"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
 	"io"
 	"os"
 	"strings"
@@ -61,6 +64,84 @@ func GetControlFileFromDeb(packageFile string) (Stanza, error) {
 	}
 }
 
+// GetContentsFromDeb returns list of files installed by .deb package
+func GetContentsFromDeb(packageFile string) ([]string, error) {
+	file, err := os.Open(packageFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	library := ar.NewReader(file)
+	for {
+		header, err := library.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("unable to find data.tar.* part")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read .deb archive: %s", err)
+		}
+
+		if !strings.HasPrefix(header.Name, "data.tar") {
+			continue
+		}
+
+		var tarInput io.Reader
+
+		switch header.Name {
+		case "data.tar":
+			tarInput = library
+		case "data.tar.gz":
+			ungzip, err := gzip.NewReader(library)
+			if err != nil {
+				return nil, fmt.Errorf("unable to ungzip: %s", err)
+			}
+			defer ungzip.Close()
+			tarInput = ungzip
+		case "data.tar.bz2":
+			tarInput = bzip2.NewReader(library)
+		case "data.tar.xz":
+			unxz, err := xz.NewReader(library)
+			if err != nil {
+				return nil, fmt.Errorf("unable to unxz: %s", err)
+			}
+			tarInput = unxz
+		case "data.tar.lzma":
+			unlzma, err := lzma.NewReader(library)
+			if err != nil {
+				return nil, fmt.Errorf("unable to unlzma: %s", err)
+			}
+			tarInput = unlzma
+		default:
+			return nil, fmt.Errorf("unsupported tar compression in %s: %s", packageFile, header.Name)
+		}
+
+		untar := tar.NewReader(tarInput)
+		results := []string{}
+		for {
+			tarHeader, err := untar.Next()
+			if err == io.EOF {
+				return results, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("unable to read .tar archive from %s: %s", packageFile, err)
+			}
+
+			if tarHeader.Typeflag == tar.TypeDir {
+				continue
+			}
+
+			name := tarHeader.Name
+			if strings.HasPrefix(name, "./") {
+				name = name[2:]
+			}
+			name = strings.TrimPrefix(name, "/")
+
+			results = append(results, name)
+		}
+	}
+}
+
 // GetControlFileFromDsc reads control file from dsc package
 func GetControlFileFromDsc(dscFile string, verifier utils.Verifier) (Stanza, error) {
 	file, err := os.Open(dscFile)
@@ -1,8 +1,15 @@
 package debian
 
 import (
+	"archive/tar"
+	"bytes"
+	"github.com/mkrautz/goar"
 	"github.com/smira/aptly/utils"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+	"io"
 	. "launchpad.net/gocheck"
+	"os"
 	"path/filepath"
 	"runtime"
 )
@@ -34,6 +41,66 @@ func (s *DebSuite) TestGetControlFileFromDeb(c *C) {
 	c.Check(st["Package"], Equals, "libboost-program-options-dev")
 }
 
+func (s *DebSuite) TestGetContentsFromDeb(c *C) {
+	_, err := GetContentsFromDeb("/no/such/file")
+	c.Check(err, ErrorMatches, ".*no such file or directory")
+
+	_, _File, _, _ := runtime.Caller(0)
+	_, err = GetContentsFromDeb(_File)
+	c.Check(err, ErrorMatches, "unable to read .deb archive: ar: missing global header")
+
+	contents, err := GetContentsFromDeb(s.debFile)
+	c.Check(err, IsNil)
+	c.Check(contents, DeepEquals, []string{"usr/share/doc/libboost-program-options-dev/changelog.gz",
+		"usr/share/doc/libboost-program-options-dev/copyright"})
+}
+
+// makeDeb builds minimal .deb package with data.tar compressed by compressor
+func makeDeb(c *C, dataName string, compressor func(io.Writer) (io.WriteCloser, error)) string {
+	var data bytes.Buffer
+
+	compressed, err := compressor(&data)
+	c.Assert(err, IsNil)
+
+	untar := tar.NewWriter(compressed)
+	c.Assert(untar.WriteHeader(&tar.Header{Name: "./usr/", Typeflag: tar.TypeDir, Mode: 0755}), IsNil)
+	c.Assert(untar.WriteHeader(&tar.Header{Name: "./usr/bin/app", Typeflag: tar.TypeReg, Mode: 0755, Size: 4}), IsNil)
+	_, err = untar.Write([]byte("app\n"))
+	c.Assert(err, IsNil)
+	c.Assert(untar.Close(), IsNil)
+	c.Assert(compressed.Close(), IsNil)
+
+	path := filepath.Join(c.MkDir(), "app_1.0_amd64.deb")
+	file, err := os.Create(path)
+	c.Assert(err, IsNil)
+	defer file.Close()
+
+	library := ar.NewWriter(file)
+	c.Assert(library.WriteHeader(&ar.Header{Name: "debian-binary", Mode: 0644, Size: 4}), IsNil)
+	_, err = library.Write([]byte("2.0\n"))
+	c.Assert(err, IsNil)
+	c.Assert(library.WriteHeader(&ar.Header{Name: dataName, Mode: 0644, Size: int64(data.Len())}), IsNil)
+	_, err = library.Write(data.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(library.Close(), IsNil)
+
+	return path
+}
+
+func (s *DebSuite) TestGetContentsFromDebXz(c *C) {
+	debFile := makeDeb(c, "data.tar.xz", func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) })
+
+	contents, err := GetContentsFromDeb(debFile)
+	c.Check(err, IsNil)
+	c.Check(contents, DeepEquals, []string{"usr/bin/app"})
+
+	debFile = makeDeb(c, "data.tar.lzma", func(w io.Writer) (io.WriteCloser, error) { return lzma.NewWriter(w) })
+
+	contents, err = GetContentsFromDeb(debFile)
+	c.Check(err, IsNil)
+	c.Check(contents, DeepEquals, []string{"usr/bin/app"})
+}
+
 func (s *DebSuite) TestGetControlFileFromDsc(c *C) {
 	verifier := &utils.GpgVerifier{}
 
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"io"
+	"sort"
 	"strings"
 )
 
@@ -12,7 +13,8 @@ type Stanza map[string]string
 
 // Canonical order of fields in stanza
 var canocialOrder = []string{"Origin", "Label", "Suite", "Package", "Version", "Installed-Size", "Priority", "Section", "Maintainer",
-	"Architecture", "Codename", "Date", "Architectures", "Components", "Description", "MD5sum", "MD5Sum", "SHA1", "SHA256"}
+	"Architecture", "Codename", "Date", "Valid-Until", "NotAutomatic", "ButAutomaticUpgrades", "Acquire-By-Hash",
+	"Architectures", "Components", "Description", "MD5sum", "MD5Sum", "SHA1", "SHA256"}
 
 // Copy returns copy of Stanza
 func (s Stanza) Copy() (result Stanza) {
@@ -52,8 +54,16 @@ func (s Stanza) WriteTo(w *bufio.Writer) error {
 		}
 	}
 
-	for field, value := range s {
-		err := writeField(w, field, value)
+	// remaining fields go in alphabetical order, so that output is stable
+	fields := make([]string, 0, len(s))
+	for field := range s {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		err := writeField(w, field, s[field])
 		if err != nil {
 			return err
 		}
@@ -122,6 +122,19 @@ func (s *ControlFileSuite) TestReadWriteStanza(c *C) {
 	c.Assert(strings.HasPrefix(str, "Package: "), Equals, true)
 }
 
+func (s *ControlFileSuite) TestWriteStanzaStableOrder(c *C) {
+	stanza := Stanza{"Zeta": "1", "Package": "aptly", "Alpha": "2", "Homepage": "http://www.aptly.info", "Version": "0.5"}
+
+	buf := &bytes.Buffer{}
+	w := bufio.NewWriter(buf)
+	err := stanza.WriteTo(w)
+	c.Assert(err, IsNil)
+	err = w.Flush()
+	c.Assert(err, IsNil)
+
+	c.Check(buf.String(), Equals, "Package: aptly\nVersion: 0.5\nAlpha: 2\nHomepage: http://www.aptly.info\nZeta: 1\n")
+}
+
 func (s *ControlFileSuite) BenchmarkReadStanza(c *C) {
 	for i := 0; i < c.N; i++ {
 		reader := bytes.NewBufferString(controlFile)
@@ -5,7 +5,6 @@ import (
 	"github.com/smira/aptly/aptly"
 	"github.com/smira/aptly/utils"
 	"sort"
-	"strings"
 )
 
 // Dependency options
@@ -123,6 +122,25 @@ func (l *PackageList) ForEach(handler func(*Package) error) error {
 	return err
 }
 
+// ForEachSorted calls handler for each package in list in stable order (sorted by package key)
+func (l *PackageList) ForEachSorted(handler func(*Package) error) error {
+	keys := make([]string, 0, len(l.packages))
+	for key := range l.packages {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		err := handler(l.packages[key])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Len returns number of packages in the list
 func (l *PackageList) Len() int {
 	return len(l.packages)
@@ -352,7 +370,30 @@ func (l *PackageList) Search(dep Dependency) *Package {
 	return nil
 }
 
+// Scan returns packages from the list matching query, checking every package
+func (l *PackageList) Scan(q PackageQuery) *PackageList {
+	result := NewPackageList()
+	for _, p := range l.packages {
+		if q.Matches(p) {
+			result.Add(p)
+		}
+	}
+
+	return result
+}
+
+// Query returns packages from the list matching query, using index when possible
+func (l *PackageList) Query(q PackageQuery) *PackageList {
+	if l.indexed && q.Fast() {
+		return q.Query(l)
+	}
+
+	return l.Scan(q)
+}
+
 // Filter filters package index by specified queries (ORed together), possibly pulling dependencies
+//
+// Queries are parsed with ParseQuery
 func (l *PackageList) Filter(queries []string, withDependencies bool, source *PackageList, dependencyOptions int, architecturesList []string) (*PackageList, error) {
 	if !l.indexed {
 		panic("list not indexed, can't filter")
@@ -361,45 +402,16 @@ func (l *PackageList) Filter(queries []string, withDependencies bool, source *Pa
 	result := NewPackageList()
 
 	for _, query := range queries {
-		isDepQuery := strings.IndexAny(query, " (){}=<>") != -1
-
-		if !isDepQuery {
-			// try to interpret query as package string representation
-
-			// convert Package.String() to Package.Key()
-			i := strings.Index(query, "_")
-			if i != -1 {
-				pkg, query := query[:i], query[i+1:]
-				j := strings.LastIndex(query, "_")
-				if j != -1 {
-					version, arch := query[:j], query[j+1:]
-					p := l.packages["P"+arch+" "+pkg+" "+version]
-					if p != nil {
-						result.Add(p)
-						continue
-					}
-				}
-			}
-		}
-
-		// try as dependency
-		dep, err := ParseDependency(query)
+		q, err := ParseQuery(query)
 		if err != nil {
-			if isDepQuery {
-				return nil, err
-			}
-			// parsing failed, but probably that wasn't a dep query
-			continue
+			return nil, err
 		}
 
-		i := sort.Search(len(l.packagesIndex), func(j int) bool { return l.packagesIndex[j].Name >= dep.Pkg })
-
-		for i < len(l.packagesIndex) && l.packagesIndex[i].Name == dep.Pkg {
-			p := l.packagesIndex[i]
-			if p.MatchesDependency(dep) {
-				result.Add(p)
-			}
-			i++
+		err = l.Query(q).ForEach(func(p *Package) error {
+			return result.Add(p)
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -170,6 +170,30 @@ func (s *PackageListSuite) TestForeach(c *C) {
 
 }
 
+func (s *PackageListSuite) TestForEachSorted(c *C) {
+	s.list.Add(s.p3)
+	s.list.Add(s.p1)
+	s.list.Add(s.p2)
+
+	keys := []string{}
+	err := s.list.ForEachSorted(func(p *Package) error {
+		keys = append(keys, string(p.Key("")))
+		return nil
+	})
+
+	c.Check(err, IsNil)
+	c.Check(keys, HasLen, s.list.Len())
+	c.Check(sort.StringsAreSorted(keys), Equals, true)
+
+	e := errors.New("a")
+
+	err = s.list.ForEachSorted(func(*Package) error {
+		return e
+	})
+
+	c.Check(err, Equals, e)
+}
+
 func (s *PackageListSuite) TestIndex(c *C) {
 	c.Check(len(s.il.providesIndex), Equals, 2)
 	c.Check(len(s.il.providesIndex["mail-agent"]), Equals, 1)
@@ -224,7 +248,7 @@ func (s *PackageListSuite) TestFilter(c *C) {
 	c.Check(func() { s.list.Filter([]string{"abcd_0.3_i386"}, false, nil, 0, nil) }, Panics, "list not indexed, can't filter")
 
 	_, err := s.il.Filter([]string{"app >3)"}, false, nil, 0, nil)
-	c.Check(err, ErrorMatches, "unable to parse dependency.*")
+	c.Check(err, ErrorMatches, "unable to parse query.*")
 
 	plString := func(l *PackageList) string {
 		list := make([]string, 0, l.Len())
@@ -249,6 +273,10 @@ func (s *PackageListSuite) TestFilter(c *C) {
 	c.Check(err, IsNil)
 	c.Check(plString(result), Equals, "app_1.0_s390 app_1.1~bp1_amd64 app_1.1~bp1_arm app_1.1~bp1_i386 dpkg_1.7_i386 dpkg_1.7_source")
 
+	result, err = s.il.Filter([]string{"app (>>1.0), !app {i386}", "$Source (postfix) | dpkg_1.7_source"}, false, nil, 0, nil)
+	c.Check(err, IsNil)
+	c.Check(plString(result), Equals, "app_1.1~bp1_amd64 app_1.1~bp1_arm dpkg_1.7_source mailer_3.5.8_i386")
+
 	result, err = s.il.Filter([]string{"app {i386}"}, true, NewPackageList(), 0, []string{"i386"})
 	c.Check(err, IsNil)
 	c.Check(plString(result), Equals, "app_1.1~bp1_i386 data_1.1~bp1_all dpkg_1.7_i386 lib_1.0_i386 mailer_3.5.8_i386")
@@ -24,6 +24,8 @@ type Package struct {
 	Provides []string
 	// Is this source package
 	IsSource bool
+	// Is this udeb (debian-installer) package
+	IsUdeb bool `codec:",omitempty"`
 	// Hash of files section
 	FilesHash uint64
 	// Offload fields
@@ -81,6 +83,14 @@ func NewPackageFromControlFile(input Stanza) *Package {
 	return result
 }
 
+// NewUdebPackageFromControlFile creates .udeb Package from parsed Debian control file
+func NewUdebPackageFromControlFile(input Stanza) *Package {
+	result := NewPackageFromControlFile(input)
+	result.IsUdeb = true
+
+	return result
+}
+
 // NewSourcePackageFromControlFile creates Package from parsed Debian control file for source package
 func NewSourcePackageFromControlFile(input Stanza) (*Package, error) {
 	result := &Package{
@@ -166,7 +176,13 @@ func NewSourcePackageFromControlFile(input Stanza) (*Package, error) {
 }
 
 // Key returns unique key identifying package
+//
+// udebs get distinct keys, so that they don't collide with .debs
+// having the same name, version and architecture
 func (p *Package) Key(prefix string) []byte {
+	if p.IsUdeb {
+		return []byte(prefix + "P" + p.Architecture + " " + p.Name + " " + p.Version + " udeb")
+	}
 	return []byte(prefix + "P" + p.Architecture + " " + p.Name + " " + p.Version)
 }
 
@@ -175,6 +191,67 @@ func (p *Package) String() string {
 	return fmt.Sprintf("%s_%s_%s", p.Name, p.Version, p.Architecture)
 }
 
+// QualifiedName returns [$SECTION/]$NAME
+func (p *Package) QualifiedName() string {
+	section := p.Extra()["Section"]
+	if section != "" {
+		return section + "/" + p.Name
+	}
+
+	return p.Name
+}
+
+// GetField returns value of field by name, special fields are:
+// $Source, $SourceVersion, $Architecture, $Version and $PackageType
+func (p *Package) GetField(name string) string {
+	switch name {
+	case "$Source":
+		if p.IsSource {
+			return p.Name
+		}
+		if p.Source == "" {
+			return p.Name
+		}
+		if i := strings.Index(p.Source, "("); i != -1 {
+			return strings.TrimSpace(p.Source[:i])
+		}
+		return p.Source
+	case "$SourceVersion":
+		if i := strings.Index(p.Source, "("); !p.IsSource && i != -1 {
+			return strings.Trim(p.Source[i:], " ()")
+		}
+		return p.Version
+	case "$Architecture":
+		return p.Architecture
+	case "$Version", "Version":
+		return p.Version
+	case "$PackageType":
+		if p.IsSource {
+			return "source"
+		}
+		if p.IsUdeb {
+			return "udeb"
+		}
+		return "deb"
+	case "Package":
+		return p.Name
+	case "Architecture":
+		if p.IsSource {
+			return p.SourceArchitecture
+		}
+		return p.Architecture
+	case "Source":
+		return p.Source
+	case "Provides":
+		return strings.Join(p.Provides, ", ")
+	case "Depends", "Pre-Depends", "Suggests", "Recommends", "Build-Depends", "Build-Depends-Indep",
+		"Filename", "Size", "MD5sum", "SHA1", "SHA256", "Files", "Checksums-Sha1", "Checksums-Sha256":
+		return strings.TrimSpace(p.Stanza()[name])
+	}
+
+	return p.Extra()[name]
+}
+
 // MatchesArchitecture checks whether packages matches specified architecture
 func (p *Package) MatchesArchitecture(arch string) bool {
 	if p.Architecture == "all" && arch != "source" {
@@ -372,7 +449,7 @@ func (p *Package) Stanza() (result Stanza) {
 func (p *Package) Equals(p2 *Package) bool {
 	return p.Name == p2.Name && p.Version == p2.Version && p.SourceArchitecture == p2.SourceArchitecture &&
 		p.Architecture == p2.Architecture && p.Source == p2.Source && p.IsSource == p2.IsSource &&
-		p.FilesHash == p2.FilesHash
+		p.IsUdeb == p2.IsUdeb && p.FilesHash == p2.FilesHash
 }
 
 // LinkFromPool links package file from pool to dist's pool location
@@ -388,7 +465,7 @@ func (p *Package) LinkFromPool(publishedStorage aptly.PublishedStorage, packageP
 			return err
 		}
 
-		relPath, err := publishedStorage.LinkFromPool(prefix, component, poolDir, packagePool, sourcePath)
+		relPath, err := publishedStorage.LinkFromPool(prefix, component, poolDir, packagePool, sourcePath, f.Checksums)
 		if err != nil {
 			return err
 		}
@@ -404,6 +481,35 @@ func (p *Package) LinkFromPool(publishedStorage aptly.PublishedStorage, packageP
 	return nil
 }
 
+// Contents returns list of files installed by the package, it is read from
+// .deb file in the package pool once and then cached in the DB
+func (p *Package) Contents(packagePool aptly.PackagePool) ([]string, error) {
+	if p.IsSource {
+		return nil, nil
+	}
+
+	if p.collection == nil {
+		return p.readContents(packagePool)
+	}
+
+	return p.collection.loadContents(p, packagePool)
+}
+
+// readContents reads list of files from the package file in the pool
+func (p *Package) readContents(packagePool aptly.PackagePool) ([]string, error) {
+	files := p.Files()
+	if len(files) != 1 {
+		return nil, fmt.Errorf("unable to read contents of %s: expected exactly one file", p)
+	}
+
+	poolPath, err := packagePool.Path(files[0].Filename, files[0].Checksums.MD5)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetContentsFromDeb(poolPath)
+}
+
 // PoolDirectory returns directory in package pool of published repository for this package files
 func (p *Package) PoolDirectory() (string, error) {
 	source := p.Source
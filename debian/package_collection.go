@@ -3,6 +3,7 @@ package debian
 import (
 	"bytes"
 	"fmt"
+	"github.com/smira/aptly/aptly"
 	"github.com/smira/aptly/database"
 	"github.com/ugorji/go/codec"
 	"path/filepath"
@@ -154,6 +155,45 @@ func (collection *PackageCollection) loadFiles(p *Package) *PackageFiles {
 	return files
 }
 
+// loadContents loads list of files in the package, if it's missing in DB it's
+// read from the .deb file in the package pool and saved to DB
+func (collection *PackageCollection) loadContents(p *Package, packagePool aptly.PackagePool) ([]string, error) {
+	encoded, err := collection.db.Get(p.Key("xC"))
+	if err == nil {
+		contents := []string{}
+
+		decoder := codec.NewDecoderBytes(encoded, &codec.MsgpackHandle{})
+		err = decoder.Decode(&contents)
+		if err != nil {
+			panic("unable to decode contents")
+		}
+
+		return contents, nil
+	}
+
+	if err != database.ErrNotFound {
+		panic(fmt.Sprintf("unable to load contents: %s, %s", p, err))
+	}
+
+	contents, err := p.readContents(packagePool)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = codec.NewEncoder(&buf, &codec.MsgpackHandle{}).Encode(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	err = collection.db.Put(p.Key("xC"), buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return contents, nil
+}
+
 // Update adds or updates information about package in DB checking for conficts first
 func (collection *PackageCollection) Update(p *Package) error {
 	existing, err := collection.ByKey(p.Key(""))
@@ -246,7 +286,7 @@ func (collection *PackageCollection) AllPackageRefs() *PackageRefList {
 
 // DeleteByKey deletes package in DB by key
 func (collection *PackageCollection) DeleteByKey(key []byte) error {
-	for _, key := range [][]byte{key, append([]byte("xF"), key...), append([]byte("xD"), key...), append([]byte("xE"), key...)} {
+	for _, key := range [][]byte{key, append([]byte("xF"), key...), append([]byte("xD"), key...), append([]byte("xE"), key...), append([]byte("xC"), key...)} {
 		err := collection.db.Delete(key)
 		if err != nil {
 			return err
@@ -2,8 +2,12 @@ package debian
 
 import (
 	"github.com/smira/aptly/database"
+	"github.com/smira/aptly/files"
 	"github.com/smira/aptly/utils"
 	. "launchpad.net/gocheck"
+	"os"
+	"path/filepath"
+	"runtime"
 )
 
 type PackageCollectionSuite struct {
@@ -110,6 +114,40 @@ func (s *PackageCollectionSuite) TestAllPackageRefs(c *C) {
 	c.Check(refs.Refs[0], DeepEquals, s.p.Key(""))
 }
 
+func (s *PackageCollectionSuite) TestContents(c *C) {
+	_, _File, _, _ := runtime.Caller(0)
+	debFile := filepath.Join(filepath.Dir(_File), "../system/files/libboost-program-options-dev_1.49.0.1_i386.deb")
+
+	checksums, err := utils.ChecksumsForFile(debFile)
+	c.Assert(err, IsNil)
+
+	packagePool := files.NewPackagePool(c.MkDir())
+	c.Assert(packagePool.Import(debFile, checksums.MD5), IsNil)
+
+	s.p.UpdateFiles(PackageFiles{PackageFile{Filename: filepath.Base(debFile), Checksums: checksums}})
+	c.Assert(s.collection.Update(s.p), IsNil)
+
+	expected := []string{"usr/share/doc/libboost-program-options-dev/changelog.gz",
+		"usr/share/doc/libboost-program-options-dev/copyright"}
+
+	contents, err := s.p.Contents(packagePool)
+	c.Assert(err, IsNil)
+	c.Check(contents, DeepEquals, expected)
+
+	_, err = s.db.Get(s.p.Key("xC"))
+	c.Check(err, IsNil)
+
+	// second time contents should come from DB, not from the pool
+	poolPath, _ := packagePool.Path(filepath.Base(debFile), checksums.MD5)
+	c.Assert(os.Remove(poolPath), IsNil)
+
+	p, err := s.collection.ByKey(s.p.Key(""))
+	c.Assert(err, IsNil)
+	contents, err = p.Contents(packagePool)
+	c.Assert(err, IsNil)
+	c.Check(contents, DeepEquals, expected)
+}
+
 func (s *PackageCollectionSuite) TestDeleteByKey(c *C) {
 	err := s.collection.Update(s.p)
 	c.Assert(err, IsNil)
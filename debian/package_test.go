@@ -89,6 +89,10 @@ func (s *PackageSuite) TestKey(c *C) {
 
 	c.Check(p.Key(""), DeepEquals, []byte("Pi386 alien-arena-common 7.40-2"))
 	c.Check(p.Key("xD"), DeepEquals, []byte("xDPi386 alien-arena-common 7.40-2"))
+
+	p = NewUdebPackageFromControlFile(packageStanza.Copy())
+	c.Check(p.IsUdeb, Equals, true)
+	c.Check(p.Key(""), DeepEquals, []byte("Pi386 alien-arena-common 7.40-2 udeb"))
 }
 
 func (s *PackageSuite) TestStanza(c *C) {
@@ -108,6 +112,16 @@ func (s *PackageSuite) TestString(c *C) {
 	c.Assert(p.String(), Equals, "alien-arena-common_7.40-2_i386")
 }
 
+func (s *PackageSuite) TestQualifiedName(c *C) {
+	p := NewPackageFromControlFile(s.stanza.Copy())
+	c.Check(p.QualifiedName(), Equals, "contrib/games/alien-arena-common")
+
+	stanza := s.stanza.Copy()
+	delete(stanza, "Section")
+	p = NewPackageFromControlFile(stanza)
+	c.Check(p.QualifiedName(), Equals, "alien-arena-common")
+}
+
 func (s *PackageSuite) TestEquals(c *C) {
 	p := NewPackageFromControlFile(s.stanza)
 
@@ -123,6 +137,9 @@ func (s *PackageSuite) TestEquals(c *C) {
 	p2.UpdateFiles(files)
 	c.Check(p.Equals(p2), Equals, false)
 
+	p2 = NewUdebPackageFromControlFile(packageStanza.Copy())
+	c.Check(p.Equals(p2), Equals, false)
+
 	so, _ := NewSourcePackageFromControlFile(s.sourceStanza.Copy())
 	so2, _ := NewSourcePackageFromControlFile(s.sourceStanza.Copy())
 
@@ -0,0 +1,472 @@
+package debian
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/smira/aptly/aptly"
+	"github.com/smira/aptly/http"
+	"github.com/smira/aptly/utils"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PDiffs (Packages.diff/Index) allow to update previously fetched index file
+// by applying series of ed-style patches instead of downloading it again
+
+// pdiffEntry is single line from Index: hash, size and patch name
+type pdiffEntry struct {
+	hash string
+	size int64
+	name string
+}
+
+// pdiffIndex is parsed Packages.diff/Index file
+type pdiffIndex struct {
+	// current is hash & size of latest index file
+	current pdiffEntry
+	// history is list of previous versions of index, each with name of patch to
+	// apply to that version, oldest first
+	history []pdiffEntry
+	// patches are hashes of uncompressed patches
+	patches map[string]pdiffEntry
+	// merged patches bring any historical version straight to current one
+	merged bool
+	// useSHA256 is true if hashes are SHA256, otherwise SHA1
+	useSHA256 bool
+}
+
+func init() {
+	for _, hash := range []string{"SHA1", "SHA256"} {
+		for _, field := range []string{"History", "Patches", "Download"} {
+			multilineFields[hash+"-"+field] = true
+		}
+	}
+}
+
+// parsePDiffIndex parses Packages.diff/Index file
+func parsePDiffIndex(r io.Reader) (*pdiffIndex, error) {
+	stanza, err := NewControlFileReader(r).ReadStanza()
+	if err != nil {
+		return nil, err
+	}
+	if stanza == nil {
+		return nil, fmt.Errorf("empty pdiff index")
+	}
+
+	index := &pdiffIndex{patches: make(map[string]pdiffEntry), merged: stanza["X-Patch-Precedence"] == "merged"}
+
+	prefix := "SHA1"
+	if stanza["SHA256-Current"] != "" {
+		prefix, index.useSHA256 = "SHA256", true
+	}
+
+	current := strings.Fields(stanza[prefix+"-Current"])
+	if len(current) != 2 {
+		return nil, fmt.Errorf("malformed %s-Current in pdiff index", prefix)
+	}
+	index.current.hash = current[0]
+	index.current.size, err = strconv.ParseInt(current[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed %s-Current in pdiff index: %s", prefix, err)
+	}
+
+	parseEntries := func(field string) ([]pdiffEntry, error) {
+		result := []pdiffEntry{}
+		for _, line := range strings.Split(stanza[field], "\n") {
+			parts := strings.Fields(line)
+			if len(parts) == 0 {
+				continue
+			}
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("malformed %s line in pdiff index: %#v", field, line)
+			}
+
+			size, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed %s line in pdiff index: %s", field, err)
+			}
+
+			result = append(result, pdiffEntry{hash: parts[0], size: size, name: parts[2]})
+		}
+		return result, nil
+	}
+
+	index.history, err = parseEntries(prefix + "-History")
+	if err != nil {
+		return nil, err
+	}
+
+	patches, err := parseEntries(prefix + "-Patches")
+	if err != nil {
+		return nil, err
+	}
+	for _, patch := range patches {
+		index.patches[patch.name] = patch
+	}
+
+	return index, nil
+}
+
+// patchesFor returns names of patches to apply to index file with given hash,
+// empty list means file is up to date
+func (index *pdiffIndex) patchesFor(hash string) ([]string, error) {
+	if hash == index.current.hash {
+		return []string{}, nil
+	}
+
+	for i, entry := range index.history {
+		if entry.hash == hash {
+			if index.merged {
+				return []string{entry.name}, nil
+			}
+
+			result := []string{}
+			for _, later := range index.history[i:] {
+				result = append(result, later.name)
+			}
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("local index file is too old or unknown to pdiff history")
+}
+
+// edCommand is single command of ed script: append, change or delete;
+// it replaces lines start..end (1-based, inclusive) of original file with text
+type edCommand struct {
+	start, end int
+	text       []string
+}
+
+// readLine reads single line without trailing newline, lines could be of any length
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		// last line without newline
+		err = nil
+	}
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+// parseEdScript parses ed script as produced by diff --ed
+func parseEdScript(r io.Reader) ([]edCommand, error) {
+	result := []edCommand{}
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := readLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			continue
+		}
+		if line == "w" || line == "q" {
+			break
+		}
+
+		op := line[len(line)-1]
+		addresses := strings.SplitN(line[:len(line)-1], ",", 2)
+
+		start, err := strconv.Atoi(addresses[0])
+		if err != nil {
+			return nil, fmt.Errorf("unsupported ed command: %#v", line)
+		}
+		end := start
+		if len(addresses) == 2 {
+			end, err = strconv.Atoi(addresses[1])
+			if err != nil {
+				return nil, fmt.Errorf("unsupported ed command: %#v", line)
+			}
+		}
+
+		var command edCommand
+
+		switch op {
+		case 'a':
+			if len(addresses) != 1 || start < 0 {
+				return nil, fmt.Errorf("invalid range in ed command: %#v", line)
+			}
+			// append after line start: empty range of original lines
+			command = edCommand{start: start + 1, end: start}
+		case 'c', 'd':
+			if start < 1 || end < start {
+				return nil, fmt.Errorf("invalid range in ed command: %#v", line)
+			}
+			command = edCommand{start: start, end: end}
+		default:
+			return nil, fmt.Errorf("unsupported ed command: %#v", line)
+		}
+
+		if op != 'd' {
+			terminated := false
+			for {
+				text, err := readLine(reader)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				if text == "." {
+					terminated = true
+					break
+				}
+				command.text = append(command.text, text)
+			}
+			if !terminated {
+				return nil, fmt.Errorf("unterminated text in ed command: %#v", line)
+			}
+		}
+
+		result = append(result, command)
+	}
+
+	return result, nil
+}
+
+// applyEdScript applies commands to original file read from r, writing result to w;
+// commands should go in descending order of line numbers (as diff --ed generates them),
+// so all of them refer to line numbers of original file, which is processed line by line
+func applyEdScript(r *bufio.Reader, w io.Writer, commands []edCommand) error {
+	for i := 1; i < len(commands); i++ {
+		if commands[i].end >= commands[i-1].start {
+			return fmt.Errorf("ed commands are not in descending order")
+		}
+	}
+
+	output := bufio.NewWriter(w)
+	consumed := 0
+
+	// copyLines copies (or skips) original lines up to line number upTo
+	copyLines := func(upTo int, skip bool) error {
+		for ; consumed < upTo; consumed++ {
+			line, err := r.ReadString('\n')
+			if err == io.EOF && line == "" {
+				return io.ErrUnexpectedEOF
+			}
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if !skip {
+				_, err = output.WriteString(line)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for i := len(commands) - 1; i >= 0; i-- {
+		command := commands[i]
+
+		err := copyLines(command.start-1, false)
+		if err == nil {
+			err = copyLines(command.end, true)
+		}
+		if err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("ed command refers to line %d beyond end of file", command.end)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, text := range command.text {
+			_, err = output.WriteString(text + "\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := io.Copy(output, r)
+	if err != nil {
+		return err
+	}
+
+	return output.Flush()
+}
+
+// checksumsMatch verifies actual checksums against the ones from Release file
+func checksumsMatch(actual, expected utils.ChecksumInfo) bool {
+	if expected.SHA256 == "" && expected.SHA1 == "" && expected.MD5 == "" {
+		return false
+	}
+
+	return actual.Size == expected.Size &&
+		(expected.SHA256 == "" || expected.SHA256 == actual.SHA256) &&
+		(expected.SHA1 == "" || expected.SHA1 == actual.SHA1) &&
+		(expected.MD5 == "" || expected.MD5 == actual.MD5)
+}
+
+// indexCachePath returns location of last fetched raw index file for the mirror
+func (repo *RemoteRepo) indexCachePath(indexDir string, releasePath string) string {
+	return filepath.Join(indexDir, repo.UUID, filepath.FromSlash(releasePath))
+}
+
+// DropIndexCache removes index files kept for pdiff updates
+func (repo *RemoteRepo) DropIndexCache(indexDir string) error {
+	return os.RemoveAll(filepath.Join(indexDir, repo.UUID))
+}
+
+// updateIndexWithPDiff brings cached index file up to date by applying pdiffs, result
+// is verified against checksum from Release file
+func (repo *RemoteRepo) updateIndexWithPDiff(progress aptly.Progress, d aptly.Downloader, url string,
+	releasePath string, cachePath string) (*os.File, error) {
+	expected, ok := repo.ReleaseFiles[releasePath]
+	if !ok {
+		return nil, fmt.Errorf("%s is not listed in Release file", releasePath)
+	}
+
+	indexChecksum, ok := repo.ReleaseFiles[releasePath+".diff/Index"]
+	if !ok {
+		return nil, fmt.Errorf("no pdiffs available")
+	}
+
+	cachedChecksum, err := utils.ChecksumsForFile(cachePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if checksumsMatch(cachedChecksum, expected) {
+		// index hasn't changed since last update
+		return os.Open(cachePath)
+	}
+
+	indexFile, err := http.DownloadTempWithChecksum(d, url+".diff/Index", indexChecksum, false)
+	if err != nil {
+		return nil, err
+	}
+	defer indexFile.Close()
+
+	index, err := parsePDiffIndex(indexFile)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := cachedChecksum.SHA1
+	if index.useSHA256 {
+		hash = cachedChecksum.SHA256
+	}
+
+	patches, err := index.patchesFor(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	progress.Printf("Applying %d pdiff patches to %s...\n", len(patches), releasePath)
+
+	// every patch is applied to result of previous one, starting with cached index
+	tempPath := cachePath + ".new"
+	source := cachePath
+
+	for _, name := range patches {
+		err = repo.applyPDiff(d, url, index, name, source, tempPath+".part")
+		if err != nil {
+			os.Remove(tempPath + ".part")
+			os.Remove(tempPath)
+			return nil, err
+		}
+
+		err = os.Rename(tempPath+".part", tempPath)
+		if err != nil {
+			os.Remove(tempPath + ".part")
+			os.Remove(tempPath)
+			return nil, err
+		}
+		source = tempPath
+	}
+
+	if source == cachePath {
+		return nil, fmt.Errorf("patched %s doesn't match checksum from Release file", releasePath)
+	}
+
+	actual, err := utils.ChecksumsForFile(tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	if !checksumsMatch(actual, expected) {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("patched %s doesn't match checksum from Release file", releasePath)
+	}
+
+	err = os.Rename(tempPath, cachePath)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	return os.Open(cachePath)
+}
+
+// applyPDiff downloads single patch, verifies and applies it to source file, writing result to destination
+func (repo *RemoteRepo) applyPDiff(d aptly.Downloader, url string, index *pdiffIndex, name string, source, destination string) error {
+	patchInfo, ok := index.patches[name]
+	if !ok {
+		return fmt.Errorf("patch %s is not listed in pdiff index", name)
+	}
+
+	patchFile, err := http.DownloadTemp(d, url+".diff/"+name+".gz")
+	if err != nil {
+		return err
+	}
+	defer patchFile.Close()
+
+	uncompressed, err := gzip.NewReader(patchFile)
+	if err != nil {
+		return fmt.Errorf("unable to decompress patch %s: %s", name, err)
+	}
+
+	patch, err := ioutil.ReadAll(uncompressed)
+	if err != nil {
+		return fmt.Errorf("unable to decompress patch %s: %s", name, err)
+	}
+
+	checksummer := utils.NewChecksumWriter()
+	checksummer.Write(patch)
+	actual := checksummer.Sum()
+
+	hash := actual.SHA1
+	if index.useSHA256 {
+		hash = actual.SHA256
+	}
+	if actual.Size != patchInfo.size || hash != patchInfo.hash {
+		return fmt.Errorf("checksum mismatch for patch %s", name)
+	}
+
+	commands, err := parseEdScript(bytes.NewReader(patch))
+	if err != nil {
+		return fmt.Errorf("unable to parse patch %s: %s", name, err)
+	}
+
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+
+	err = applyEdScript(bufio.NewReader(input), output, commands)
+	if err != nil {
+		output.Close()
+		return fmt.Errorf("unable to apply patch %s: %s", name, err)
+	}
+
+	return output.Close()
+}
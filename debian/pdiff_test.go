@@ -0,0 +1,279 @@
+package debian
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/smira/aptly/aptly"
+	"github.com/smira/aptly/console"
+	"github.com/smira/aptly/database"
+	"github.com/smira/aptly/files"
+	"github.com/smira/aptly/http"
+	"github.com/smira/aptly/utils"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type PDiffSuite struct {
+	repo       *RemoteRepo
+	downloader *http.FakeDownloader
+	progress   aptly.Progress
+	indexDir   string
+	cachePath  string
+}
+
+var _ = Suite(&PDiffSuite{})
+
+const (
+	pdiffOriginal = "Package: a\nVersion: 1\n\nPackage: b\nVersion: 1\n\nPackage: c\nVersion: 1\n"
+	pdiffMiddle   = "Package: a\nVersion: 1\n\nPackage: b\nVersion: 2\n\nPackage: c\nVersion: 1\n"
+	pdiffCurrent  = "Package: a\nVersion: 1\n\nPackage: b\nVersion: 2\n\nPackage: d\nVersion: 1\n"
+
+	// patches as produced by diff --ed
+	pdiffPatch1 = "5c\nVersion: 2\n.\n"
+	pdiffPatch2 = "7,8c\nPackage: d\nVersion: 1\n.\n"
+
+	pdiffURL = "http://mirror.yandex.ru/debian/dists/squeeze/main/binary-i386/Packages"
+)
+
+func checksumOf(content string) utils.ChecksumInfo {
+	w := utils.NewChecksumWriter()
+	w.Write([]byte(content))
+	return w.Sum()
+}
+
+func gzipped(content string) string {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	w.Write([]byte(content))
+	w.Close()
+	return buf.String()
+}
+
+func pdiffIndexFile(merged bool) string {
+	original, middle, current := checksumOf(pdiffOriginal), checksumOf(pdiffMiddle), checksumOf(pdiffCurrent)
+	patch1, patch2 := checksumOf(pdiffPatch1), checksumOf(pdiffPatch2)
+
+	index := fmt.Sprintf("SHA256-Current: %s %d\n", current.SHA256, current.Size) +
+		"SHA256-History:\n" +
+		fmt.Sprintf(" %s %d 2014-03-01-0800.00\n", original.SHA256, original.Size) +
+		fmt.Sprintf(" %s %d 2014-03-01-1400.00\n", middle.SHA256, middle.Size) +
+		"SHA256-Patches:\n" +
+		fmt.Sprintf(" %s %d 2014-03-01-0800.00\n", patch1.SHA256, patch1.Size) +
+		fmt.Sprintf(" %s %d 2014-03-01-1400.00\n", patch2.SHA256, patch2.Size)
+	if merged {
+		index += "X-Patch-Precedence: merged\n"
+	}
+	return index
+}
+
+func (s *PDiffSuite) SetUpTest(c *C) {
+	s.repo, _ = NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian", "squeeze", []string{"main"}, []string{"i386"}, false, false)
+	s.repo.ReleaseFiles = map[string]utils.ChecksumInfo{
+		"main/binary-i386/Packages":            checksumOf(pdiffCurrent),
+		"main/binary-i386/Packages.diff/Index": checksumOf(pdiffIndexFile(false)),
+	}
+	s.downloader = http.NewFakeDownloader()
+	s.progress = console.NewProgress()
+	s.progress.Start()
+
+	s.indexDir = c.MkDir()
+	s.cachePath = s.repo.indexCachePath(s.indexDir, "main/binary-i386/Packages")
+	os.MkdirAll(filepath.Dir(s.cachePath), 0755)
+	ioutil.WriteFile(s.cachePath, []byte(pdiffOriginal), 0644)
+}
+
+func (s *PDiffSuite) TearDownTest(c *C) {
+	s.progress.Shutdown()
+}
+
+func (s *PDiffSuite) TestParseIndex(c *C) {
+	index, err := parsePDiffIndex(strings.NewReader(pdiffIndexFile(false)))
+	c.Assert(err, IsNil)
+	c.Check(index.useSHA256, Equals, true)
+	c.Check(index.merged, Equals, false)
+	c.Check(index.current, Equals, pdiffEntry{hash: checksumOf(pdiffCurrent).SHA256, size: int64(len(pdiffCurrent))})
+	c.Check(index.history, HasLen, 2)
+	c.Check(index.history[1].name, Equals, "2014-03-01-1400.00")
+	c.Check(index.patches["2014-03-01-0800.00"].size, Equals, int64(len(pdiffPatch1)))
+
+	index, err = parsePDiffIndex(strings.NewReader("SHA1-Current: abcd 10\nSHA1-History:\n 1234 5 p1\n"))
+	c.Assert(err, IsNil)
+	c.Check(index.useSHA256, Equals, false)
+	c.Check(index.history, DeepEquals, []pdiffEntry{{hash: "1234", size: 5, name: "p1"}})
+
+	_, err = parsePDiffIndex(strings.NewReader("SHA1-Current: abcd\n"))
+	c.Check(err, ErrorMatches, "malformed SHA1-Current in pdiff index")
+
+	_, err = parsePDiffIndex(strings.NewReader("SHA1-Current: abcd 10\nSHA1-History:\n 1234 p1\n"))
+	c.Check(err, ErrorMatches, "malformed SHA1-History line in pdiff index.*")
+}
+
+func (s *PDiffSuite) TestPatchesFor(c *C) {
+	index, _ := parsePDiffIndex(strings.NewReader(pdiffIndexFile(false)))
+
+	patches, err := index.patchesFor(checksumOf(pdiffOriginal).SHA256)
+	c.Assert(err, IsNil)
+	c.Check(patches, DeepEquals, []string{"2014-03-01-0800.00", "2014-03-01-1400.00"})
+
+	patches, err = index.patchesFor(checksumOf(pdiffMiddle).SHA256)
+	c.Assert(err, IsNil)
+	c.Check(patches, DeepEquals, []string{"2014-03-01-1400.00"})
+
+	patches, err = index.patchesFor(checksumOf(pdiffCurrent).SHA256)
+	c.Assert(err, IsNil)
+	c.Check(patches, HasLen, 0)
+
+	_, err = index.patchesFor("deadbeef")
+	c.Check(err, ErrorMatches, "local index file is too old.*")
+
+	index, _ = parsePDiffIndex(strings.NewReader(pdiffIndexFile(true)))
+	patches, _ = index.patchesFor(checksumOf(pdiffOriginal).SHA256)
+	c.Check(patches, DeepEquals, []string{"2014-03-01-0800.00"})
+}
+
+func (s *PDiffSuite) TestEdScript(c *C) {
+	original := "a\nb\nc\nd\ne\nf\n"
+
+	apply := func(script string) (string, error) {
+		commands, err := parseEdScript(strings.NewReader(script))
+		c.Assert(err, IsNil)
+
+		var result bytes.Buffer
+		err = applyEdScript(bufio.NewReader(strings.NewReader(original)), &result, commands)
+		return result.String(), err
+	}
+
+	commands, err := parseEdScript(strings.NewReader("5c\nE\n.\n3d\n1a\nx\ny\n.\n0a\nstart\n.\nw\n"))
+	c.Assert(err, IsNil)
+	c.Check(commands, HasLen, 4)
+
+	result, err := apply("5c\nE\n.\n3d\n1a\nx\ny\n.\n0a\nstart\n.\nw\n")
+	c.Assert(err, IsNil)
+	c.Check(result, Equals, "start\na\nx\ny\nb\nd\nE\nf\n")
+
+	result, err = apply("6a\ng\n.\n1,2d\n")
+	c.Assert(err, IsNil)
+	c.Check(result, Equals, "c\nd\ne\nf\ng\n")
+
+	_, err = apply("1d\n3d\n")
+	c.Check(err, ErrorMatches, "ed commands are not in descending order")
+
+	_, err = apply("8d\n")
+	c.Check(err, ErrorMatches, "ed command refers to line 8 beyond end of file")
+
+	_, err = apply("7,8c\nz\n.\n")
+	c.Check(err, ErrorMatches, "ed command refers to line 8 beyond end of file")
+
+	// lines of any length are supported
+	long := strings.Repeat("x", 200000)
+	commands, err = parseEdScript(strings.NewReader("2c\n" + long + "\n.\n"))
+	c.Assert(err, IsNil)
+	var output bytes.Buffer
+	c.Assert(applyEdScript(bufio.NewReader(strings.NewReader(long+"\nb\n")), &output, commands), IsNil)
+	c.Check(output.String(), Equals, long+"\n"+long+"\n")
+
+	_, err = parseEdScript(strings.NewReader("3c\nabc\n"))
+	c.Check(err, ErrorMatches, "unterminated text in ed command: \"3c\"")
+
+	_, err = parseEdScript(strings.NewReader("s/.//\n"))
+	c.Check(err, ErrorMatches, "unsupported ed command: \"s/.//\"")
+
+	_, err = parseEdScript(strings.NewReader("3,2d\n"))
+	c.Check(err, ErrorMatches, "invalid range in ed command: \"3,2d\"")
+}
+
+func (s *PDiffSuite) TestUpdateIndex(c *C) {
+	s.downloader.ExpectResponse(pdiffURL+".diff/Index", pdiffIndexFile(false))
+	s.downloader.ExpectResponse(pdiffURL+".diff/2014-03-01-0800.00.gz", gzipped(pdiffPatch1))
+	s.downloader.ExpectResponse(pdiffURL+".diff/2014-03-01-1400.00.gz", gzipped(pdiffPatch2))
+
+	f, err := s.repo.updateIndexWithPDiff(s.progress, s.downloader, pdiffURL, "main/binary-i386/Packages", s.cachePath)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	c.Check(s.downloader.Empty(), Equals, true)
+
+	content, _ := ioutil.ReadAll(f)
+	c.Check(string(content), Equals, pdiffCurrent)
+
+	content, _ = ioutil.ReadFile(s.cachePath)
+	c.Check(string(content), Equals, pdiffCurrent)
+
+	// up to date, nothing is downloaded
+	f, err = s.repo.updateIndexWithPDiff(s.progress, s.downloader, pdiffURL, "main/binary-i386/Packages", s.cachePath)
+	c.Assert(err, IsNil)
+	f.Close()
+}
+
+func (s *PDiffSuite) TestUpdateIndexFailures(c *C) {
+	update := func() error {
+		f, err := s.repo.updateIndexWithPDiff(s.progress, s.downloader, pdiffURL, "main/binary-i386/Packages", s.cachePath)
+		if err == nil {
+			f.Close()
+		}
+		return err
+	}
+
+	// broken patch
+	s.downloader.ExpectResponse(pdiffURL+".diff/Index", pdiffIndexFile(false))
+	s.downloader.ExpectResponse(pdiffURL+".diff/2014-03-01-0800.00.gz", gzipped("5c\nVersion: 3\n.\n"))
+	c.Check(update(), ErrorMatches, "checksum mismatch for patch 2014-03-01-0800.00")
+
+	// missing patch
+	s.downloader.ExpectResponse(pdiffURL+".diff/Index", pdiffIndexFile(false))
+	s.downloader.ExpectError(pdiffURL+".diff/2014-03-01-0800.00.gz", errors.New("HTTP 404"))
+	c.Check(update(), ErrorMatches, "HTTP 404")
+
+	// result doesn't match Release file
+	s.repo.ReleaseFiles["main/binary-i386/Packages"] = checksumOf(pdiffCurrent + "\n")
+	s.downloader.ExpectResponse(pdiffURL+".diff/Index", pdiffIndexFile(false))
+	s.downloader.ExpectResponse(pdiffURL+".diff/2014-03-01-0800.00.gz", gzipped(pdiffPatch1))
+	s.downloader.ExpectResponse(pdiffURL+".diff/2014-03-01-1400.00.gz", gzipped(pdiffPatch2))
+	c.Check(update(), ErrorMatches, "patched main/binary-i386/Packages doesn't match checksum from Release file")
+
+	// cached file is kept intact
+	content, _ := ioutil.ReadFile(s.cachePath)
+	c.Check(string(content), Equals, pdiffOriginal)
+
+	// no pdiffs in Release file
+	delete(s.repo.ReleaseFiles, "main/binary-i386/Packages.diff/Index")
+	c.Check(update(), ErrorMatches, "no pdiffs available")
+	c.Check(s.downloader.Empty(), Equals, true)
+}
+
+func (s *PDiffSuite) TestDownloadFallback(c *C) {
+	db, _ := database.OpenDB(c.MkDir())
+	defer db.Close()
+
+	packageCollection := NewPackageCollection(db)
+	packagePool := files.NewPackagePool(c.MkDir())
+
+	s.repo.ReleaseFiles["main/binary-i386/Packages"] = checksumOf(examplePackagesFile)
+
+	// pdiff update fails, full index is downloaded and saved
+	s.downloader.ExpectResponse(pdiffURL+".diff/Index", pdiffIndexFile(false))
+	s.downloader.ExpectError(pdiffURL+".diff/2014-03-01-0800.00.gz", errors.New("HTTP 404"))
+	s.downloader.ExpectResponse(pdiffURL, examplePackagesFile)
+	s.downloader.ExpectResponse("http://mirror.yandex.ru/debian/pool/main/a/amanda/amanda-client_3.3.1-3~bpo60+1_amd64.deb", "xyz")
+
+	err := s.repo.Download(s.progress, s.downloader, packageCollection, packagePool, s.indexDir, 0, false)
+	c.Assert(err, IsNil)
+	c.Check(s.downloader.Empty(), Equals, true)
+
+	content, _ := ioutil.ReadFile(s.cachePath)
+	c.Check(string(content), Equals, examplePackagesFile)
+
+	// next time index is up to date, package is already in the pool
+	err = s.repo.Download(s.progress, s.downloader, packageCollection, packagePool, s.indexDir, 0, false)
+	c.Assert(err, IsNil)
+	c.Check(s.downloader.Empty(), Equals, true)
+
+	c.Assert(s.repo.DropIndexCache(s.indexDir), IsNil)
+	_, err = os.Stat(s.cachePath)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
@@ -4,12 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"code.google.com/p/go-uuid/uuid"
+	"compress/gzip"
 	"fmt"
 	"github.com/smira/aptly/aptly"
 	"github.com/smira/aptly/database"
 	"github.com/smira/aptly/utils"
 	"github.com/ugorji/go/codec"
 	"log"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -20,49 +22,208 @@ import (
 type PublishedRepo struct {
 	// Internal unique ID
 	UUID string
-	// Prefix & distribution should be unique across all published repositories
+	// Storage & Prefix & distribution should be unique across all published repositories
+	Storage      string `codec:",omitempty"`
 	Prefix       string
 	Distribution string
-	Component    string
 	// Architectures is a list of all architectures published
 	Architectures []string
-	// SourceKind is "local"/"repo"
+	// SourceKind is "local"/"snapshot"
 	SourceKind string
-	// SourceUUID is UUID of either snapshot or local repo
-	SourceUUID string `codec:"SnapshotUUID"`
+	// Map of sources by each component: component name -> source UUID
+	Sources map[string]string
+	// Compression formats for indexes, if empty, global configuration is used
+	Compression []string `codec:",omitempty"`
+	// Release file fields, if empty, defaults are used (Origin & Label) or field is omitted
+	Origin               string `codec:",omitempty"`
+	Label                string `codec:",omitempty"`
+	Suite                string `codec:",omitempty"`
+	Version              string `codec:",omitempty"`
+	NotAutomatic         bool   `codec:",omitempty"`
+	ButAutomaticUpgrades bool   `codec:",omitempty"`
+	// ValidFor is validity period of Release file, used to generate Valid-Until, zero means no Valid-Until
+	ValidFor time.Duration `codec:",omitempty"`
+	// ReleaseDate pins Date field of Release file, it is not persisted,
+	// if zero, SOURCE_DATE_EPOCH or current time is used
+	ReleaseDate time.Time `codec:"-"`
+	// SigningKeys is a list of GPG keys used to sign Release file, if empty, default key is used
+	SigningKeys []string `codec:",omitempty"`
+	// AcquireByHash enables storing indexes under by-hash/SHA256/<digest>
+	AcquireByHash bool `codec:",omitempty"`
+	// ByHashHistory lists by-hash files (relative to dists/<distribution>/)
+	// generated by recent publishes, oldest first
+	ByHashHistory [][]string `codec:",omitempty"`
+
+	// Legacy fields for compatibility with old published repositories (< 0.5),
+	// which were publishing single component only
+	Component  string `codec:",omitempty"`
+	SourceUUID string `codec:"SnapshotUUID,omitempty"`
+
+	// Map of component to source items
+	sourceItems map[string]repoSourceItem
+}
 
-	snapshot  *Snapshot
+// repoSourceItem is a loaded source of single component
+type repoSourceItem struct {
+	// Pointer to snapshot if SourceKind == "snapshot"
+	snapshot *Snapshot
+	// Pointer to local repo if SourceKind == "local"
 	localRepo *LocalRepo
 }
 
+// walkUpTree goes from source in the tree of source snapshots/mirrors/local repos
+// gathering information about declared components and distributions
+func walkUpTree(source interface{}, collectionFactory *CollectionFactory) (rootDistributions []string, rootComponents []string) {
+	var (
+		head    interface{}
+		current = []interface{}{source}
+	)
+
+	rootComponents = []string{}
+	rootDistributions = []string{}
+
+	// walk up the tree from current source up to roots (local or remote repos)
+	// and collect information about distribution and components
+	for len(current) > 0 {
+		head, current = current[0], current[1:]
+
+		if snapshot, ok := head.(*Snapshot); ok {
+			for _, uuid := range snapshot.SourceIDs {
+				if snapshot.SourceKind == "repo" {
+					remoteRepo, err := collectionFactory.RemoteRepoCollection().ByUUID(uuid)
+					if err != nil {
+						continue
+					}
+					current = append(current, remoteRepo)
+				} else if snapshot.SourceKind == "local" {
+					localRepo, err := collectionFactory.LocalRepoCollection().ByUUID(uuid)
+					if err != nil {
+						continue
+					}
+					current = append(current, localRepo)
+				} else if snapshot.SourceKind == "snapshot" {
+					snap, err := collectionFactory.SnapshotCollection().ByUUID(uuid)
+					if err != nil {
+						continue
+					}
+					current = append(current, snap)
+				}
+			}
+		} else if localRepo, ok := head.(*LocalRepo); ok {
+			if localRepo.DefaultDistribution != "" {
+				rootDistributions = append(rootDistributions, localRepo.DefaultDistribution)
+			}
+			if localRepo.DefaultComponent != "" {
+				rootComponents = append(rootComponents, localRepo.DefaultComponent)
+			}
+		} else if remoteRepo, ok := head.(*RemoteRepo); ok {
+			if remoteRepo.Distribution != "" {
+				rootDistributions = append(rootDistributions, remoteRepo.Distribution)
+			}
+			rootComponents = append(rootComponents, remoteRepo.Components...)
+		} else {
+			panic("unknown type")
+		}
+	}
+
+	return
+}
+
 // NewPublishedRepo creates new published repository
 //
 // prefix specifies publishing prefix
-// distribution, component and architectures are user-defined properties
-// source could either be *Snapshot or *LocalRepo
-func NewPublishedRepo(prefix string, distribution string, component string, architectures []string, source interface{}, collectionFactory *CollectionFactory) (*PublishedRepo, error) {
-	var ok bool
-
+// distribution and architectures are user-defined properties
+// components & sources are lists of component to source mapping (*Snapshot or *LocalRepo),
+// all sources should be of the same kind
+//
+// storage is empty for local filesystem or "s3:<endpoint>" for configured S3 endpoint
+func NewPublishedRepo(storage string, prefix string, distribution string, architectures []string,
+	components []string, sources []interface{}, collectionFactory *CollectionFactory) (*PublishedRepo, error) {
 	result := &PublishedRepo{
 		UUID:          uuid.New(),
+		Storage:       storage,
 		Architectures: architectures,
+		Sources:       make(map[string]string),
+		sourceItems:   make(map[string]repoSourceItem),
+	}
+
+	if len(sources) == 0 {
+		panic("publish with empty sources")
 	}
 
-	// figure out source
-	result.snapshot, ok = source.(*Snapshot)
+	if len(sources) != len(components) {
+		panic("sources and components should be equal in size")
+	}
+
+	var (
+		discoveredDistributions = []string{}
+		source                  interface{}
+		component               string
+		snapshot                *Snapshot
+		localRepo               *LocalRepo
+		ok                      bool
+	)
+
+	// get first source
+	source = sources[0]
+
+	// figure out source kind
+	snapshot, ok = source.(*Snapshot)
 	if ok {
 		result.SourceKind = "snapshot"
-		result.SourceUUID = result.snapshot.UUID
 	} else {
-		result.localRepo, ok = source.(*LocalRepo)
+		localRepo, ok = source.(*LocalRepo)
 		if ok {
 			result.SourceKind = "local"
-			result.SourceUUID = result.localRepo.UUID
 		} else {
 			panic("unknown source kind")
 		}
 	}
 
+	for i := range sources {
+		component, source = components[i], sources[i]
+		if distribution == "" || component == "" {
+			rootDistributions, rootComponents := walkUpTree(source, collectionFactory)
+			if distribution == "" {
+				discoveredDistributions = append(discoveredDistributions, rootDistributions...)
+			}
+			if component == "" {
+				sort.Strings(rootComponents)
+				if len(rootComponents) > 0 && rootComponents[0] == rootComponents[len(rootComponents)-1] {
+					component = rootComponents[0]
+				} else if len(sources) == 1 {
+					// only if going from one source, assume default component "main"
+					component = "main"
+				} else {
+					return nil, fmt.Errorf("unable to figure out component name for %s", source)
+				}
+			}
+		}
+
+		_, exists := result.Sources[component]
+		if exists {
+			return nil, fmt.Errorf("duplicate component name: %s", component)
+		}
+
+		if result.SourceKind == "snapshot" {
+			snapshot, ok = source.(*Snapshot)
+			if !ok {
+				panic("mixing snapshots and local repos is not supported")
+			}
+
+			result.Sources[component] = snapshot.UUID
+			result.sourceItems[component] = repoSourceItem{snapshot: snapshot}
+		} else if result.SourceKind == "local" {
+			localRepo, ok = source.(*LocalRepo)
+			if !ok {
+				panic("mixing snapshots and local repos is not supported")
+			}
+
+			result.Sources[component] = localRepo.UUID
+			result.sourceItems[component] = repoSourceItem{localRepo: localRepo}
+		}
+	}
+
 	// clean & verify prefix
 	prefix = filepath.Clean(prefix)
 	if strings.HasPrefix(prefix, "/") {
@@ -81,101 +242,104 @@ func NewPublishedRepo(prefix string, distribution string, component string, arch
 
 	result.Prefix = prefix
 
-	// guessing distribution & component
-	if component == "" || distribution == "" {
-		var (
-			head              interface{}
-			current           = []interface{}{source}
-			rootComponents    = []string{}
-			rootDistributions = []string{}
-		)
-
-		// walk up the tree from current source up to roots (local or remote repos)
-		// and collect information about distribution and components
-		for len(current) > 0 {
-			head, current = current[0], current[1:]
-
-			if snapshot, ok := head.(*Snapshot); ok {
-				for _, uuid := range snapshot.SourceIDs {
-					if snapshot.SourceKind == "repo" {
-						remoteRepo, err := collectionFactory.RemoteRepoCollection().ByUUID(uuid)
-						if err != nil {
-							continue
-						}
-						current = append(current, remoteRepo)
-					} else if snapshot.SourceKind == "local" {
-						localRepo, err := collectionFactory.LocalRepoCollection().ByUUID(uuid)
-						if err != nil {
-							continue
-						}
-						current = append(current, localRepo)
-					} else if snapshot.SourceKind == "snapshot" {
-						snap, err := collectionFactory.SnapshotCollection().ByUUID(uuid)
-						if err != nil {
-							continue
-						}
-						current = append(current, snap)
-					}
-				}
-			} else if localRepo, ok := head.(*LocalRepo); ok {
-				if localRepo.DefaultDistribution != "" {
-					rootDistributions = append(rootDistributions, localRepo.DefaultDistribution)
-				}
-				if localRepo.DefaultComponent != "" {
-					rootComponents = append(rootComponents, localRepo.DefaultComponent)
-				}
-			} else if remoteRepo, ok := head.(*RemoteRepo); ok {
-				if remoteRepo.Distribution != "" {
-					rootDistributions = append(rootDistributions, remoteRepo.Distribution)
-				}
-				rootComponents = append(rootComponents, remoteRepo.Components...)
-			} else {
-				panic("unknown type")
-			}
-		}
-
-		if distribution == "" {
-			sort.Strings(rootDistributions)
-			if len(rootDistributions) > 0 && rootDistributions[0] == rootDistributions[len(rootDistributions)-1] {
-				distribution = rootDistributions[0]
-			} else {
-				return nil, fmt.Errorf("unable to guess distribution name, please specify explicitly")
-			}
-		}
-
-		if component == "" {
-			sort.Strings(rootComponents)
-			if len(rootComponents) > 0 && rootComponents[0] == rootComponents[len(rootComponents)-1] {
-				component = rootComponents[0]
-			} else {
-				component = "main"
-			}
+	// guessing distribution
+	if distribution == "" {
+		sort.Strings(discoveredDistributions)
+		if len(discoveredDistributions) > 0 && discoveredDistributions[0] == discoveredDistributions[len(discoveredDistributions)-1] {
+			distribution = discoveredDistributions[0]
+		} else {
+			return nil, fmt.Errorf("unable to guess distribution name, please specify explicitly")
 		}
 	}
 
-	result.Distribution, result.Component = distribution, component
+	result.Distribution = distribution
 
 	return result, nil
 }
 
 // String returns human-readable represenation of PublishedRepo
 func (p *PublishedRepo) String() string {
-	var source string
+	var sources = []string{}
 
-	if p.snapshot != nil {
-		source = p.snapshot.String()
-	} else if p.localRepo != nil {
-		source = p.localRepo.String()
-	} else {
-		panic("no snapshot/localRepo")
+	for _, component := range p.Components() {
+		var source string
+
+		item := p.sourceItems[component]
+		if item.snapshot != nil {
+			source = item.snapshot.String()
+		} else if item.localRepo != nil {
+			source = item.localRepo.String()
+		} else {
+			panic("no snapshot/localRepo")
+		}
+
+		if len(p.Sources) > 1 {
+			source = fmt.Sprintf("{%s: %s}", component, source)
+		}
+
+		sources = append(sources, source)
 	}
 
-	return fmt.Sprintf("%s/%s (%s) [%s] publishes %s", p.Prefix, p.Distribution, p.Component, strings.Join(p.Architectures, ", "), source)
+	return fmt.Sprintf("%s/%s (%s) [%s] publishes %s", p.StoragePrefix(), p.Distribution, strings.Join(p.Components(), ", "),
+		strings.Join(p.Architectures, ", "), strings.Join(sources, ", "))
 }
 
 // Key returns unique key identifying PublishedRepo
 func (p *PublishedRepo) Key() []byte {
-	return []byte("U" + p.Prefix + ">>" + p.Distribution)
+	return []byte("U" + p.StoragePrefix() + ">>" + p.Distribution)
+}
+
+// StoragePrefix returns combined storage & prefix for the repo
+func (p *PublishedRepo) StoragePrefix() string {
+	if p.Storage == "" {
+		return p.Prefix
+	}
+	return p.Storage + ":" + p.Prefix
+}
+
+// Components returns sorted list of published repo components
+func (p *PublishedRepo) Components() []string {
+	result := make([]string, 0, len(p.Sources))
+	for component := range p.Sources {
+		result = append(result, component)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// RefList returns list of package refs for the component
+func (p *PublishedRepo) RefList(component string) *PackageRefList {
+	item := p.sourceItems[component]
+	if item.snapshot != nil {
+		return item.snapshot.RefList()
+	} else if item.localRepo != nil {
+		return item.localRepo.RefList()
+	}
+	panic("no snapshot/localRepo")
+}
+
+// UpdateSnapshot switches component of published repo to new snapshot
+func (p *PublishedRepo) UpdateSnapshot(component string, snapshot *Snapshot) {
+	if p.SourceKind != "snapshot" {
+		panic("not snapshot publish")
+	}
+
+	_, exists := p.Sources[component]
+	if !exists {
+		panic("component doesn't exist")
+	}
+
+	p.Sources[component] = snapshot.UUID
+	p.sourceItems[component] = repoSourceItem{snapshot: snapshot}
+}
+
+// CompressionFormats returns list of compression formats for indexes
+func (p *PublishedRepo) CompressionFormats() []string {
+	if len(p.Compression) > 0 {
+		return p.Compression
+	}
+	return utils.Config.PublishCompression
 }
 
 // Encode does msgpack encoding of PublishedRepo
@@ -201,12 +365,31 @@ func (p *PublishedRepo) Decode(input []byte) error {
 		p.SourceKind = "snapshot"
 	}
 
+	// old PublishedRepo were publishing single component from single source
+	if p.Component != "" && p.SourceUUID != "" && len(p.Sources) == 0 {
+		p.Sources = map[string]string{p.Component: p.SourceUUID}
+		p.Component = ""
+		p.SourceUUID = ""
+	}
+
 	return nil
 }
 
+// publishedIndex is a single Packages/Sources index being generated
+type publishedIndex struct {
+	arch string
+	udeb bool
+}
+
 // Publish publishes snapshot (repository) contents, links package files, generates Packages & Release files, signs them
 func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorage aptly.PublishedStorage, collectionFactory *CollectionFactory, signer utils.Signer, progress aptly.Progress) error {
-	err := publishedStorage.MkDir(filepath.Join(p.Prefix, "pool"))
+	compressionFormats := p.CompressionFormats()
+	err := utils.ValidateCompressionFormats(compressionFormats)
+	if err != nil {
+		return err
+	}
+
+	err = publishedStorage.MkDir(filepath.Join(p.Prefix, "pool"))
 	if err != nil {
 		return err
 	}
@@ -220,28 +403,29 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorage
 		progress.Printf("Loading packages...\n")
 	}
 
-	var refList *PackageRefList
+	lists := map[string]*PackageList{}
 
-	if p.snapshot != nil {
-		refList = p.snapshot.RefList()
-	} else if p.localRepo != nil {
-		refList = p.localRepo.RefList()
-	} else {
-		panic("no source")
-	}
-
-	// Load all packages
-	list, err := NewPackageListFromRefList(refList, collectionFactory.PackageCollection(), progress)
-	if err != nil {
-		return fmt.Errorf("unable to load packages: %s", err)
-	}
+	for component := range p.sourceItems {
+		// Load all packages
+		lists[component], err = NewPackageListFromRefList(p.RefList(component), collectionFactory.PackageCollection(), progress)
+		if err != nil {
+			return fmt.Errorf("unable to load packages: %s", err)
+		}
 
-	if list.Len() == 0 {
-		return fmt.Errorf("snapshot is empty")
+		if lists[component].Len() == 0 {
+			if p.SourceKind == "local" {
+				return fmt.Errorf("local repo is empty")
+			}
+			return fmt.Errorf("snapshot is empty")
+		}
 	}
 
 	if len(p.Architectures) == 0 {
-		p.Architectures = list.Architectures(true)
+		for _, list := range lists {
+			p.Architectures = append(p.Architectures, list.Architectures(true)...)
+		}
+		sort.Strings(p.Architectures)
+		p.Architectures = utils.StrSliceDeduplicate(p.Architectures)
 	}
 
 	if len(p.Architectures) == 0 {
@@ -252,120 +436,254 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorage
 
 	generatedFiles := map[string]utils.ChecksumInfo{}
 
+	// all the files are generated with temporary suffix and renamed
+	// into place once everything is written and signed
+	suffix := ".tmp"
+	renameMap := map[string]string{}
+
 	if progress != nil {
 		progress.Printf("Generating metadata files and linking package files...\n")
 	}
 
-	// For all architectures, generate release file
-	for _, arch := range p.Architectures {
-		if progress != nil {
-			progress.InitBar(int64(list.Len()), false)
-		}
+	for _, component := range p.Components() {
+		list := lists[component]
 
-		var relativePath string
-		if arch == "source" {
-			relativePath = filepath.Join(p.Component, "source", "Sources")
-		} else {
-			relativePath = filepath.Join(p.Component, fmt.Sprintf("binary-%s", arch), "Packages")
-		}
-		err = publishedStorage.MkDir(filepath.Dir(filepath.Join(basePath, relativePath)))
-		if err != nil {
-			return err
-		}
+		hasUdebs := false
+		list.ForEach(func(pkg *Package) error {
+			hasUdebs = hasUdebs || pkg.IsUdeb
+			return nil
+		})
 
-		packagesFile, err := publishedStorage.CreateFile(filepath.Join(basePath, relativePath))
-		if err != nil {
-			return fmt.Errorf("unable to creates Packages file: %s", err)
+		// For all architectures, generate packages/sources files, udebs
+		// go to separate debian-installer index for every binary architecture
+		indexes := []publishedIndex{}
+		for _, arch := range p.Architectures {
+			indexes = append(indexes, publishedIndex{arch: arch})
+			if hasUdebs && arch != "source" {
+				indexes = append(indexes, publishedIndex{arch: arch, udeb: true})
+			}
 		}
 
-		bufWriter := bufio.NewWriter(packagesFile)
+		for _, index := range indexes {
+			arch, udeb := index.arch, index.udeb
 
-		err = list.ForEach(func(pkg *Package) error {
 			if progress != nil {
-				progress.AddBar(1)
+				progress.InitBar(int64(list.Len()), false)
+			}
+
+			var relativePath string
+			if arch == "source" {
+				relativePath = filepath.Join(component, "source", "Sources")
+			} else if udeb {
+				relativePath = filepath.Join(component, "debian-installer", fmt.Sprintf("binary-%s", arch), "Packages")
+			} else {
+				relativePath = filepath.Join(component, fmt.Sprintf("binary-%s", arch), "Packages")
 			}
-			if pkg.MatchesArchitecture(arch) {
-				err = pkg.LinkFromPool(publishedStorage, packagePool, p.Prefix, p.Component)
+			err = publishedStorage.MkDir(filepath.Dir(filepath.Join(basePath, relativePath)))
+			if err != nil {
+				return err
+			}
+
+			packagesFile, err := publishedStorage.CreateFile(filepath.Join(basePath, relativePath+suffix))
+			if err != nil {
+				return fmt.Errorf("unable to creates Packages file: %s", err)
+			}
+
+			bufWriter := bufio.NewWriter(packagesFile)
+
+			var contentsIndex *ContentsIndex
+			if arch != "source" && !udeb {
+				contentsIndex = NewContentsIndex()
+			}
+
+			err = list.ForEachSorted(func(pkg *Package) error {
+				if progress != nil {
+					progress.AddBar(1)
+				}
+				if pkg.MatchesArchitecture(arch) && pkg.IsUdeb == udeb {
+					err = pkg.LinkFromPool(publishedStorage, packagePool, p.Prefix, component)
+					if err != nil {
+						return err
+					}
+
+					err = pkg.Stanza().WriteTo(bufWriter)
+					if err != nil {
+						return err
+					}
+					err = bufWriter.WriteByte('\n')
+					if err != nil {
+						return err
+					}
+
+					if contentsIndex != nil {
+						contents, err := pkg.Contents(packagePool)
+						if err != nil {
+							if progress != nil {
+								progress.ColoredPrintf("@y[!]@| @!Unable to read contents of %s: %s@|", pkg, err)
+							}
+						} else {
+							contentsIndex.Push(pkg, contents)
+						}
+					}
+
+					pkg.files = nil
+					pkg.deps = nil
+					pkg.extra = nil
+
+				}
+
+				return nil
+			})
+
+			if err != nil {
+				return fmt.Errorf("unable to process packages: %s", err)
+			}
+
+			err = bufWriter.Flush()
+			if err != nil {
+				return fmt.Errorf("unable to write Packages file: %s", err)
+			}
+
+			err = utils.CompressFile(packagesFile, compressionFormats)
+			if err != nil {
+				return fmt.Errorf("unable to compress Packages files: %s", err)
+			}
+
+			packagesFile.Close()
+
+			if !utils.StrSliceHasItem(compressionFormats, utils.CompressionNone) {
+				err = publishedStorage.Remove(filepath.Join(basePath, relativePath+suffix))
 				if err != nil {
-					return err
+					return fmt.Errorf("unable to remove uncompressed Packages file: %s", err)
 				}
+			}
 
-				err = pkg.Stanza().WriteTo(bufWriter)
+			for _, format := range compressionFormats {
+				ext := utils.CompressionExtension(format)
+				checksumInfo, err := publishedStorage.ChecksumsForFile(filepath.Join(basePath, relativePath+suffix+ext))
 				if err != nil {
-					return err
+					return fmt.Errorf("unable to collect checksums: %s", err)
+				}
+				generatedFiles[relativePath+ext] = checksumInfo
+				renameMap[filepath.Join(basePath, relativePath+suffix+ext)] = filepath.Join(basePath, relativePath+ext)
+			}
+
+			if contentsIndex != nil {
+				contentsPath := filepath.Join(component, fmt.Sprintf("Contents-%s.gz", arch))
+
+				contentsFile, err := publishedStorage.CreateFile(filepath.Join(basePath, contentsPath+suffix))
+				if err != nil {
+					return fmt.Errorf("unable to create Contents file: %s", err)
 				}
-				err = bufWriter.WriteByte('\n')
+
+				gzWriter := gzip.NewWriter(contentsFile)
+
+				_, err = contentsIndex.WriteTo(gzWriter)
 				if err != nil {
-					return err
+					return fmt.Errorf("unable to write Contents file: %s", err)
 				}
 
-				pkg.files = nil
-				pkg.deps = nil
-				pkg.extra = nil
+				err = gzWriter.Close()
+				if err != nil {
+					return fmt.Errorf("unable to write Contents file: %s", err)
+				}
 
-			}
+				contentsFile.Close()
 
-			return nil
-		})
+				checksumInfo, err := publishedStorage.ChecksumsForFile(filepath.Join(basePath, contentsPath+suffix))
+				if err != nil {
+					return fmt.Errorf("unable to collect checksums: %s", err)
+				}
+				generatedFiles[contentsPath] = checksumInfo
+				renameMap[filepath.Join(basePath, contentsPath+suffix)] = filepath.Join(basePath, contentsPath)
+			}
 
-		if err != nil {
-			return fmt.Errorf("unable to process packages: %s", err)
+			if progress != nil {
+				progress.ShutdownBar()
+			}
 		}
+	}
 
-		err = bufWriter.Flush()
-		if err != nil {
-			return fmt.Errorf("unable to write Packages file: %s", err)
-		}
+	var byHashFiles []string
 
-		err = utils.CompressFile(packagesFile)
-		if err != nil {
-			return fmt.Errorf("unable to compress Packages files: %s", err)
-		}
+	if p.AcquireByHash {
+		for oldName, newName := range renameMap {
+			relativePath, err := filepath.Rel(basePath, newName)
+			if err != nil {
+				return err
+			}
 
-		packagesFile.Close()
+			byHashPath := filepath.Join(filepath.Dir(relativePath), "by-hash", "SHA256", generatedFiles[relativePath].SHA256)
 
-		checksumInfo, err := publishedStorage.ChecksumsForFile(filepath.Join(basePath, relativePath))
-		if err != nil {
-			return fmt.Errorf("unable to collect checksums: %s", err)
-		}
-		generatedFiles[relativePath] = checksumInfo
+			err = publishedStorage.MkDir(filepath.Join(basePath, filepath.Dir(byHashPath)))
+			if err != nil {
+				return err
+			}
 
-		checksumInfo, err = publishedStorage.ChecksumsForFile(filepath.Join(basePath, relativePath+".gz"))
-		if err != nil {
-			return fmt.Errorf("unable to collect checksums: %s", err)
-		}
-		generatedFiles[relativePath+".gz"] = checksumInfo
+			err = publishedStorage.HardLink(oldName, filepath.Join(basePath, byHashPath))
+			if err != nil {
+				return fmt.Errorf("unable to create by-hash link: %s", err)
+			}
 
-		checksumInfo, err = publishedStorage.ChecksumsForFile(filepath.Join(basePath, relativePath+".bz2"))
-		if err != nil {
-			return fmt.Errorf("unable to collect checksums: %s", err)
+			byHashFiles = append(byHashFiles, byHashPath)
 		}
-		generatedFiles[relativePath+".bz2"] = checksumInfo
+	}
 
-		if progress != nil {
-			progress.ShutdownBar()
-		}
+	now, err := p.releaseDate()
+	if err != nil {
+		return err
 	}
 
 	release := make(Stanza)
 	release["Origin"] = p.Prefix + " " + p.Distribution
+	if p.Origin != "" {
+		release["Origin"] = p.Origin
+	}
 	release["Label"] = p.Prefix + " " + p.Distribution
+	if p.Label != "" {
+		release["Label"] = p.Label
+	}
+	if p.Suite != "" {
+		release["Suite"] = p.Suite
+	}
+	if p.Version != "" {
+		release["Version"] = p.Version
+	}
 	release["Codename"] = p.Distribution
-	release["Date"] = time.Now().UTC().Format("Mon, 2 Jan 2006 15:04:05 MST")
-	release["Components"] = p.Component
+	release["Date"] = now.Format("Mon, 2 Jan 2006 15:04:05 MST")
+	if p.ValidFor > 0 {
+		release["Valid-Until"] = now.Add(p.ValidFor).Format("Mon, 2 Jan 2006 15:04:05 MST")
+	}
+	if p.NotAutomatic {
+		release["NotAutomatic"] = "yes"
+	}
+	if p.ButAutomaticUpgrades {
+		release["ButAutomaticUpgrades"] = "yes"
+	}
+	if p.AcquireByHash {
+		release["Acquire-By-Hash"] = "yes"
+	}
+	release["Components"] = strings.Join(p.Components(), " ")
 	release["Architectures"] = strings.Join(utils.StrSlicesSubstract(p.Architectures, []string{"source"}), " ")
 	release["Description"] = " Generated by aptly\n"
 	release["MD5Sum"] = "\n"
 	release["SHA1"] = "\n"
 	release["SHA256"] = "\n"
 
-	for path, info := range generatedFiles {
+	paths := make([]string, 0, len(generatedFiles))
+	for path := range generatedFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		info := generatedFiles[path]
 		release["MD5Sum"] += fmt.Sprintf(" %s %8d %s\n", info.MD5, info.Size, path)
 		release["SHA1"] += fmt.Sprintf(" %s %8d %s\n", info.SHA1, info.Size, path)
 		release["SHA256"] += fmt.Sprintf(" %s %8d %s\n", info.SHA256, info.Size, path)
 	}
 
-	releaseFile, err := publishedStorage.CreateFile(filepath.Join(basePath, "Release"))
+	releaseFile, err := publishedStorage.CreateFile(filepath.Join(basePath, "Release"+suffix))
 	if err != nil {
 		return fmt.Errorf("unable to create Release file: %s", err)
 	}
@@ -385,21 +703,109 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorage
 	releaseFilename := releaseFile.Name()
 	releaseFile.Close()
 
+	// signing is done on temporary file, but user should see the name file would end up with
+	releaseName := strings.TrimSuffix(releaseFilename, suffix)
+
 	// Signing files might output to console, so flush progress writer first
 	if progress != nil {
 		progress.Flush()
 	}
 
 	if signer != nil {
-		err = signer.DetachedSign(releaseFilename, releaseFilename+".gpg")
+		err = signer.DetachedSign(releaseFilename, filepath.Join(filepath.Dir(releaseFilename), "Release.gpg"+suffix), releaseName)
 		if err != nil {
 			return fmt.Errorf("unable to sign Release file: %s", err)
 		}
 
-		err = signer.ClearSign(releaseFilename, filepath.Join(filepath.Dir(releaseFilename), "InRelease"))
+		err = signer.ClearSign(releaseFilename, filepath.Join(filepath.Dir(releaseFilename), "InRelease"+suffix), releaseName)
 		if err != nil {
 			return fmt.Errorf("unable to sign Release file: %s", err)
 		}
+
+	}
+
+	for oldName, newName := range renameMap {
+		err = publishedStorage.RenameFile(oldName, newName)
+		if err != nil {
+			return fmt.Errorf("unable to rename: %s", err)
+		}
+	}
+
+	// Release files go last, so that clients never see Release pointing to indexes not yet in place.
+	// InRelease is self-contained, so it is switched first; Release and Release.gpg follow back-to-back
+	// to keep the window where they don't match as short as possible. Without by-hash this is still
+	// not atomic: indexes above are replaced in place, so client which has just fetched old Release
+	// might get new index files with mismatching checksums and would have to retry.
+	releaseFiles := []string{"Release"}
+	if signer != nil {
+		releaseFiles = []string{"InRelease", "Release", "Release.gpg"}
+	}
+
+	for _, name := range releaseFiles {
+		err = publishedStorage.RenameFile(filepath.Join(basePath, name+suffix), filepath.Join(basePath, name))
+		if err != nil {
+			return fmt.Errorf("unable to rename: %s", err)
+		}
+	}
+
+	if p.AcquireByHash {
+		sort.Strings(byHashFiles)
+		p.ByHashHistory = append(p.ByHashHistory, byHashFiles)
+
+		err = p.pruneByHash(publishedStorage, basePath, utils.Config.PublishByHashKeep)
+		if err != nil {
+			return fmt.Errorf("unable to prune by-hash files: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// releaseDate returns timestamp for Date field of Release file
+func (p *PublishedRepo) releaseDate() (time.Time, error) {
+	if !p.ReleaseDate.IsZero() {
+		return p.ReleaseDate.UTC(), nil
+	}
+
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch != "" {
+		return utils.ParseEpoch(epoch)
+	}
+
+	return time.Now().UTC(), nil
+}
+
+// pruneByHash removes by-hash files which are not referenced by the last keep generations,
+// if keep is zero or negative, nothing is removed
+func (p *PublishedRepo) pruneByHash(publishedStorage aptly.PublishedStorage, basePath string, keep int) error {
+	if keep <= 0 || len(p.ByHashHistory) <= keep {
+		return nil
+	}
+
+	dropped := p.ByHashHistory[:len(p.ByHashHistory)-keep]
+	p.ByHashHistory = p.ByHashHistory[len(p.ByHashHistory)-keep:]
+
+	referenced := map[string]bool{}
+	for _, generation := range p.ByHashHistory {
+		for _, path := range generation {
+			referenced[path] = true
+		}
+	}
+
+	for _, generation := range dropped {
+		for _, path := range generation {
+			if referenced[path] {
+				continue
+			}
+
+			err := publishedStorage.Remove(filepath.Join(basePath, path))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			// same file could be listed in several dropped generations
+			referenced[path] = true
+		}
 	}
 
 	return nil
@@ -407,24 +813,25 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorage
 
 // RemoveFiles removes files that were created by Publish
 //
-// It can remove prefix fully, and part of pool (for specific component)
-func (p *PublishedRepo) RemoveFiles(publishedStorage aptly.PublishedStorage, removePrefix, removePoolComponent bool) error {
+// It can remove prefix fully, and part of pool (for specific components)
+func (p *PublishedRepo) RemoveFiles(publishedStorage aptly.PublishedStorage, removePrefix bool, removePoolComponents []string,
+	progress aptly.Progress) error {
 	if removePrefix {
-		err := publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "dists"))
+		err := publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "dists"), progress)
 		if err != nil {
 			return err
 		}
 
-		return publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "pool"))
+		return publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "pool"), progress)
 	}
 
-	err := publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "dists", p.Distribution))
+	err := publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "dists", p.Distribution), progress)
 	if err != nil {
 		return err
 	}
 
-	if removePoolComponent {
-		err = publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "pool", p.Component))
+	for _, component := range removePoolComponents {
+		err = publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "pool", component), progress)
 		if err != nil {
 			return err
 		}
@@ -462,7 +869,7 @@ func NewPublishedRepoCollection(db database.Storage) *PublishedRepoCollection {
 // Add appends new repo to collection and saves it
 func (collection *PublishedRepoCollection) Add(repo *PublishedRepo) error {
 	if collection.CheckDuplicate(repo) != nil {
-		return fmt.Errorf("published repo with prefix/distribution %s/%s already exists", repo.Prefix, repo.Distribution)
+		return fmt.Errorf("published repo with prefix/distribution %s/%s already exists", repo.StoragePrefix(), repo.Distribution)
 	}
 
 	err := collection.Update(repo)
@@ -477,7 +884,7 @@ func (collection *PublishedRepoCollection) Add(repo *PublishedRepo) error {
 // CheckDuplicate verifies that there's no published repo with the same name
 func (collection *PublishedRepoCollection) CheckDuplicate(repo *PublishedRepo) *PublishedRepo {
 	for _, r := range collection.list {
-		if r.Prefix == repo.Prefix && r.Distribution == repo.Distribution {
+		if r.Storage == repo.Storage && r.Prefix == repo.Prefix && r.Distribution == repo.Distribution {
 			return r
 		}
 	}
@@ -494,29 +901,58 @@ func (collection *PublishedRepoCollection) Update(repo *PublishedRepo) error {
 	return nil
 }
 
-// LoadComplete loads additional information for remote repo
-func (collection *PublishedRepoCollection) LoadComplete(repo *PublishedRepo, collectionFactory *CollectionFactory) error {
-	var err error
+// LoadComplete loads additional information for published repo
+func (collection *PublishedRepoCollection) LoadComplete(repo *PublishedRepo, collectionFactory *CollectionFactory) (err error) {
+	repo.sourceItems = make(map[string]repoSourceItem)
 
 	if repo.SourceKind == "snapshot" {
-		repo.snapshot, err = collectionFactory.SnapshotCollection().ByUUID(repo.SourceUUID)
+		for component, sourceUUID := range repo.Sources {
+			item := repoSourceItem{}
+
+			item.snapshot, err = collectionFactory.SnapshotCollection().ByUUID(sourceUUID)
+			if err != nil {
+				return
+			}
+			err = collectionFactory.SnapshotCollection().LoadComplete(item.snapshot)
+			if err != nil {
+				return
+			}
+
+			repo.sourceItems[component] = item
+		}
 	} else if repo.SourceKind == "local" {
-		repo.localRepo, err = collectionFactory.LocalRepoCollection().ByUUID(repo.SourceUUID)
+		for component, sourceUUID := range repo.Sources {
+			item := repoSourceItem{}
+
+			item.localRepo, err = collectionFactory.LocalRepoCollection().ByUUID(sourceUUID)
+			if err != nil {
+				return
+			}
+			err = collectionFactory.LocalRepoCollection().LoadComplete(item.localRepo)
+			if err != nil {
+				return
+			}
+
+			repo.sourceItems[component] = item
+		}
 	} else {
 		panic("unknown SourceKind")
 	}
 
-	return err
+	return
 }
 
-// ByPrefixDistribution looks up repository by prefix & distribution
-func (collection *PublishedRepoCollection) ByPrefixDistribution(prefix, distribution string) (*PublishedRepo, error) {
+// ByStoragePrefixDistribution looks up repository by storage, prefix & distribution
+func (collection *PublishedRepoCollection) ByStoragePrefixDistribution(storage, prefix, distribution string) (*PublishedRepo, error) {
 	for _, r := range collection.list {
-		if r.Prefix == prefix && r.Distribution == distribution {
+		if r.Storage == storage && r.Prefix == prefix && r.Distribution == distribution {
 			return r, nil
 		}
 	}
-	return nil, fmt.Errorf("published repo with prefix/distribution %s/%s not found", prefix, distribution)
+	if storage != "" {
+		storage += ":"
+	}
+	return nil, fmt.Errorf("published repo with storage:prefix/distribution %s%s/%s not found", storage, prefix, distribution)
 }
 
 // ByUUID looks up repository by uuid
@@ -533,8 +969,13 @@ func (collection *PublishedRepoCollection) ByUUID(uuid string) (*PublishedRepo,
 func (collection *PublishedRepoCollection) BySnapshot(snapshot *Snapshot) []*PublishedRepo {
 	result := make([]*PublishedRepo, 0)
 	for _, r := range collection.list {
-		if r.SourceKind == "snapshot" && r.SourceUUID == snapshot.UUID {
-			result = append(result, r)
+		if r.SourceKind == "snapshot" {
+			for _, sourceUUID := range r.Sources {
+				if sourceUUID == snapshot.UUID {
+					result = append(result, r)
+					break
+				}
+			}
 		}
 	}
 	return result
@@ -544,8 +985,13 @@ func (collection *PublishedRepoCollection) BySnapshot(snapshot *Snapshot) []*Pub
 func (collection *PublishedRepoCollection) ByLocalRepo(repo *LocalRepo) []*PublishedRepo {
 	result := make([]*PublishedRepo, 0)
 	for _, r := range collection.list {
-		if r.SourceKind == "local" && r.SourceUUID == repo.UUID {
-			result = append(result, r)
+		if r.SourceKind == "local" {
+			for _, sourceUUID := range r.Sources {
+				if sourceUUID == repo.UUID {
+					result = append(result, r)
+					break
+				}
+			}
 		}
 	}
 	return result
@@ -569,14 +1015,15 @@ func (collection *PublishedRepoCollection) Len() int {
 }
 
 // Remove removes published repository, cleaning up directories, files
-func (collection *PublishedRepoCollection) Remove(publishedStorage aptly.PublishedStorage, prefix, distribution string) error {
-	repo, err := collection.ByPrefixDistribution(prefix, distribution)
+func (collection *PublishedRepoCollection) Remove(publishedStorage aptly.PublishedStorage, storage, prefix, distribution string,
+	progress aptly.Progress) error {
+	repo, err := collection.ByStoragePrefixDistribution(storage, prefix, distribution)
 	if err != nil {
 		return err
 	}
 
 	removePrefix := true
-	removePoolComponent := true
+	removePoolComponents := repo.Components()
 	repoPosition := -1
 
 	for i, r := range collection.list {
@@ -584,15 +1031,13 @@ func (collection *PublishedRepoCollection) Remove(publishedStorage aptly.Publish
 			repoPosition = i
 			continue
 		}
-		if r.Prefix == repo.Prefix {
+		if r.Storage == repo.Storage && r.Prefix == repo.Prefix {
 			removePrefix = false
-			if r.Component == repo.Component {
-				removePoolComponent = false
-			}
+			removePoolComponents = utils.StrSlicesSubstract(removePoolComponents, r.Components())
 		}
 	}
 
-	err = repo.RemoveFiles(publishedStorage, removePrefix, removePoolComponent)
+	err = repo.RemoveFiles(publishedStorage, removePrefix, removePoolComponents, progress)
 	if err != nil {
 		return err
 	}
@@ -602,3 +1047,87 @@ func (collection *PublishedRepoCollection) Remove(publishedStorage aptly.Publish
 
 	return collection.db.Delete(repo.Key())
 }
+
+// CleanupPrefixComponentFiles removes all unreferenced files in published storage under prefix/component pair
+func (collection *PublishedRepoCollection) CleanupPrefixComponentFiles(storage, prefix string, components []string,
+	publishedStorage aptly.PublishedStorage, collectionFactory *CollectionFactory, progress aptly.Progress) error {
+
+	referencedFiles := map[string][]string{}
+
+	if progress != nil {
+		progress.Printf("Cleaning up prefix %#v components %s...\n", prefix, strings.Join(components, ", "))
+	}
+
+	for _, r := range collection.list {
+		if r.Storage != storage || r.Prefix != prefix {
+			continue
+		}
+
+		matches := false
+		repoComponents := r.Components()
+		for _, component := range components {
+			if utils.StrSliceHasItem(repoComponents, component) {
+				matches = true
+				break
+			}
+		}
+
+		if !matches {
+			continue
+		}
+
+		err := collection.LoadComplete(r, collectionFactory)
+		if err != nil {
+			return err
+		}
+
+		for _, component := range components {
+			if !utils.StrSliceHasItem(repoComponents, component) {
+				continue
+			}
+
+			packageList, err := NewPackageListFromRefList(r.RefList(component), collectionFactory.PackageCollection(), progress)
+			if err != nil {
+				return err
+			}
+
+			err = packageList.ForEach(func(p *Package) error {
+				poolDir, err := p.PoolDirectory()
+				if err != nil {
+					return err
+				}
+
+				for _, f := range p.Files() {
+					referencedFiles[component] = append(referencedFiles[component], filepath.Join(poolDir, f.Filename))
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, component := range components {
+		sort.Strings(referencedFiles[component])
+
+		existingFiles, err := publishedStorage.Filelist(filepath.Join(prefix, "pool", component))
+		if err != nil {
+			return err
+		}
+
+		sort.Strings(existingFiles)
+
+		filesToDelete := utils.StrSlicesSubstract(existingFiles, referencedFiles[component])
+
+		for _, file := range filesToDelete {
+			err = publishedStorage.Remove(filepath.Join(prefix, "pool", component, file))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,13 +1,17 @@
 package debian
 
 import (
+	"bytes"
 	"errors"
 	"github.com/smira/aptly/aptly"
 	"github.com/smira/aptly/database"
 	"github.com/smira/aptly/files"
+	"github.com/ugorji/go/codec"
+	"io/ioutil"
 	. "launchpad.net/gocheck"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type pathExistsChecker struct {
@@ -29,31 +33,31 @@ func (n *NullSigner) Init() error {
 	return nil
 }
 
-func (n *NullSigner) SetKey(keyRef string) {
+func (n *NullSigner) SetKeys(keyRefs []string) {
 }
 
 func (n *NullSigner) SetKeyRing(keyring, secretKeyring string) {
 }
 
-func (n *NullSigner) DetachedSign(source string, destination string) error {
-	return nil
+func (n *NullSigner) DetachedSign(source string, destination string, name string) error {
+	return ioutil.WriteFile(destination, []byte{}, 0644)
 }
 
-func (n *NullSigner) ClearSign(source string, destination string) error {
-	return nil
+func (n *NullSigner) ClearSign(source string, destination string, name string) error {
+	return ioutil.WriteFile(destination, []byte{}, 0644)
 }
 
 type PublishedRepoSuite struct {
 	PackageListMixinSuite
-	repo, repo2       *PublishedRepo
-	root              string
-	publishedStorage  aptly.PublishedStorage
-	packagePool       aptly.PackagePool
-	localRepo         *LocalRepo
-	snapshot          *Snapshot
-	db                database.Storage
-	factory           *CollectionFactory
-	packageCollection *PackageCollection
+	repo, repo2, repo3  *PublishedRepo
+	root                string
+	publishedStorage    aptly.PublishedStorage
+	packagePool         aptly.PackagePool
+	localRepo           *LocalRepo
+	snapshot, snapshot2 *Snapshot
+	db                  database.Storage
+	factory             *CollectionFactory
+	packageCollection   *PackageCollection
 }
 
 var _ = Suite(&PublishedRepoSuite{})
@@ -68,7 +72,7 @@ func (s *PublishedRepoSuite) SetUpTest(c *C) {
 	s.publishedStorage = files.NewPublishedStorage(s.root)
 	s.packagePool = files.NewPackagePool(s.root)
 
-	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false)
+	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false, false)
 	repo.packageRefs = s.reflist
 	s.factory.RemoteRepoCollection().Add(repo)
 
@@ -79,14 +83,19 @@ func (s *PublishedRepoSuite) SetUpTest(c *C) {
 	s.snapshot, _ = NewSnapshotFromRepository("snap", repo)
 	s.factory.SnapshotCollection().Add(s.snapshot)
 
+	s.snapshot2, _ = NewSnapshotFromRepository("snap", repo)
+	s.factory.SnapshotCollection().Add(s.snapshot2)
+
 	s.packageCollection = s.factory.PackageCollection()
 	s.packageCollection.Update(s.p1)
 	s.packageCollection.Update(s.p2)
 	s.packageCollection.Update(s.p3)
 
-	s.repo, _ = NewPublishedRepo("ppa", "squeeze", "main", nil, s.snapshot, s.factory)
+	s.repo, _ = NewPublishedRepo("", "ppa", "squeeze", nil, []string{"main"}, []interface{}{s.snapshot}, s.factory)
 
-	s.repo2, _ = NewPublishedRepo("ppa", "maverick", "main", nil, s.localRepo, s.factory)
+	s.repo2, _ = NewPublishedRepo("", "ppa", "maverick", nil, []string{"main"}, []interface{}{s.localRepo}, s.factory)
+
+	s.repo3, _ = NewPublishedRepo("", "linux", "natty", nil, []string{"main", "contrib"}, []interface{}{s.snapshot, s.snapshot2}, s.factory)
 
 	poolPath, _ := s.packagePool.Path(s.p1.Files()[0].Filename, s.p1.Files()[0].Checksums.MD5)
 	err := os.MkdirAll(filepath.Dir(poolPath), 0755)
@@ -155,7 +164,7 @@ func (s *PublishedRepoSuite) TestPrefixNormalization(c *C) {
 			errorExpected: "invalid prefix .*",
 		},
 	} {
-		repo, err := NewPublishedRepo(t.prefix, "squeeze", "main", nil, s.snapshot, s.factory)
+		repo, err := NewPublishedRepo("", t.prefix, "squeeze", nil, []string{"main"}, []interface{}{s.snapshot}, s.factory)
 		if t.errorExpected != "" {
 			c.Check(err, ErrorMatches, t.errorExpected)
 		} else {
@@ -165,37 +174,50 @@ func (s *PublishedRepoSuite) TestPrefixNormalization(c *C) {
 }
 
 func (s *PublishedRepoSuite) TestDistributionComponentGuessing(c *C) {
-	repo, err := NewPublishedRepo("ppa", "", "", nil, s.snapshot, s.factory)
+	repo, err := NewPublishedRepo("", "ppa", "", nil, []string{""}, []interface{}{s.snapshot}, s.factory)
 	c.Check(err, IsNil)
 	c.Check(repo.Distribution, Equals, "squeeze")
-	c.Check(repo.Component, Equals, "main")
+	c.Check(repo.Components(), DeepEquals, []string{"main"})
 
-	repo, err = NewPublishedRepo("ppa", "wheezy", "", nil, s.snapshot, s.factory)
+	repo, err = NewPublishedRepo("", "ppa", "wheezy", nil, []string{""}, []interface{}{s.snapshot}, s.factory)
 	c.Check(err, IsNil)
 	c.Check(repo.Distribution, Equals, "wheezy")
-	c.Check(repo.Component, Equals, "main")
+	c.Check(repo.Components(), DeepEquals, []string{"main"})
 
-	repo, err = NewPublishedRepo("ppa", "", "non-free", nil, s.snapshot, s.factory)
+	repo, err = NewPublishedRepo("", "ppa", "", nil, []string{"non-free"}, []interface{}{s.snapshot}, s.factory)
 	c.Check(err, IsNil)
 	c.Check(repo.Distribution, Equals, "squeeze")
-	c.Check(repo.Component, Equals, "non-free")
+	c.Check(repo.Components(), DeepEquals, []string{"non-free"})
 
-	repo, err = NewPublishedRepo("ppa", "squeeze", "", nil, s.localRepo, s.factory)
+	repo, err = NewPublishedRepo("", "ppa", "squeeze", nil, []string{""}, []interface{}{s.localRepo}, s.factory)
 	c.Check(err, IsNil)
 	c.Check(repo.Distribution, Equals, "squeeze")
-	c.Check(repo.Component, Equals, "main")
+	c.Check(repo.Components(), DeepEquals, []string{"main"})
 
-	repo, err = NewPublishedRepo("ppa", "", "main", nil, s.localRepo, s.factory)
+	repo, err = NewPublishedRepo("", "ppa", "", nil, []string{"main"}, []interface{}{s.localRepo}, s.factory)
 	c.Check(err, ErrorMatches, "unable to guess distribution name, please specify explicitly")
 
 	s.localRepo.DefaultDistribution = "precise"
 	s.localRepo.DefaultComponent = "contrib"
 	s.factory.LocalRepoCollection().Update(s.localRepo)
 
-	repo, err = NewPublishedRepo("ppa", "", "", nil, s.localRepo, s.factory)
+	repo, err = NewPublishedRepo("", "ppa", "", nil, []string{""}, []interface{}{s.localRepo}, s.factory)
 	c.Check(err, IsNil)
 	c.Check(repo.Distribution, Equals, "precise")
-	c.Check(repo.Component, Equals, "contrib")
+	c.Check(repo.Components(), DeepEquals, []string{"contrib"})
+
+	repo, err = NewPublishedRepo("", "ppa", "", nil, []string{"", "contrib"}, []interface{}{s.snapshot, s.snapshot2}, s.factory)
+	c.Check(err, IsNil)
+	c.Check(repo.Distribution, Equals, "squeeze")
+	c.Check(repo.Components(), DeepEquals, []string{"contrib", "main"})
+
+	repo, err = NewPublishedRepo("", "ppa", "", nil, []string{"", ""}, []interface{}{s.snapshot, s.snapshot2}, s.factory)
+	c.Check(err, ErrorMatches, "duplicate component name: main")
+}
+
+func (s *PublishedRepoSuite) TestDuplicateComponents(c *C) {
+	_, err := NewPublishedRepo("", "ppa", "squeeze", nil, []string{"main", "main"}, []interface{}{s.snapshot, s.snapshot2}, s.factory)
+	c.Check(err, ErrorMatches, "duplicate component name: main")
 }
 
 func (s *PublishedRepoSuite) TestPublish(c *C) {
@@ -214,6 +236,7 @@ func (s *PublishedRepoSuite) TestPublish(c *C) {
 	c.Check(st["Origin"], Equals, "ppa squeeze")
 	c.Check(st["Components"], Equals, "main")
 	c.Check(st["Architectures"], Equals, "i386")
+	c.Check(st["SHA256"], Matches, "(?s).* main/Contents-i386.gz\n.*")
 
 	pf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages"))
 	c.Assert(err, IsNil)
@@ -233,6 +256,230 @@ func (s *PublishedRepoSuite) TestPublish(c *C) {
 
 	_, err = os.Stat(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb"))
 	c.Assert(err, IsNil)
+
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release.gpg"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/InRelease"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages.gz"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages.bz2"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/Contents-i386.gz"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release.tmp"), Not(PathExists))
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages.tmp"), Not(PathExists))
+}
+
+func (s *PublishedRepoSuite) TestPublishUdebs(c *C) {
+	stanza := packageStanza.Copy()
+	stanza["Package"] = "alien-arena-udeb"
+	stanza["Filename"] = "pool/main/a/alien-arena/alien-arena-udeb_7.40-2_i386.udeb"
+	udeb := NewUdebPackageFromControlFile(stanza)
+	c.Assert(s.packageCollection.Update(udeb), IsNil)
+
+	poolPath, _ := s.packagePool.Path(udeb.Files()[0].Filename, udeb.Files()[0].Checksums.MD5)
+	c.Assert(os.MkdirAll(filepath.Dir(poolPath), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(poolPath, nil, 0644), IsNil)
+
+	list, err := NewPackageListFromRefList(s.reflist, s.packageCollection, nil)
+	c.Assert(err, IsNil)
+	c.Assert(list.Add(udeb), IsNil)
+	s.localRepo.UpdateRefList(NewPackageRefListFromPackageList(list))
+
+	err = s.repo2.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	release, err := ioutil.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/maverick/Release"))
+	c.Assert(err, IsNil)
+	c.Check(string(release), Matches, "(?s).* main/debian-installer/binary-i386/Packages.gz\n.*")
+
+	packages, err := ioutil.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/maverick/main/binary-i386/Packages"))
+	c.Assert(err, IsNil)
+	c.Check(string(packages), Not(Matches), "(?s).*alien-arena-udeb.*")
+
+	pf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/maverick/main/debian-installer/binary-i386/Packages"))
+	c.Assert(err, IsNil)
+	defer pf.Close()
+
+	cfr := NewControlFileReader(pf)
+	st, err := cfr.ReadStanza()
+	c.Assert(err, IsNil)
+	c.Check(st["Package"], Equals, "alien-arena-udeb")
+	c.Check(st["Filename"], Equals, "pool/main/a/alien-arena/alien-arena-udeb_7.40-2_i386.udeb")
+
+	st, err = cfr.ReadStanza()
+	c.Assert(err, IsNil)
+	c.Check(st, IsNil)
+
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/main/a/alien-arena/alien-arena-udeb_7.40-2_i386.udeb"), PathExists)
+}
+
+func (s *PublishedRepoSuite) TestUpdateSnapshot(c *C) {
+	s.repo.UpdateSnapshot("main", s.snapshot2)
+
+	c.Check(s.repo.Sources, DeepEquals, map[string]string{"main": s.snapshot2.UUID})
+	c.Check(s.repo.sourceItems["main"].snapshot, Equals, s.snapshot2)
+
+	c.Check(func() { s.repo.UpdateSnapshot("contrib", s.snapshot2) }, Panics, "component doesn't exist")
+	c.Check(func() { s.repo2.UpdateSnapshot("main", s.snapshot2) }, Panics, "not snapshot publish")
+}
+
+func (s *PublishedRepoSuite) TestCleanupPrefixComponentFiles(c *C) {
+	err := s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	collection := s.factory.PublishedRepoCollection()
+	c.Assert(collection.Add(s.repo), IsNil)
+
+	c.Assert(s.publishedStorage.MkDir("ppa/pool/main/b/bogus"), IsNil)
+	f, err := s.publishedStorage.CreateFile("ppa/pool/main/b/bogus/bogus_1.0_i386.deb")
+	c.Assert(err, IsNil)
+	f.Close()
+
+	err = collection.CleanupPrefixComponentFiles("", "ppa", []string{"main"}, s.publishedStorage, s.factory, nil)
+	c.Assert(err, IsNil)
+
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/main/b/bogus/bogus_1.0_i386.deb"), Not(PathExists))
+}
+
+func (s *PublishedRepoSuite) TestPublishCompression(c *C) {
+	s.repo.Compression = []string{"xz"}
+
+	err := s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages.xz"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages"), Not(PathExists))
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages.gz"), Not(PathExists))
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages.bz2"), Not(PathExists))
+
+	rf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"))
+	c.Assert(err, IsNil)
+
+	st, err := NewControlFileReader(rf).ReadStanza()
+	c.Assert(err, IsNil)
+
+	c.Check(st["MD5Sum"], Matches, "(?s).* main/binary-i386/Packages.xz\n.*")
+	c.Check(st["MD5Sum"], Not(Matches), "(?s).* main/binary-i386/Packages(.gz|.bz2)?\n.*")
+
+	s.repo.Compression = []string{"lzma"}
+	err = s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Check(err, ErrorMatches, "unknown compression format: lzma")
+}
+
+func (s *PublishedRepoSuite) TestPublishAcquireByHash(c *C) {
+	s.repo.AcquireByHash = true
+	s.repo.Compression = []string{"gz"}
+
+	err := s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	rf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"))
+	c.Assert(err, IsNil)
+
+	st, err := NewControlFileReader(rf).ReadStanza()
+	c.Assert(err, IsNil)
+	c.Check(st["Acquire-By-Hash"], Equals, "yes")
+
+	checksums, err := s.publishedStorage.ChecksumsForFile("ppa/dists/squeeze/main/binary-i386/Packages.gz")
+	c.Assert(err, IsNil)
+
+	byHashPath := filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/by-hash/SHA256", checksums.SHA256)
+	c.Check(byHashPath, PathExists)
+	c.Check(s.repo.ByHashHistory, HasLen, 1)
+	c.Check(s.repo.ByHashHistory[0], HasLen, 2)
+
+	// simulate older generations with files which are gone by now
+	s.repo.ByHashHistory = append([][]string{{"main/binary-i386/by-hash/SHA256/00"}, {"main/binary-i386/by-hash/SHA256/01"}},
+		s.repo.ByHashHistory...)
+	f, err := s.publishedStorage.CreateFile("ppa/dists/squeeze/main/binary-i386/by-hash/SHA256/01")
+	c.Assert(err, IsNil)
+	f.Close()
+
+	err = s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	c.Check(s.repo.ByHashHistory, HasLen, 3)
+	c.Check(s.repo.ByHashHistory[0], DeepEquals, []string{"main/binary-i386/by-hash/SHA256/01"})
+	c.Check(byHashPath, PathExists)
+
+	err = s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	c.Check(s.repo.ByHashHistory, HasLen, 3)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/by-hash/SHA256/01"), Not(PathExists))
+	c.Check(byHashPath, PathExists)
+}
+
+func (s *PublishedRepoSuite) TestPublishReleaseFields(c *C) {
+	s.repo.Origin = "Debian Backports"
+	s.repo.Label = "Debian Backports"
+	s.repo.Suite = "squeeze-backports"
+	s.repo.Version = "6.0"
+	s.repo.NotAutomatic = true
+	s.repo.ButAutomaticUpgrades = true
+	s.repo.ValidFor = 7 * 24 * time.Hour
+
+	err := s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	rf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"))
+	c.Assert(err, IsNil)
+
+	st, err := NewControlFileReader(rf).ReadStanza()
+	c.Assert(err, IsNil)
+
+	c.Check(st["Origin"], Equals, "Debian Backports")
+	c.Check(st["Label"], Equals, "Debian Backports")
+	c.Check(st["Suite"], Equals, "squeeze-backports")
+	c.Check(st["Version"], Equals, "6.0")
+	c.Check(st["Codename"], Equals, "squeeze")
+	c.Check(st["NotAutomatic"], Equals, "yes")
+	c.Check(st["ButAutomaticUpgrades"], Equals, "yes")
+
+	date, err := time.Parse("Mon, 2 Jan 2006 15:04:05 MST", st["Date"])
+	c.Assert(err, IsNil)
+	validUntil, err := time.Parse("Mon, 2 Jan 2006 15:04:05 MST", st["Valid-Until"])
+	c.Assert(err, IsNil)
+	c.Check(validUntil.Sub(date), Equals, 7*24*time.Hour)
+
+	repo := &PublishedRepo{}
+	c.Assert(repo.Decode(s.repo.Encode()), IsNil)
+	c.Check(repo.Suite, Equals, "squeeze-backports")
+	c.Check(repo.NotAutomatic, Equals, true)
+	c.Check(repo.ValidFor, Equals, 7*24*time.Hour)
+}
+
+func (s *PublishedRepoSuite) TestPublishReproducible(c *C) {
+	s.repo.ReleaseDate = time.Date(2014, 5, 13, 16, 53, 20, 0, time.UTC)
+
+	err := s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	release1, err := ioutil.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"))
+	c.Assert(err, IsNil)
+
+	err = s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	release2, err := ioutil.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"))
+	c.Assert(err, IsNil)
+
+	c.Check(string(release1), Equals, string(release2))
+	c.Check(string(release1), Matches, "(?s).*\nDate: Tue, 13 May 2014 16:53:20 UTC\n.*")
+
+	s.repo.ReleaseDate = time.Time{}
+	os.Setenv("SOURCE_DATE_EPOCH", "1400000000")
+	defer os.Setenv("SOURCE_DATE_EPOCH", "")
+
+	err = s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	release3, err := ioutil.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"))
+	c.Assert(err, IsNil)
+
+	c.Check(string(release3), Equals, string(release1))
+
+	os.Setenv("SOURCE_DATE_EPOCH", "invalid")
+	err = s.repo.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Check(err, ErrorMatches, "unable to parse epoch .*")
 }
 
 func (s *PublishedRepoSuite) TestPublishNoSigner(c *C) {
@@ -249,21 +496,49 @@ func (s *PublishedRepoSuite) TestPublishLocalRepo(c *C) {
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/maverick/Release"), PathExists)
 }
 
+func (s *PublishedRepoSuite) TestPublishMultipleComponents(c *C) {
+	err := s.repo3.Publish(s.packagePool, s.publishedStorage, s.factory, nil, nil)
+	c.Assert(err, IsNil)
+
+	rf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "linux/dists/natty/Release"))
+	c.Assert(err, IsNil)
+
+	cfr := NewControlFileReader(rf)
+	st, err := cfr.ReadStanza()
+	c.Assert(err, IsNil)
+
+	c.Check(st["Components"], Equals, "contrib main")
+
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "linux/dists/natty/main/binary-i386/Packages"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "linux/dists/natty/contrib/binary-i386/Packages"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "linux/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "linux/pool/contrib/a/alien-arena/alien-arena-common_7.40-2_i386.deb"), PathExists)
+}
+
 func (s *PublishedRepoSuite) TestString(c *C) {
 	c.Check(s.repo.String(), Equals,
 		"ppa/squeeze (main) [] publishes [snap]: Snapshot from mirror [yandex]: http://mirror.yandex.ru/debian/ squeeze")
 	c.Check(s.repo2.String(), Equals,
 		"ppa/maverick (main) [] publishes [local1]: comment1")
-	repo, _ := NewPublishedRepo("", "squeeze", "main", []string{"s390"}, s.snapshot, s.factory)
+	repo, _ := NewPublishedRepo("", "", "squeeze", []string{"s390"}, []string{"main"}, []interface{}{s.snapshot}, s.factory)
 	c.Check(repo.String(), Equals,
 		"./squeeze (main) [s390] publishes [snap]: Snapshot from mirror [yandex]: http://mirror.yandex.ru/debian/ squeeze")
-	repo, _ = NewPublishedRepo("", "squeeze", "main", []string{"i386", "amd64"}, s.snapshot, s.factory)
+	repo, _ = NewPublishedRepo("", "", "squeeze", []string{"i386", "amd64"}, []string{"main"}, []interface{}{s.snapshot}, s.factory)
 	c.Check(repo.String(), Equals,
 		"./squeeze (main) [i386, amd64] publishes [snap]: Snapshot from mirror [yandex]: http://mirror.yandex.ru/debian/ squeeze")
+	c.Check(s.repo3.String(), Equals,
+		"linux/natty (contrib, main) [] publishes {contrib: [snap]: Snapshot from mirror [yandex]: http://mirror.yandex.ru/debian/ squeeze}, "+
+			"{main: [snap]: Snapshot from mirror [yandex]: http://mirror.yandex.ru/debian/ squeeze}")
+	repo, _ = NewPublishedRepo("s3:mirror", "ppa", "squeeze", []string{"i386"}, []string{"main"}, []interface{}{s.snapshot}, s.factory)
+	c.Check(repo.String(), Equals,
+		"s3:mirror:ppa/squeeze (main) [i386] publishes [snap]: Snapshot from mirror [yandex]: http://mirror.yandex.ru/debian/ squeeze")
 }
 
 func (s *PublishedRepoSuite) TestKey(c *C) {
 	c.Check(s.repo.Key(), DeepEquals, []byte("Uppa>>squeeze"))
+
+	s.repo.Storage = "s3:mirror"
+	c.Check(s.repo.Key(), DeepEquals, []byte("Us3:mirror:ppa>>squeeze"))
 }
 
 func (s *PublishedRepoSuite) TestEncodeDecode(c *C) {
@@ -271,7 +546,7 @@ func (s *PublishedRepoSuite) TestEncodeDecode(c *C) {
 	repo := &PublishedRepo{}
 	err := repo.Decode(encoded)
 
-	s.repo.snapshot = nil
+	s.repo.sourceItems = nil
 	c.Assert(err, IsNil)
 	c.Assert(repo, DeepEquals, s.repo)
 
@@ -279,11 +554,42 @@ func (s *PublishedRepoSuite) TestEncodeDecode(c *C) {
 	repo2 := &PublishedRepo{}
 	err = repo2.Decode(encoded2)
 
-	s.repo2.localRepo = nil
+	s.repo2.sourceItems = nil
 	c.Assert(err, IsNil)
 	c.Assert(repo2, DeepEquals, s.repo2)
 }
 
+func (s *PublishedRepoSuite) TestDecodeLegacy(c *C) {
+	var buf bytes.Buffer
+
+	encoder := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	encoder.Encode(struct {
+		UUID          string
+		Prefix        string
+		Distribution  string
+		Component     string
+		Architectures []string
+		SourceKind    string
+		SnapshotUUID  string
+	}{
+		UUID:          s.repo.UUID,
+		Prefix:        "ppa",
+		Distribution:  "squeeze",
+		Component:     "contrib",
+		Architectures: []string{"i386"},
+		SourceKind:    "snapshot",
+		SnapshotUUID:  s.snapshot.UUID,
+	})
+
+	repo := &PublishedRepo{}
+	err := repo.Decode(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Check(repo.Components(), DeepEquals, []string{"contrib"})
+	c.Check(repo.Sources, DeepEquals, map[string]string{"contrib": s.snapshot.UUID})
+	c.Check(repo.Component, Equals, "")
+	c.Check(repo.SourceUUID, Equals, "")
+}
+
 type PublishedRepoCollectionSuite struct {
 	PackageListMixinSuite
 	db                         database.Storage
@@ -312,10 +618,10 @@ func (s *PublishedRepoCollectionSuite) SetUpTest(c *C) {
 	s.localRepo = NewLocalRepo("local1", "comment1")
 	s.factory.LocalRepoCollection().Add(s.localRepo)
 
-	s.repo1, _ = NewPublishedRepo("ppa", "anaconda", "main", []string{}, s.snap1, s.factory)
-	s.repo2, _ = NewPublishedRepo("", "anaconda", "main", []string{}, s.snap2, s.factory)
-	s.repo3, _ = NewPublishedRepo("ppa", "anaconda", "main", []string{}, s.snap2, s.factory)
-	s.repo4, _ = NewPublishedRepo("ppa", "precise", "main", []string{}, s.localRepo, s.factory)
+	s.repo1, _ = NewPublishedRepo("", "ppa", "anaconda", []string{}, []string{"main"}, []interface{}{s.snap1}, s.factory)
+	s.repo2, _ = NewPublishedRepo("", "", "anaconda", []string{}, []string{"main"}, []interface{}{s.snap2}, s.factory)
+	s.repo3, _ = NewPublishedRepo("", "ppa", "anaconda", []string{}, []string{"main"}, []interface{}{s.snap2}, s.factory)
+	s.repo4, _ = NewPublishedRepo("", "ppa", "precise", []string{}, []string{"main"}, []interface{}{s.localRepo}, s.factory)
 
 	s.collection = s.factory.PublishedRepoCollection()
 }
@@ -324,8 +630,8 @@ func (s *PublishedRepoCollectionSuite) TearDownTest(c *C) {
 	s.db.Close()
 }
 
-func (s *PublishedRepoCollectionSuite) TestAddByPrefixDistribution(c *C) {
-	r, err := s.collection.ByPrefixDistribution("ppa", "anaconda")
+func (s *PublishedRepoCollectionSuite) TestAddByStoragePrefixDistribution(c *C) {
+	r, err := s.collection.ByStoragePrefixDistribution("", "ppa", "anaconda")
 	c.Assert(err, ErrorMatches, "*.not found")
 
 	c.Assert(s.collection.Add(s.repo1), IsNil)
@@ -336,7 +642,18 @@ func (s *PublishedRepoCollectionSuite) TestAddByPrefixDistribution(c *C) {
 	c.Assert(s.collection.CheckDuplicate(s.repo3), Equals, s.repo1)
 	c.Assert(s.collection.Add(s.repo4), IsNil)
 
-	r, err = s.collection.ByPrefixDistribution("ppa", "anaconda")
+	s.repo3.Storage = "s3:mirror"
+	c.Assert(s.collection.CheckDuplicate(s.repo3), IsNil)
+	c.Assert(s.collection.Add(s.repo3), IsNil)
+
+	_, err = s.collection.ByStoragePrefixDistribution("s3:other", "ppa", "anaconda")
+	c.Assert(err, ErrorMatches, "published repo with storage:prefix/distribution s3:other:ppa/anaconda not found")
+
+	r, err = s.collection.ByStoragePrefixDistribution("s3:mirror", "ppa", "anaconda")
+	c.Assert(err, IsNil)
+	c.Assert(r, Equals, s.repo3)
+
+	r, err = s.collection.ByStoragePrefixDistribution("", "ppa", "anaconda")
 	c.Assert(err, IsNil)
 
 	err = s.collection.LoadComplete(r, s.factory)
@@ -344,7 +661,7 @@ func (s *PublishedRepoCollectionSuite) TestAddByPrefixDistribution(c *C) {
 	c.Assert(r.String(), Equals, s.repo1.String())
 
 	collection := NewPublishedRepoCollection(s.db)
-	r, err = collection.ByPrefixDistribution("ppa", "anaconda")
+	r, err = collection.ByStoragePrefixDistribution("", "ppa", "anaconda")
 	c.Assert(err, IsNil)
 
 	err = s.collection.LoadComplete(r, s.factory)
@@ -367,21 +684,23 @@ func (s *PublishedRepoCollectionSuite) TestByUUID(c *C) {
 }
 
 func (s *PublishedRepoCollectionSuite) TestUpdateLoadComplete(c *C) {
+	s.repo1.SigningKeys = []string{"21DBB89C16DB3E6D", "D5B36F2B"}
 	c.Assert(s.collection.Update(s.repo1), IsNil)
 	c.Assert(s.collection.Update(s.repo4), IsNil)
 
 	collection := NewPublishedRepoCollection(s.db)
-	r, err := collection.ByPrefixDistribution("ppa", "anaconda")
+	r, err := collection.ByStoragePrefixDistribution("", "ppa", "anaconda")
 	c.Assert(err, IsNil)
-	c.Assert(r.snapshot, IsNil)
+	c.Check(r.SigningKeys, DeepEquals, []string{"21DBB89C16DB3E6D", "D5B36F2B"})
+	c.Assert(r.sourceItems["main"].snapshot, IsNil)
 	c.Assert(s.collection.LoadComplete(r, s.factory), IsNil)
-	c.Assert(r.snapshot.UUID, Equals, s.repo1.snapshot.UUID)
+	c.Assert(r.sourceItems["main"].snapshot.UUID, Equals, s.repo1.sourceItems["main"].snapshot.UUID)
 
-	r, err = collection.ByPrefixDistribution("ppa", "precise")
+	r, err = collection.ByStoragePrefixDistribution("", "ppa", "precise")
 	c.Assert(err, IsNil)
-	c.Assert(r.localRepo, IsNil)
+	c.Assert(r.sourceItems["main"].localRepo, IsNil)
 	c.Assert(s.collection.LoadComplete(r, s.factory), IsNil)
-	c.Assert(r.localRepo.UUID, Equals, s.repo4.localRepo.UUID)
+	c.Assert(r.sourceItems["main"].localRepo.UUID, Equals, s.repo4.sourceItems["main"].localRepo.UUID)
 }
 
 func (s *PublishedRepoCollectionSuite) TestForEachAndLen(c *C) {
@@ -437,10 +756,10 @@ func (s *PublishedRepoRemoveSuite) SetUpTest(c *C) {
 
 	s.snapshotCollection.Add(s.snap1)
 
-	s.repo1, _ = NewPublishedRepo("ppa", "anaconda", "main", []string{}, s.snap1, s.factory)
-	s.repo2, _ = NewPublishedRepo("", "anaconda", "main", []string{}, s.snap1, s.factory)
-	s.repo3, _ = NewPublishedRepo("ppa", "meduza", "main", []string{}, s.snap1, s.factory)
-	s.repo4, _ = NewPublishedRepo("ppa", "osminog", "contrib", []string{}, s.snap1, s.factory)
+	s.repo1, _ = NewPublishedRepo("", "ppa", "anaconda", []string{}, []string{"main"}, []interface{}{s.snap1}, s.factory)
+	s.repo2, _ = NewPublishedRepo("", "", "anaconda", []string{}, []string{"main"}, []interface{}{s.snap1}, s.factory)
+	s.repo3, _ = NewPublishedRepo("", "ppa", "meduza", []string{}, []string{"main"}, []interface{}{s.snap1}, s.factory)
+	s.repo4, _ = NewPublishedRepo("", "ppa", "osminog", []string{}, []string{"contrib"}, []interface{}{s.snap1}, s.factory)
 
 	s.collection = s.factory.PublishedRepoCollection()
 	s.collection.Add(s.repo1)
@@ -464,7 +783,7 @@ func (s *PublishedRepoRemoveSuite) TearDownTest(c *C) {
 }
 
 func (s *PublishedRepoRemoveSuite) TestRemoveFilesOnlyDist(c *C) {
-	s.repo1.RemoveFiles(s.publishedStorage, false, false)
+	s.repo1.RemoveFiles(s.publishedStorage, false, []string{}, nil)
 
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/anaconda"), Not(PathExists))
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/meduza"), PathExists)
@@ -476,7 +795,7 @@ func (s *PublishedRepoRemoveSuite) TestRemoveFilesOnlyDist(c *C) {
 }
 
 func (s *PublishedRepoRemoveSuite) TestRemoveFilesWithPool(c *C) {
-	s.repo1.RemoveFiles(s.publishedStorage, false, true)
+	s.repo1.RemoveFiles(s.publishedStorage, false, []string{"main"}, nil)
 
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/anaconda"), Not(PathExists))
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/meduza"), PathExists)
@@ -488,7 +807,7 @@ func (s *PublishedRepoRemoveSuite) TestRemoveFilesWithPool(c *C) {
 }
 
 func (s *PublishedRepoRemoveSuite) TestRemoveFilesWithPrefix(c *C) {
-	s.repo1.RemoveFiles(s.publishedStorage, true, true)
+	s.repo1.RemoveFiles(s.publishedStorage, true, []string{"main"}, nil)
 
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/anaconda"), Not(PathExists))
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/meduza"), Not(PathExists))
@@ -500,7 +819,7 @@ func (s *PublishedRepoRemoveSuite) TestRemoveFilesWithPrefix(c *C) {
 }
 
 func (s *PublishedRepoRemoveSuite) TestRemoveFilesWithPrefixRoot(c *C) {
-	s.repo2.RemoveFiles(s.publishedStorage, true, true)
+	s.repo2.RemoveFiles(s.publishedStorage, true, []string{"main"}, nil)
 
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/anaconda"), PathExists)
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/meduza"), PathExists)
@@ -511,14 +830,14 @@ func (s *PublishedRepoRemoveSuite) TestRemoveFilesWithPrefixRoot(c *C) {
 }
 
 func (s *PublishedRepoRemoveSuite) TestRemoveRepo1and2(c *C) {
-	err := s.collection.Remove(s.publishedStorage, "ppa", "anaconda")
+	err := s.collection.Remove(s.publishedStorage, "", "ppa", "anaconda", nil)
 	c.Check(err, IsNil)
 
-	_, err = s.collection.ByPrefixDistribution("ppa", "anaconda")
+	_, err = s.collection.ByStoragePrefixDistribution("", "ppa", "anaconda")
 	c.Check(err, ErrorMatches, ".*not found")
 
 	collection := NewPublishedRepoCollection(s.db)
-	_, err = collection.ByPrefixDistribution("ppa", "anaconda")
+	_, err = collection.ByStoragePrefixDistribution("", "ppa", "anaconda")
 	c.Check(err, ErrorMatches, ".*not found")
 
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/anaconda"), Not(PathExists))
@@ -529,10 +848,10 @@ func (s *PublishedRepoRemoveSuite) TestRemoveRepo1and2(c *C) {
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "dists/anaconda"), PathExists)
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "pool/main"), PathExists)
 
-	err = s.collection.Remove(s.publishedStorage, "ppa", "anaconda")
+	err = s.collection.Remove(s.publishedStorage, "", "ppa", "anaconda", nil)
 	c.Check(err, ErrorMatches, ".*not found")
 
-	err = s.collection.Remove(s.publishedStorage, "ppa", "meduza")
+	err = s.collection.Remove(s.publishedStorage, "", "ppa", "meduza", nil)
 	c.Check(err, IsNil)
 
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/anaconda"), Not(PathExists))
@@ -545,14 +864,14 @@ func (s *PublishedRepoRemoveSuite) TestRemoveRepo1and2(c *C) {
 }
 
 func (s *PublishedRepoRemoveSuite) TestRemoveRepo3(c *C) {
-	err := s.collection.Remove(s.publishedStorage, ".", "anaconda")
+	err := s.collection.Remove(s.publishedStorage, "", ".", "anaconda", nil)
 	c.Check(err, IsNil)
 
-	_, err = s.collection.ByPrefixDistribution(".", "anaconda")
+	_, err = s.collection.ByStoragePrefixDistribution("", ".", "anaconda")
 	c.Check(err, ErrorMatches, ".*not found")
 
 	collection := NewPublishedRepoCollection(s.db)
-	_, err = collection.ByPrefixDistribution(".", "anaconda")
+	_, err = collection.ByStoragePrefixDistribution("", ".", "anaconda")
 	c.Check(err, ErrorMatches, ".*not found")
 
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/anaconda"), PathExists)
@@ -563,3 +882,20 @@ func (s *PublishedRepoRemoveSuite) TestRemoveRepo3(c *C) {
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "dists/"), Not(PathExists))
 	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "pool/"), Not(PathExists))
 }
+
+func (s *PublishedRepoRemoveSuite) TestRemoveRepoMultipleComponents(c *C) {
+	repo5, _ := NewPublishedRepo("", "ppa", "karmic", []string{}, []string{"main", "contrib", "non-free"},
+		[]interface{}{s.snap1, s.snap1, s.snap1}, s.factory)
+	s.collection.Add(repo5)
+	s.publishedStorage.MkDir("ppa/dists/karmic")
+	s.publishedStorage.MkDir("ppa/pool/non-free")
+
+	err := s.collection.Remove(s.publishedStorage, "", "ppa", "karmic", nil)
+	c.Check(err, IsNil)
+
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/karmic"), Not(PathExists))
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/anaconda"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/main"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/contrib"), PathExists)
+	c.Check(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/non-free"), Not(PathExists))
+}
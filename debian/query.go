@@ -0,0 +1,560 @@
+package debian
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// PackageQuery is condition on packages, parsed from query language:
+//
+//	query     := or
+//	or        := and { '|' and }
+//	and       := unary { ',' unary }
+//	unary     := '!' unary | '(' or ')' | condition
+//	condition := package [ '(' relation ')' ] [ '{' architecture '}' ]
+//	           | field [ '(' relation ')' ]
+//	           | package '_' version '_' architecture
+//	relation  := [ '=' | '>=' | '<=' | '>>' | '<<' | '%' | '~' ] value
+//
+// Package names are lowercase, while field names start with capital letter
+// (e.g. Priority, Section) or '$' for special fields: $Source, $SourceVersion,
+// $Architecture, $Version, $PackageType. Field without relation matches packages
+// having that field. Relation '%' is shell-style pattern match, '~' is regular
+// expression match.
+type PackageQuery interface {
+	// Matches checks whether package matches query
+	Matches(p *Package) bool
+	// Fast returns true if query could be evaluated using list index
+	Fast() bool
+	// Query returns packages from indexed list matching query, should be called only if Fast()
+	Query(list *PackageList) *PackageList
+	// String returns query in canonical form
+	String() string
+}
+
+// OrQuery is L | R
+type OrQuery struct {
+	L, R PackageQuery
+}
+
+// AndQuery is L, R
+type AndQuery struct {
+	L, R PackageQuery
+}
+
+// NotQuery is !Q
+type NotQuery struct {
+	Q PackageQuery
+}
+
+// FieldQuery is condition on package field value
+type FieldQuery struct {
+	Field    string
+	Relation int
+	Value    string
+	Regexp   *regexp.Regexp
+}
+
+// DependencyQuery is condition in dependency format: pkg (>= version) {arch}
+type DependencyQuery struct {
+	Dep Dependency
+}
+
+// PkgQuery is exact package reference: name_version_arch
+type PkgQuery struct {
+	Pkg     string
+	Version string
+	Arch    string
+}
+
+// Verify interface
+var (
+	_ PackageQuery = &OrQuery{}
+	_ PackageQuery = &AndQuery{}
+	_ PackageQuery = &NotQuery{}
+	_ PackageQuery = &FieldQuery{}
+	_ PackageQuery = &DependencyQuery{}
+	_ PackageQuery = &PkgQuery{}
+)
+
+// Matches if any of L, R matches
+func (q *OrQuery) Matches(p *Package) bool {
+	return q.L.Matches(p) || q.R.Matches(p)
+}
+
+// Fast is true only if both parts are fast
+func (q *OrQuery) Fast() bool {
+	return q.L.Fast() && q.R.Fast()
+}
+
+// Query merges results of L and R
+func (q *OrQuery) Query(list *PackageList) *PackageList {
+	result := q.L.Query(list)
+	q.R.Query(list).ForEach(func(p *Package) error {
+		return result.Add(p)
+	})
+	return result
+}
+
+// String interface
+func (q *OrQuery) String() string {
+	return fmt.Sprintf("(%s | %s)", q.L, q.R)
+}
+
+// Matches if both of L, R match
+func (q *AndQuery) Matches(p *Package) bool {
+	return q.L.Matches(p) && q.R.Matches(p)
+}
+
+// Fast is true if any of the parts is fast
+func (q *AndQuery) Fast() bool {
+	return q.L.Fast() || q.R.Fast()
+}
+
+// Query narrows down results of fast part with other part
+func (q *AndQuery) Query(list *PackageList) *PackageList {
+	if q.L.Fast() {
+		return q.L.Query(list).Scan(q.R)
+	}
+	return q.R.Query(list).Scan(q.L)
+}
+
+// String interface
+func (q *AndQuery) String() string {
+	return fmt.Sprintf("(%s, %s)", q.L, q.R)
+}
+
+// Matches if Q doesn't match
+func (q *NotQuery) Matches(p *Package) bool {
+	return !q.Q.Matches(p)
+}
+
+// Fast is false
+func (q *NotQuery) Fast() bool {
+	return false
+}
+
+// Query is not supported
+func (q *NotQuery) Query(list *PackageList) *PackageList {
+	panic("not fast query")
+}
+
+// String interface
+func (q *NotQuery) String() string {
+	return fmt.Sprintf("!%s", q.Q)
+}
+
+// Matches compares field value according to relation
+func (q *FieldQuery) Matches(p *Package) bool {
+	if q.Field == "$Architecture" && q.Relation == VersionEqual {
+		return p.MatchesArchitecture(q.Value)
+	}
+
+	value := p.GetField(q.Field)
+
+	switch q.Relation {
+	case VersionDontCare:
+		return value != ""
+	case VersionEqual:
+		return value == q.Value
+	case VersionPatternMatch:
+		matched, err := filepath.Match(q.Value, value)
+		return err == nil && matched
+	case VersionRegexp:
+		return q.Regexp.MatchString(value)
+	}
+
+	if value == "" {
+		return false
+	}
+
+	r := CompareVersions(value, q.Value)
+	switch q.Relation {
+	case VersionLess:
+		return r < 0
+	case VersionGreater:
+		return r > 0
+	case VersionLessOrEqual:
+		return r <= 0
+	case VersionGreaterOrEqual:
+		return r >= 0
+	}
+
+	panic("unknown relation")
+}
+
+// Fast is false
+func (q *FieldQuery) Fast() bool {
+	return false
+}
+
+// Query is not supported
+func (q *FieldQuery) Query(list *PackageList) *PackageList {
+	panic("not fast query")
+}
+
+// String interface
+func (q *FieldQuery) String() string {
+	if q.Relation == VersionDontCare {
+		return q.Field
+	}
+	return fmt.Sprintf("%s (%s %s)", q.Field, relationString(q.Relation), q.Value)
+}
+
+// Matches if package matches dependency
+func (q *DependencyQuery) Matches(p *Package) bool {
+	return p.MatchesDependency(q.Dep)
+}
+
+// Fast is true
+func (q *DependencyQuery) Fast() bool {
+	return true
+}
+
+// Query looks up packages by name in the index
+func (q *DependencyQuery) Query(list *PackageList) *PackageList {
+	if !list.indexed {
+		panic("list not indexed, can't query")
+	}
+
+	result := NewPackageList()
+
+	i := sort.Search(len(list.packagesIndex), func(j int) bool { return list.packagesIndex[j].Name >= q.Dep.Pkg })
+
+	for i < len(list.packagesIndex) && list.packagesIndex[i].Name == q.Dep.Pkg {
+		p := list.packagesIndex[i]
+		if p.MatchesDependency(q.Dep) {
+			result.Add(p)
+		}
+		i++
+	}
+
+	return result
+}
+
+// String interface
+func (q *DependencyQuery) String() string {
+	result := q.Dep.Pkg
+	if q.Dep.Relation != VersionDontCare {
+		result += fmt.Sprintf(" (%s %s)", relationString(q.Dep.Relation), q.Dep.Version)
+	}
+	if q.Dep.Architecture != "" {
+		result += fmt.Sprintf(" {%s}", q.Dep.Architecture)
+	}
+	return result
+}
+
+// Matches on name, version and architecture
+func (q *PkgQuery) Matches(p *Package) bool {
+	return p.Name == q.Pkg && p.Version == q.Version && p.Architecture == q.Arch
+}
+
+// Fast is true
+func (q *PkgQuery) Fast() bool {
+	return true
+}
+
+// Query looks up package by key
+func (q *PkgQuery) Query(list *PackageList) *PackageList {
+	result := NewPackageList()
+
+	key := "P" + q.Arch + " " + q.Pkg + " " + q.Version
+
+	// udebs are stored under distinct key, so look up both
+	for _, k := range []string{key, key + " udeb"} {
+		p := list.packages[k]
+		if p != nil {
+			result.Add(p)
+		}
+	}
+
+	return result
+}
+
+// String interface
+func (q *PkgQuery) String() string {
+	return fmt.Sprintf("%s_%s_%s", q.Pkg, q.Version, q.Arch)
+}
+
+func relationString(relation int) string {
+	switch relation {
+	case VersionEqual:
+		return "="
+	case VersionGreater:
+		return ">>"
+	case VersionLess:
+		return "<<"
+	case VersionGreaterOrEqual:
+		return ">="
+	case VersionLessOrEqual:
+		return "<="
+	case VersionPatternMatch:
+		return "%"
+	case VersionRegexp:
+		return "~"
+	}
+	panic("unknown relation")
+}
+
+// queryParser is recursive descent parser of query language
+type queryParser struct {
+	input string
+	pos   int
+}
+
+// ParseQuery parses query language into PackageQuery
+func ParseQuery(query string) (PackageQuery, error) {
+	parser := &queryParser{input: query}
+
+	result, err := parser.parseOr()
+	if err == nil {
+		parser.skipSpace()
+		if parser.pos < len(parser.input) {
+			err = parser.unexpected()
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse query: %s: %s", query, err)
+	}
+
+	return result, nil
+}
+
+func (parser *queryParser) skipSpace() {
+	for parser.pos < len(parser.input) && unicode.IsSpace(rune(parser.input[parser.pos])) {
+		parser.pos++
+	}
+}
+
+// peek returns next non-space character or 0 at the end of input
+func (parser *queryParser) peek() byte {
+	parser.skipSpace()
+	if parser.pos < len(parser.input) {
+		return parser.input[parser.pos]
+	}
+	return 0
+}
+
+func (parser *queryParser) unexpected() error {
+	if parser.pos >= len(parser.input) {
+		return fmt.Errorf("unexpected end of query")
+	}
+	return fmt.Errorf("unexpected '%c' at position %d", parser.input[parser.pos], parser.pos+1)
+}
+
+func (parser *queryParser) parseOr() (PackageQuery, error) {
+	result, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.peek() == '|' {
+		parser.pos++
+
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		result = &OrQuery{L: result, R: right}
+	}
+
+	return result, nil
+}
+
+func (parser *queryParser) parseAnd() (PackageQuery, error) {
+	result, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.peek() == ',' {
+		parser.pos++
+
+		right, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		result = &AndQuery{L: result, R: right}
+	}
+
+	return result, nil
+}
+
+func (parser *queryParser) parseUnary() (PackageQuery, error) {
+	switch parser.peek() {
+	case '!':
+		parser.pos++
+
+		q, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotQuery{Q: q}, nil
+	case '(':
+		parser.pos++
+
+		q, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if parser.peek() != ')' {
+			return nil, parser.unexpected()
+		}
+		parser.pos++
+		return q, nil
+	}
+
+	return parser.parseCondition()
+}
+
+// readWord reads package or field name
+func (parser *queryParser) readWord() string {
+	start := parser.pos
+	for parser.pos < len(parser.input) && !unicode.IsSpace(rune(parser.input[parser.pos])) &&
+		!strings.ContainsRune("|,!(){}", rune(parser.input[parser.pos])) {
+		parser.pos++
+	}
+	return parser.input[start:parser.pos]
+}
+
+// readEnclosed reads text enclosed in open & close characters (allowing nested pairs
+// inside, e.g. in regular expressions), opening character should be next
+func (parser *queryParser) readEnclosed(open, close byte) (string, error) {
+	parser.pos++
+	start := parser.pos
+
+	for depth := 1; parser.pos < len(parser.input); parser.pos++ {
+		switch parser.input[parser.pos] {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				parser.pos++
+				return strings.TrimSpace(parser.input[start : parser.pos-1]), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("missing '%c'", close)
+}
+
+func (parser *queryParser) parseCondition() (PackageQuery, error) {
+	parser.skipSpace()
+
+	name := parser.readWord()
+	if name == "" {
+		return nil, parser.unexpected()
+	}
+
+	var (
+		relation        = VersionDontCare
+		value, arch     string
+		hasArchitecture bool
+		err             error
+	)
+
+	if parser.peek() == '(' {
+		var condition string
+
+		condition, err = parser.readEnclosed('(', ')')
+		if err != nil {
+			return nil, err
+		}
+
+		relation, value, err = parseRelation(condition)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if parser.peek() == '{' {
+		arch, err = parser.readEnclosed('{', '}')
+		if err != nil {
+			return nil, err
+		}
+		hasArchitecture = true
+	}
+
+	if name[0] == '$' || unicode.IsUpper(rune(name[0])) {
+		// field query
+		if hasArchitecture {
+			return nil, fmt.Errorf("architecture can't be specified for field %s", name)
+		}
+
+		result := &FieldQuery{Field: name, Relation: relation, Value: value}
+		if relation == VersionRegexp {
+			result.Regexp, err = regexp.Compile(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	if relation == VersionDontCare && !hasArchitecture {
+		// could be package reference name_version_arch
+		if i, j := strings.Index(name, "_"), strings.LastIndex(name, "_"); i != -1 && j > i {
+			return &PkgQuery{Pkg: name[:i], Version: name[i+1 : j], Arch: name[j+1:]}, nil
+		}
+	}
+
+	dep := &DependencyQuery{Dep: Dependency{Pkg: name, Relation: relation, Version: value, Architecture: arch}}
+
+	if relation == VersionPatternMatch || relation == VersionRegexp {
+		// version pattern is matched as field on top of package lookup
+		dep.Dep.Relation, dep.Dep.Version = VersionDontCare, ""
+
+		version := &FieldQuery{Field: "$Version", Relation: relation, Value: value}
+		if relation == VersionRegexp {
+			version.Regexp, err = regexp.Compile(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &AndQuery{L: dep, R: version}, nil
+	}
+
+	return dep, nil
+}
+
+// parseRelation parses condition like '>= 1.0' into relation and value
+func parseRelation(condition string) (int, string, error) {
+	relations := []struct {
+		op       string
+		relation int
+	}{
+		{">=", VersionGreaterOrEqual},
+		{"<=", VersionLessOrEqual},
+		{">>", VersionGreater},
+		{"<<", VersionLess},
+		{">", VersionGreaterOrEqual},
+		{"<", VersionLessOrEqual},
+		{"=", VersionEqual},
+		{"%", VersionPatternMatch},
+		{"~", VersionRegexp},
+	}
+
+	relation := VersionEqual
+	for _, r := range relations {
+		if strings.HasPrefix(condition, r.op) {
+			relation = r.relation
+			condition = strings.TrimSpace(condition[len(r.op):])
+			break
+		}
+	}
+
+	if condition == "" {
+		return 0, "", fmt.Errorf("missing value in condition")
+	}
+
+	return relation, condition, nil
+}
@@ -0,0 +1,163 @@
+package debian
+
+import (
+	. "launchpad.net/gocheck"
+	"sort"
+	"strings"
+)
+
+type QuerySuite struct {
+	list *PackageList
+}
+
+var _ = Suite(&QuerySuite{})
+
+func (s *QuerySuite) SetUpTest(c *C) {
+	s.list = NewPackageList()
+
+	s.list.Add(NewPackageFromControlFile(packageStanza.Copy()))
+
+	stanza := packageStanza.Copy()
+	stanza["Package"] = "alien-arena-dbg"
+	stanza["Section"] = "debug"
+	stanza["Priority"] = "optional"
+	s.list.Add(NewPackageFromControlFile(stanza))
+
+	stanza = packageStanza.Copy()
+	stanza["Package"] = "alien-arena-data"
+	stanza["Version"] = "7.51-1"
+	stanza["Source"] = "alien-arena (7.51)"
+	stanza["Architecture"] = "all"
+	s.list.Add(NewPackageFromControlFile(stanza))
+
+	stanza = packageStanza.Copy()
+	stanza["Package"] = "libc6"
+	stanza["Source"] = "eglibc"
+	stanza["Version"] = "2.13-38"
+	stanza["Architecture"] = "amd64"
+	stanza["Priority"] = "required"
+	stanza["Section"] = "libs"
+	s.list.Add(NewPackageFromControlFile(stanza))
+
+	s.list.PrepareIndex()
+}
+
+func (s *QuerySuite) query(c *C, query string) string {
+	q, err := ParseQuery(query)
+	c.Assert(err, IsNil)
+
+	result := []string{}
+	s.list.Query(q).ForEach(func(p *Package) error {
+		result = append(result, p.String())
+		return nil
+	})
+
+	// fast and full scan should agree
+	scanned := s.list.Scan(q).Len()
+	c.Check(scanned, Equals, len(result), Commentf("query %s", query))
+
+	sort.Strings(result)
+	return strings.Join(result, " ")
+}
+
+func (s *QuerySuite) TestParse(c *C) {
+	for _, test := range []struct {
+		query, canonical string
+	}{
+		{"nginx", "nginx"},
+		{" nginx (>= 1.4) ", "nginx (>= 1.4)"},
+		{"nginx (1.4) {amd64}", "nginx (= 1.4) {amd64}"},
+		{"nginx_1.4.1-1_amd64", "nginx_1.4.1-1_amd64"},
+		{"nginx | apache2, !Priority", "(nginx | (apache2, !Priority))"},
+		{"(nginx | apache2), !Priority", "((nginx | apache2), !Priority)"},
+		{"!!nginx", "!!nginx"},
+		{"Priority (required)", "Priority (= required)"},
+		{"$Source (openssl)", "$Source (= openssl)"},
+		{"Section (% admin*)", "Section (% admin*)"},
+		{"Maintainer (~ ^(Debian|Ubuntu) .*)", "Maintainer (~ ^(Debian|Ubuntu) .*)"},
+		{"Installed-Size (<< 1000)", "Installed-Size (<< 1000)"},
+		{"nginx (% 1.4*)", "(nginx, $Version (% 1.4*))"},
+	} {
+		q, err := ParseQuery(test.query)
+		c.Assert(err, IsNil, Commentf("query %s", test.query))
+		c.Check(q.String(), Equals, test.canonical)
+	}
+}
+
+func (s *QuerySuite) TestParseErrors(c *C) {
+	for _, test := range []struct {
+		query, err string
+	}{
+		{"", "unable to parse query: : unexpected end of query"},
+		{"nginx |", ".*: unexpected end of query"},
+		{"nginx >= 1.4", ".*: unexpected '>' at position 7"},
+		{"(nginx | apache2", ".*: unexpected end of query"},
+		{"nginx)", ".*: unexpected '\\)' at position 6"},
+		{"nginx (>= 1.4", ".*: missing '\\)'"},
+		{"nginx (>=)", ".*: missing value in condition"},
+		{"Priority (required) {i386}", ".*: architecture can't be specified for field Priority"},
+		{"Section (~ a[)", ".*: error parsing regexp.*"},
+	} {
+		_, err := ParseQuery(test.query)
+		c.Check(err, ErrorMatches, test.err, Commentf("query %s", test.query))
+	}
+}
+
+func (s *QuerySuite) TestMatches(c *C) {
+	c.Check(s.query(c, "alien-arena-common"), Equals, "alien-arena-common_7.40-2_i386")
+	c.Check(s.query(c, "alien-arena-common | libc6 (>> 2.13)"), Equals, "alien-arena-common_7.40-2_i386 libc6_2.13-38_amd64")
+	c.Check(s.query(c, "alien-arena-data_7.51-1_all"), Equals, "alien-arena-data_7.51-1_all")
+	c.Check(s.query(c, "Priority (required)"), Equals, "libc6_2.13-38_amd64")
+	c.Check(s.query(c, "!Priority (extra)"), Equals, "alien-arena-dbg_7.40-2_i386 libc6_2.13-38_amd64")
+	c.Check(s.query(c, "$Source (alien-arena), !Section (debug)"), Equals, "alien-arena-common_7.40-2_i386 alien-arena-data_7.51-1_all")
+	c.Check(s.query(c, "$SourceVersion (7.51)"), Equals, "alien-arena-data_7.51-1_all")
+	c.Check(s.query(c, "$Architecture (amd64)"), Equals, "alien-arena-data_7.51-1_all libc6_2.13-38_amd64")
+	c.Check(s.query(c, "$Version (>= 7.40-2)"), Equals, "alien-arena-common_7.40-2_i386 alien-arena-data_7.51-1_all alien-arena-dbg_7.40-2_i386")
+	c.Check(s.query(c, "$PackageType (deb)"), Equals, "alien-arena-common_7.40-2_i386 alien-arena-data_7.51-1_all alien-arena-dbg_7.40-2_i386 libc6_2.13-38_amd64")
+	c.Check(s.query(c, "Section (% contrib/*)"), Equals, "alien-arena-common_7.40-2_i386 alien-arena-data_7.51-1_all")
+	c.Check(s.query(c, "Name (~ .*-dbg$)"), Equals, "")
+	c.Check(s.query(c, "Package (~ .*-d(bg|ata)$)"), Equals, "alien-arena-data_7.51-1_all alien-arena-dbg_7.40-2_i386")
+	c.Check(s.query(c, "Homepage, Installed-Size (<< 1000), libc6"), Equals, "libc6_2.13-38_amd64")
+	c.Check(s.query(c, "alien-arena-data (% 7.5*) | alien-arena-dbg (~ ^7\\.40)"), Equals, "alien-arena-data_7.51-1_all alien-arena-dbg_7.40-2_i386")
+	c.Check(s.query(c, "(libc6 | alien-arena-dbg), Priority (optional)"), Equals, "alien-arena-dbg_7.40-2_i386")
+}
+
+func (s *QuerySuite) TestMatchesUdeb(c *C) {
+	stanza := packageStanza.Copy()
+	stanza["Package"] = "libc6-udeb"
+	stanza["Version"] = "2.13-38"
+	stanza["Architecture"] = "amd64"
+	s.list.Add(NewUdebPackageFromControlFile(stanza))
+
+	s.list.Add(NewUdebPackageFromControlFile(packageStanza.Copy()))
+
+	c.Check(s.query(c, "libc6-udeb_2.13-38_amd64"), Equals, "libc6-udeb_2.13-38_amd64")
+	c.Check(s.query(c, "alien-arena-common_7.40-2_i386"), Equals, "alien-arena-common_7.40-2_i386 alien-arena-common_7.40-2_i386")
+	c.Check(s.query(c, "$PackageType (udeb)"), Equals, "alien-arena-common_7.40-2_i386 libc6-udeb_2.13-38_amd64")
+}
+
+func (s *QuerySuite) TestGetField(c *C) {
+	p := NewPackageFromControlFile(packageStanza.Copy())
+
+	c.Check(p.GetField("$Source"), Equals, "alien-arena")
+	c.Check(p.GetField("$SourceVersion"), Equals, "7.40-2")
+	c.Check(p.GetField("$PackageType"), Equals, "deb")
+	c.Check(p.GetField("Package"), Equals, "alien-arena-common")
+	c.Check(p.GetField("Depends"), Equals, "libc6 (>= 2.7), alien-arena-data (>= 7.40)")
+	c.Check(p.GetField("Size"), Equals, "187518")
+	c.Check(p.GetField("Section"), Equals, "contrib/games")
+	c.Check(p.GetField("Nonexistent"), Equals, "")
+
+	source, err := NewSourcePackageFromControlFile(s.sourceStanza(c))
+	c.Assert(err, IsNil)
+	c.Check(source.GetField("$PackageType"), Equals, "source")
+	c.Check(source.GetField("$Source"), Equals, "access-modifier-checker")
+	c.Check(source.GetField("Architecture"), Equals, "all")
+	c.Check(source.GetField("$Architecture"), Equals, "source")
+}
+
+func (s *QuerySuite) sourceStanza(c *C) Stanza {
+	stanza, err := NewControlFileReader(strings.NewReader(sourcePackageMeta)).ReadStanza()
+	c.Assert(err, IsNil)
+	return stanza
+}
@@ -84,6 +84,14 @@ func (l *PackageRefList) ForEach(handler func([]byte) error) error {
 	return err
 }
 
+// Has checks whether package is part of reflist
+func (l *PackageRefList) Has(p *Package) bool {
+	key := p.Key("")
+
+	i := sort.Search(len(l.Refs), func(j int) bool { return bytes.Compare(l.Refs[j], key) >= 0 })
+	return i < len(l.Refs) && bytes.Equal(l.Refs[i], key)
+}
+
 // Substract returns all packages in l that are not in r
 func (l *PackageRefList) Substract(r *PackageRefList) *PackageRefList {
 	result := &PackageRefList{Refs: make([][]byte, 0, 128)}
@@ -261,7 +269,9 @@ func (l *PackageRefList) Merge(r *PackageRefList, overrideMatching bool) (result
 				partsR := bytes.Split(rr, []byte(" "))
 				archR, nameR := partsR[0][1:], partsR[1]
 
-				if bytes.Compare(archL, archR) == 0 && bytes.Compare(nameL, nameR) == 0 {
+				// udeb refs have extra trailing part, so len() check makes sure
+				// that .debs and udebs never override each other
+				if bytes.Compare(archL, archR) == 0 && bytes.Compare(nameL, nameR) == 0 && len(partsL) == len(partsR) {
 					// override with package from the right
 					result.Refs = append(result.Refs, r.Refs[ir])
 					il++
@@ -284,3 +294,91 @@ func (l *PackageRefList) Merge(r *PackageRefList, overrideMatching bool) (result
 
 	return
 }
+
+// parseRef splits package key into architecture, name and version, udeb flag is
+// set for udeb package keys
+func parseRef(ref []byte) (arch, name, version []byte, udeb bool) {
+	parts := bytes.Split(ref, []byte(" "))
+	return parts[0][1:], parts[1], parts[2], len(parts) > 3
+}
+
+// FilterLatestRefs returns reflist which keeps only the latest version of each package
+// (by name and architecture, .debs and udebs are considered separately)
+func (l *PackageRefList) FilterLatestRefs() *PackageRefList {
+	result := &PackageRefList{Refs: make([][]byte, 0, l.Len())}
+
+	// refs for the same architecture & name are always adjacent
+	for start := 0; start < l.Len(); {
+		arch, name, _, _ := parseRef(l.Refs[start])
+
+		end := start + 1
+		for end < l.Len() {
+			nextArch, nextName, _, _ := parseRef(l.Refs[end])
+			if !bytes.Equal(arch, nextArch) || !bytes.Equal(name, nextName) {
+				break
+			}
+			end++
+		}
+
+		// find latest .deb & udeb in the group
+		latest := [2]int{-1, -1}
+		for i := start; i < end; i++ {
+			_, _, version, udeb := parseRef(l.Refs[i])
+			kind := 0
+			if udeb {
+				kind = 1
+			}
+
+			if latest[kind] == -1 {
+				latest[kind] = i
+			} else {
+				_, _, latestVersion, _ := parseRef(l.Refs[latest[kind]])
+				if CompareVersions(string(version), string(latestVersion)) > 0 {
+					latest[kind] = i
+				}
+			}
+		}
+
+		// keep sort order
+		for i := start; i < end; i++ {
+			if i == latest[0] || i == latest[1] {
+				result.Refs = append(result.Refs, l.Refs[i])
+			}
+		}
+
+		start = end
+	}
+
+	return result
+}
+
+// Override returns reflist where packages with specified names are taken from r,
+// replacing all versions present in l. Names which are missing from r are left intact.
+func (l *PackageRefList) Override(r *PackageRefList, names []string) *PackageRefList {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	result := &PackageRefList{Refs: make([][]byte, 0, l.Len())}
+
+	present := make(map[string]bool)
+	for _, ref := range r.Refs {
+		_, name, _, _ := parseRef(ref)
+		if wanted[string(name)] {
+			present[string(name)] = true
+			result.Refs = append(result.Refs, ref)
+		}
+	}
+
+	for _, ref := range l.Refs {
+		_, name, _, _ := parseRef(ref)
+		if !present[string(name)] {
+			result.Refs = append(result.Refs, ref)
+		}
+	}
+
+	sort.Sort(result)
+
+	return result
+}
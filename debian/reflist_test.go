@@ -6,6 +6,14 @@ import (
 	. "launchpad.net/gocheck"
 )
 
+func toStrSlice(reflist *PackageRefList) (result []string) {
+	result = make([]string, reflist.Len())
+	for i, r := range reflist.Refs {
+		result[i] = string(r)
+	}
+	return
+}
+
 type PackageRefListSuite struct {
 	// Simple list with "real" packages from stanzas
 	list                   *PackageList
@@ -120,6 +128,22 @@ func (s *PackageRefListSuite) TestPackageRefListForeach(c *C) {
 	c.Check(err, Equals, e)
 }
 
+func (s *PackageRefListSuite) TestHas(c *C) {
+	s.list.Add(s.p1)
+	s.list.Add(s.p3)
+	s.list.Add(s.p5)
+
+	reflist := NewPackageRefListFromPackageList(s.list)
+
+	c.Check(reflist.Has(s.p1), Equals, true)
+	c.Check(reflist.Has(s.p3), Equals, true)
+	c.Check(reflist.Has(s.p5), Equals, true)
+	c.Check(reflist.Has(s.p2), Equals, true)
+	c.Check(reflist.Has(s.p6), Equals, false)
+
+	c.Check(NewPackageRefList().Has(s.p1), Equals, false)
+}
+
 func (s *PackageRefListSuite) TestSubstract(c *C) {
 	r1 := []byte("r1")
 	r2 := []byte("r2")
@@ -250,14 +274,6 @@ func (s *PackageRefListSuite) TestMerge(c *C) {
 	reflistA := NewPackageRefListFromPackageList(listA)
 	reflistB := NewPackageRefListFromPackageList(listB)
 
-	toStrSlice := func(reflist *PackageRefList) (result []string) {
-		result = make([]string, reflist.Len())
-		for i, r := range reflist.Refs {
-			result[i] = string(r)
-		}
-		return
-	}
-
 	mergeAB := reflistA.Merge(reflistB, true)
 	mergeBA := reflistB.Merge(reflistA, true)
 
@@ -273,3 +289,86 @@ func (s *PackageRefListSuite) TestMerge(c *C) {
 	c.Check(toStrSlice(mergeBAall), DeepEquals,
 		[]string{"Pall data 1.1~bp1", "Pamd64 app 1.1~bp2", "Pi386 app 1.1~bp1", "Pi386 app 1.1~bp2", "Pi386 dpkg 1.0", "Pi386 dpkg 1.7", "Pi386 lib 1.0", "Psparc xyz 1.0"})
 }
+
+func (s *PackageRefListSuite) TestMergeUdebs(c *C) {
+	packages := []*Package{
+		&Package{Name: "app", Version: "1.0", Architecture: "i386"},               //0
+		&Package{Name: "app", Version: "1.0", Architecture: "i386", IsUdeb: true}, //1
+		&Package{Name: "app", Version: "1.1", Architecture: "i386", IsUdeb: true}, //2
+	}
+
+	listA := NewPackageList()
+	listA.Add(packages[0])
+	listA.Add(packages[1])
+
+	listB := NewPackageList()
+	listB.Add(packages[2])
+
+	reflistA := NewPackageRefListFromPackageList(listA)
+	reflistB := NewPackageRefListFromPackageList(listB)
+
+	merge := reflistA.Merge(reflistB, true)
+
+	result := make([]string, merge.Len())
+	for i, r := range merge.Refs {
+		result[i] = string(r)
+	}
+
+	c.Check(result, DeepEquals, []string{"Pi386 app 1.0", "Pi386 app 1.1 udeb"})
+}
+
+func (s *PackageRefListSuite) TestFilterLatestRefs(c *C) {
+	packages := []*Package{
+		&Package{Name: "lib", Version: "1.0", Architecture: "i386"},
+		&Package{Name: "lib", Version: "1.2~bp1", Architecture: "i386"},
+		&Package{Name: "lib", Version: "1.2", Architecture: "i386"},
+		&Package{Name: "lib", Version: "1.1", Architecture: "amd64"},
+		&Package{Name: "lib", Version: "1.3", Architecture: "i386", IsUdeb: true},
+		&Package{Name: "lib", Version: "1.10", Architecture: "i386", IsUdeb: true},
+		&Package{Name: "lib-dev", Version: "1.0", Architecture: "i386"},
+		&Package{Name: "dpkg", Version: "1:1.0", Architecture: "i386"},
+		&Package{Name: "dpkg", Version: "2.0", Architecture: "i386"},
+	}
+
+	list := NewPackageList()
+	for _, p := range packages {
+		list.Add(p)
+	}
+
+	result := NewPackageRefListFromPackageList(list).FilterLatestRefs()
+
+	c.Check(toStrSlice(result), DeepEquals,
+		[]string{"Pamd64 lib 1.1", "Pi386 dpkg 1:1.0", "Pi386 lib 1.10 udeb", "Pi386 lib 1.2", "Pi386 lib-dev 1.0"})
+}
+
+func (s *PackageRefListSuite) TestOverride(c *C) {
+	packages := []*Package{
+		&Package{Name: "lib", Version: "1.0", Architecture: "i386"},   //0
+		&Package{Name: "lib", Version: "1.0", Architecture: "amd64"},  //1
+		&Package{Name: "app", Version: "2.0", Architecture: "i386"},   //2
+		&Package{Name: "lib", Version: "0.9", Architecture: "i386"},   //3
+		&Package{Name: "app", Version: "1.0", Architecture: "i386"},   //4
+		&Package{Name: "data", Version: "1.0", Architecture: "all"},   //5
+		&Package{Name: "other", Version: "1.0", Architecture: "i386"}, //6
+	}
+
+	listA := NewPackageList()
+	listA.Add(packages[0])
+	listA.Add(packages[1])
+	listA.Add(packages[2])
+	listA.Add(packages[5])
+
+	listB := NewPackageList()
+	listB.Add(packages[3])
+	listB.Add(packages[4])
+	listB.Add(packages[6])
+
+	reflistA := NewPackageRefListFromPackageList(listA)
+	reflistB := NewPackageRefListFromPackageList(listB)
+
+	c.Check(toStrSlice(reflistA.Override(reflistB, []string{"lib", "data"})), DeepEquals,
+		[]string{"Pall data 1.0", "Pi386 app 2.0", "Pi386 lib 0.9"})
+	c.Check(toStrSlice(reflistA.Override(reflistB, []string{"app", "nonexistent"})), DeepEquals,
+		[]string{"Pall data 1.0", "Pamd64 lib 1.0", "Pi386 app 1.0", "Pi386 lib 1.0"})
+	c.Check(toStrSlice(reflistA.Override(reflistB, nil)), DeepEquals, toStrSlice(reflistA))
+}
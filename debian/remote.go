@@ -9,10 +9,13 @@ import (
 	"github.com/smira/aptly/http"
 	"github.com/smira/aptly/utils"
 	"github.com/ugorji/go/codec"
+	"io"
 	"log"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -36,10 +39,36 @@ type RemoteRepo struct {
 	Architectures []string
 	// Should we download sources?
 	DownloadSources bool
+	// Should we download .udebs (debian-installer packages)?
+	DownloadUdebs bool `codec:",omitempty"`
+	// Fingerprints of keys from aptly keyring trusted to sign Release file,
+	// if empty, any key from verifier keyrings is accepted
+	TrustedKeys []string `codec:",omitempty"`
+	// HTTP proxy URL, if empty global one is used
+	Proxy string `codec:",omitempty"`
+	// Path to CA bundle to verify archive certificate
+	CABundle string `codec:",omitempty"`
+	// Paths to TLS client certificate & key
+	ClientCert string `codec:",omitempty"`
+	ClientKey  string `codec:",omitempty"`
+	// Path to netrc-style file with credentials for the archive
+	Netrc string `codec:",omitempty"`
+	// Hardlink package files from local (file://) archive instead of copying
+	LinkLocal bool `codec:",omitempty"`
+	// Number of parallel downloads, if zero global setting is used
+	DownloadConcurrency int `codec:",omitempty"`
+	// Bandwidth cap in bytes per second, if zero only global limit applies
+	DownloadSpeedLimit int64 `codec:",omitempty"`
+	// Query to filter packages on update, if empty, all packages are mirrored
+	Filter string `codec:",omitempty"`
+	// Should dependencies of packages matching Filter be mirrored as well?
+	FilterWithDeps bool `codec:",omitempty"`
 	// Meta-information about repository
 	Meta Stanza
 	// Last update date
 	LastDownloadDate time.Time
+	// Date of last accepted Release file, Release files with older Date are rejected
+	LastReleaseDate time.Time
 	// Checksums for release files
 	ReleaseFiles map[string]utils.ChecksumInfo
 	// "Snapshot" of current list of packages
@@ -50,7 +79,21 @@ type RemoteRepo struct {
 
 // NewRemoteRepo creates new instance of Debian remote repository with specified params
 func NewRemoteRepo(name string, archiveRoot string, distribution string, components []string,
-	architectures []string, downloadSources bool) (*RemoteRepo, error) {
+	architectures []string, downloadSources bool, downloadUdebs bool) (*RemoteRepo, error) {
+	if !strings.Contains(archiveRoot, "://") {
+		// local directory, e.g. NFS share or mounted DVD, should be absolute path or explicitly
+		// relative one, so that URL without scheme (e.g. mirror.yandex.ru/debian) isn't taken for a path
+		if !filepath.IsAbs(archiveRoot) && !isExplicitRelativePath(archiveRoot) {
+			return nil, fmt.Errorf("archive URL %s should be either URL with scheme (e.g. http://) or "+
+				"path to local directory: absolute or starting with ./", archiveRoot)
+		}
+		absPath, err := filepath.Abs(archiveRoot)
+		if err != nil {
+			return nil, err
+		}
+		archiveRoot = http.LocalPathToURL(absPath)
+	}
+
 	result := &RemoteRepo{
 		UUID:            uuid.New(),
 		Name:            name,
@@ -59,6 +102,7 @@ func NewRemoteRepo(name string, archiveRoot string, distribution string, compone
 		Components:      components,
 		Architectures:   architectures,
 		DownloadSources: downloadSources,
+		DownloadUdebs:   downloadUdebs,
 	}
 
 	err := result.prepare()
@@ -66,6 +110,14 @@ func NewRemoteRepo(name string, archiveRoot string, distribution string, compone
 		return nil, err
 	}
 
+	if result.IsLocal() {
+		// path has trailing slash, so it's accessible only if it's a directory
+		_, err = os.Stat(result.archiveRootURL.Path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to access local archive: %s", err)
+		}
+	}
+
 	if result.Distribution == "." || result.Distribution == "./" {
 		// flat repo
 		result.Distribution = ""
@@ -74,11 +126,24 @@ func NewRemoteRepo(name string, archiveRoot string, distribution string, compone
 			return nil, fmt.Errorf("components aren't supported for flat repos")
 		}
 		result.Components = nil
+		if result.DownloadUdebs {
+			return nil, fmt.Errorf("debian-installer udebs aren't supported for flat repos")
+		}
 	}
 
 	return result, nil
 }
 
+// isExplicitRelativePath checks whether path starts with ./ or ../
+func isExplicitRelativePath(path string) bool {
+	for _, prefix := range []string{".", ".."} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") || strings.HasPrefix(path, prefix+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 func (repo *RemoteRepo) prepare() error {
 	var err error
 
@@ -97,11 +162,30 @@ func (repo *RemoteRepo) String() string {
 	if repo.DownloadSources {
 		srcFlag = " [src]"
 	}
+	if repo.DownloadUdebs {
+		srcFlag += " [udeb]"
+	}
 	distribution := repo.Distribution
 	if distribution == "" {
 		distribution = "./"
 	}
-	return fmt.Sprintf("[%s]: %s %s%s", repo.Name, repo.ArchiveRoot, distribution, srcFlag)
+	return fmt.Sprintf("[%s]: %s %s%s", repo.Name, http.SanitizeURL(repo.ArchiveRoot), distribution, srcFlag)
+}
+
+// TransportOptions returns HTTP transport settings of the mirror
+func (repo *RemoteRepo) TransportOptions() http.TransportOptions {
+	return http.TransportOptions{
+		Proxy:      repo.Proxy,
+		CABundle:   repo.CABundle,
+		ClientCert: repo.ClientCert,
+		ClientKey:  repo.ClientKey,
+		Netrc:      repo.Netrc,
+	}
+}
+
+// IsLocal determines if repository is fetched from local filesystem
+func (repo *RemoteRepo) IsLocal() bool {
+	return repo.archiveRootURL.Scheme == "file"
 }
 
 // IsFlat determines if repository is flat
@@ -154,6 +238,13 @@ func (repo *RemoteRepo) BinaryURL(component string, architecture string) *url.UR
 	return repo.archiveRootURL.ResolveReference(path)
 }
 
+// UdebURL returns URL of Packages files for given component and
+// architecture of debian-installer packages
+func (repo *RemoteRepo) UdebURL(component string, architecture string) *url.URL {
+	path := &url.URL{Path: fmt.Sprintf("dists/%s/%s/debian-installer/binary-%s/Packages", repo.Distribution, component, architecture)}
+	return repo.archiveRootURL.ResolveReference(path)
+}
+
 // SourcesURL returns URL of Sources files for given component
 func (repo *RemoteRepo) SourcesURL(component string) *url.URL {
 	path := &url.URL{Path: fmt.Sprintf("dists/%s/%s/source/Sources", repo.Distribution, component)}
@@ -313,36 +404,150 @@ ok:
 	return nil
 }
 
+// releaseDateLayouts are formats of Date & Valid-Until fields found in Release files
+var releaseDateLayouts = []string{
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+}
+
+// parseReleaseDate parses date in Release file
+func parseReleaseDate(value string) (time.Time, error) {
+	value = strings.Join(strings.Fields(value), " ")
+
+	for _, layout := range releaseDateLayouts {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unable to parse date %#v", value)
+}
+
+// CheckFreshness verifies Release file fetched with Fetch: its Date shouldn't be older
+// than Date of previously accepted Release file (protection against rollback) and
+// Valid-Until shouldn't be in the past
+//
+// On success, Date of Release file is recorded as last accepted
+func (repo *RemoteRepo) CheckFreshness(now time.Time, allowRollback, allowExpired bool) error {
+	var date time.Time
+
+	if repo.Meta["Date"] != "" {
+		var err error
+		date, err = parseReleaseDate(repo.Meta["Date"])
+		if err != nil {
+			return fmt.Errorf("malformed Date in Release file: %s", err)
+		}
+
+		if date.Before(repo.LastReleaseDate) && !allowRollback {
+			return fmt.Errorf("release file is older than previously accepted one (%s < %s), possible rollback attack",
+				date.UTC().Format(time.RFC1123), repo.LastReleaseDate.UTC().Format(time.RFC1123))
+		}
+	}
+
+	if repo.Meta["Valid-Until"] != "" {
+		validUntil, err := parseReleaseDate(repo.Meta["Valid-Until"])
+		if err != nil {
+			return fmt.Errorf("malformed Valid-Until in Release file: %s", err)
+		}
+
+		if now.After(validUntil) && !allowExpired {
+			return fmt.Errorf("release file has expired on %s, mirror might be stale", validUntil.UTC().Format(time.RFC1123))
+		}
+	}
+
+	if !date.IsZero() {
+		repo.LastReleaseDate = date
+	}
+
+	return nil
+}
+
 // Download downloads all repo files
-func (repo *RemoteRepo) Download(progress aptly.Progress, d aptly.Downloader, packageCollection *PackageCollection, packagePool aptly.PackagePool, ignoreMismatch bool) error {
+//
+// If indexDir is not empty, raw index files are kept there between updates, so
+// that they could be updated incrementally with pdiffs
+//
+// If Filter is set, only matching packages (and their dependencies, if FilterWithDeps is set,
+// resolved with dependencyOptions) are downloaded
+func (repo *RemoteRepo) Download(progress aptly.Progress, d aptly.Downloader, packageCollection *PackageCollection, packagePool aptly.PackagePool,
+	indexDir string, dependencyOptions int, ignoreMismatch bool) error {
 	list := NewPackageList()
 
 	progress.Printf("Downloading & parsing package files...\n")
 
-	// Download and parse all Packages & Source files
+	// Download and parse all Packages & Source files: URL, kind and path relative to Release file
 	packagesURLs := [][]string{}
 
 	if repo.IsFlat() {
-		packagesURLs = append(packagesURLs, []string{repo.FlatBinaryURL().String(), "binary"})
+		packagesURLs = append(packagesURLs, []string{repo.FlatBinaryURL().String(), "binary", "Packages"})
 		if repo.DownloadSources {
-			packagesURLs = append(packagesURLs, []string{repo.FlatSourcesURL().String(), "source"})
+			packagesURLs = append(packagesURLs, []string{repo.FlatSourcesURL().String(), "source", "Sources"})
 		}
 	} else {
 		for _, component := range repo.Components {
 			for _, architecture := range repo.Architectures {
-				packagesURLs = append(packagesURLs, []string{repo.BinaryURL(component, architecture).String(), "binary"})
+				packagesURLs = append(packagesURLs, []string{repo.BinaryURL(component, architecture).String(), "binary",
+					fmt.Sprintf("%s/binary-%s/Packages", component, architecture)})
+				if repo.DownloadUdebs {
+					packagesURLs = append(packagesURLs, []string{repo.UdebURL(component, architecture).String(), "udeb",
+						fmt.Sprintf("%s/debian-installer/binary-%s/Packages", component, architecture)})
+				}
 			}
 			if repo.DownloadSources {
-				packagesURLs = append(packagesURLs, []string{repo.SourcesURL(component).String(), "source"})
+				packagesURLs = append(packagesURLs, []string{repo.SourcesURL(component).String(), "source",
+					fmt.Sprintf("%s/source/Sources", component)})
 			}
 		}
 	}
 
 	for _, info := range packagesURLs {
-		url, kind := info[0], info[1]
-		packagesReader, packagesFile, err := http.DownloadTryCompression(d, url, repo.ReleaseFiles, ignoreMismatch)
-		if err != nil {
-			return err
+		url, kind, releasePath := info[0], info[1], info[2]
+
+		var (
+			packagesReader io.Reader
+			packagesFile   *os.File
+			cacheFile      *os.File
+			cachePath      string
+			err            error
+		)
+
+		if indexDir != "" && !repo.IsFlat() {
+			cachePath = repo.indexCachePath(indexDir, releasePath)
+
+			if _, err = os.Stat(cachePath); err == nil {
+				packagesFile, err = repo.updateIndexWithPDiff(progress, d, url, releasePath, cachePath)
+				if err != nil {
+					progress.Printf("Unable to update %s with pdiffs: %s, downloading full index...\n", releasePath, err)
+				} else {
+					packagesReader = packagesFile
+				}
+			}
+		}
+
+		if packagesReader == nil {
+			packagesReader, packagesFile, err = http.DownloadTryCompression(d, url, repo.ReleaseFiles, ignoreMismatch)
+			if err != nil {
+				return err
+			}
+
+			if cachePath != "" {
+				// keep raw index, so that it could be updated with pdiffs next time
+				err = os.MkdirAll(filepath.Dir(cachePath), 0755)
+				if err != nil {
+					return err
+				}
+
+				cacheFile, err = os.Create(cachePath + ".new")
+				if err != nil {
+					return err
+				}
+				defer cacheFile.Close()
+
+				packagesReader = io.TeeReader(packagesReader, cacheFile)
+			}
 		}
 		defer packagesFile.Close()
 
@@ -367,6 +572,8 @@ func (repo *RemoteRepo) Download(progress aptly.Progress, d aptly.Downloader, pa
 
 			if kind == "binary" {
 				p = NewPackageFromControlFile(stanza)
+			} else if kind == "udeb" {
+				p = NewUdebPackageFromControlFile(stanza)
 			} else if kind == "source" {
 				p, err = NewSourcePackageFromControlFile(stanza)
 				if err != nil {
@@ -377,14 +584,33 @@ func (repo *RemoteRepo) Download(progress aptly.Progress, d aptly.Downloader, pa
 			if err != nil {
 				return err
 			}
+		}
 
-			err = packageCollection.Update(p)
+		progress.ShutdownBar()
+
+		if cacheFile != nil {
+			err = cacheFile.Close()
+			if err == nil {
+				err = os.Rename(cachePath+".new", cachePath)
+			}
 			if err != nil {
-				return err
+				return fmt.Errorf("unable to save index file: %s", err)
 			}
 		}
+	}
 
-		progress.ShutdownBar()
+	if repo.Filter != "" {
+		progress.Printf("Applying filter...\n")
+
+		before := list.Len()
+		var err error
+
+		list, err = repo.ApplyFilter(list, dependencyOptions)
+		if err != nil {
+			return fmt.Errorf("unable to apply filter: %s", err)
+		}
+
+		progress.Printf("Packages filtered: %d -> %d.\n", before, list.Len())
 	}
 
 	progress.Printf("Building download queue...\n")
@@ -395,6 +621,11 @@ func (repo *RemoteRepo) Download(progress aptly.Progress, d aptly.Downloader, pa
 	downloadSize := int64(0)
 
 	err := list.ForEach(func(p *Package) error {
+		err := packageCollection.Update(p)
+		if err != nil {
+			return err
+		}
+
 		list, err := p.DownloadList(packagePool)
 		if err != nil {
 			return err
@@ -423,7 +654,7 @@ func (repo *RemoteRepo) Download(progress aptly.Progress, d aptly.Downloader, pa
 
 	progress.Printf("Download queue: %d items (%s)\n", count, utils.HumanBytes(downloadSize))
 
-	progress.InitBar(downloadSize, true)
+	progress.InitBarWithPrefix(downloadSize, true, d.BarPrefix())
 
 	// Download all package files
 	ch := make(chan error, len(queued))
@@ -457,6 +688,22 @@ func (repo *RemoteRepo) Download(progress aptly.Progress, d aptly.Downloader, pa
 	return nil
 }
 
+// ApplyFilter returns packages from list matching Filter, possibly with dependencies
+func (repo *RemoteRepo) ApplyFilter(list *PackageList, dependencyOptions int) (*PackageList, error) {
+	list.PrepareIndex()
+
+	var architectures []string
+	if repo.FilterWithDeps {
+		architectures = repo.Architectures
+		if len(architectures) == 0 {
+			architectures = list.Architectures(false)
+		}
+		sort.Strings(architectures)
+	}
+
+	return list.Filter([]string{repo.Filter}, repo.FilterWithDeps, NewPackageList(), dependencyOptions, architectures)
+}
+
 // Encode does msgpack encoding of RemoteRepo
 func (repo *RemoteRepo) Encode() []byte {
 	var buf bytes.Buffer
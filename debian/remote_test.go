@@ -12,6 +12,8 @@ import (
 	"io/ioutil"
 	. "launchpad.net/gocheck"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 type NullVerifier struct {
@@ -79,8 +81,8 @@ type RemoteRepoSuite struct {
 var _ = Suite(&RemoteRepoSuite{})
 
 func (s *RemoteRepoSuite) SetUpTest(c *C) {
-	s.repo, _ = NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian", "squeeze", []string{"main"}, []string{}, false)
-	s.flat, _ = NewRemoteRepo("exp42", "http://repos.express42.com/virool/precise/", "./", []string{}, []string{}, false)
+	s.repo, _ = NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian", "squeeze", []string{"main"}, []string{}, false, false)
+	s.flat, _ = NewRemoteRepo("exp42", "http://repos.express42.com/virool/precise/", "./", []string{}, []string{}, false, false)
 	s.downloader = http.NewFakeDownloader().ExpectResponse("http://mirror.yandex.ru/debian/dists/squeeze/Release", exampleReleaseFile)
 	s.progress = console.NewProgress()
 	s.db, _ = database.OpenDB(c.MkDir())
@@ -96,7 +98,7 @@ func (s *RemoteRepoSuite) TearDownTest(c *C) {
 }
 
 func (s *RemoteRepoSuite) TestInvalidURL(c *C) {
-	_, err := NewRemoteRepo("s", "http://lolo%2", "squeeze", []string{"main"}, []string{}, false)
+	_, err := NewRemoteRepo("s", "http://lolo%2", "squeeze", []string{"main"}, []string{}, false, false)
 	c.Assert(err, ErrorMatches, ".*hexadecimal escape in host.*")
 }
 
@@ -105,8 +107,11 @@ func (s *RemoteRepoSuite) TestFlatCreation(c *C) {
 	c.Check(s.flat.Architectures, IsNil)
 	c.Check(s.flat.Components, IsNil)
 
-	_, err := NewRemoteRepo("fl", "http://some.repo/", "./", []string{"main"}, []string{}, false)
+	_, err := NewRemoteRepo("fl", "http://some.repo/", "./", []string{"main"}, []string{}, false, false)
 	c.Check(err, ErrorMatches, "components aren't supported for flat repos")
+
+	_, err = NewRemoteRepo("fl", "http://some.repo/", "./", []string{}, []string{}, false, true)
+	c.Check(err, ErrorMatches, "debian-installer udebs aren't supported for flat repos")
 }
 
 func (s *RemoteRepoSuite) TestString(c *C) {
@@ -117,6 +122,9 @@ func (s *RemoteRepoSuite) TestString(c *C) {
 	s.flat.DownloadSources = true
 	c.Check(s.repo.String(), Equals, "[yandex]: http://mirror.yandex.ru/debian/ squeeze [src]")
 	c.Check(s.flat.String(), Equals, "[exp42]: http://repos.express42.com/virool/precise/ ./ [src]")
+
+	s.repo.DownloadUdebs = true
+	c.Check(s.repo.String(), Equals, "[yandex]: http://mirror.yandex.ru/debian/ squeeze [src] [udeb]")
 }
 
 func (s *RemoteRepoSuite) TestNumPackages(c *C) {
@@ -130,6 +138,48 @@ func (s *RemoteRepoSuite) TestIsFlat(c *C) {
 	c.Check(s.flat.IsFlat(), Equals, true)
 }
 
+func (s *RemoteRepoSuite) TestLocalArchive(c *C) {
+	c.Check(s.repo.IsLocal(), Equals, false)
+
+	root := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(root, "cdrom"), 0755), IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(root, "vendor repo"), 0755), IsNil)
+
+	local, err := NewRemoteRepo("dvd", filepath.Join(root, "cdrom"), "squeeze", []string{"main"}, []string{}, false, false)
+	c.Assert(err, IsNil)
+	c.Check(local.ArchiveRoot, Equals, "file://"+root+"/cdrom/")
+	c.Check(local.IsLocal(), Equals, true)
+	c.Check(local.ReleaseURL("InRelease").String(), Equals, "file://"+root+"/cdrom/dists/squeeze/InRelease")
+	c.Check(local.PackageURL("pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb").String(), Equals,
+		"file://"+root+"/cdrom/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb")
+
+	local, err = NewRemoteRepo("nfs", "file://"+root+"/vendor repo/", "./", []string{}, []string{}, false, false)
+	c.Assert(err, IsNil)
+	c.Check(local.IsLocal(), Equals, true)
+	c.Check(local.FlatBinaryURL().Path, Equals, root+"/vendor repo/Packages")
+
+	cwd, _ := os.Getwd()
+	c.Assert(os.Chdir(root), IsNil)
+	defer os.Chdir(cwd)
+
+	local, err = NewRemoteRepo("rel", "./cdrom", "squeeze", []string{"main"}, []string{}, false, false)
+	c.Assert(err, IsNil)
+	c.Check(local.ArchiveRoot, Equals, "file://"+root+"/cdrom/")
+
+	_, err = NewRemoteRepo("typo", "mirror.yandex.ru/debian", "squeeze", []string{"main"}, []string{}, false, false)
+	c.Check(err, ErrorMatches, "archive URL mirror.yandex.ru/debian should be either URL with scheme .*")
+
+	_, err = NewRemoteRepo("missing", "/no/such/dir", "squeeze", []string{"main"}, []string{}, false, false)
+	c.Check(err, ErrorMatches, "unable to access local archive: .*no such file or directory")
+
+	_, err = NewRemoteRepo("missing", "file:///no/such/dir", "squeeze", []string{"main"}, []string{}, false, false)
+	c.Check(err, ErrorMatches, "unable to access local archive: .*no such file or directory")
+
+	c.Assert(ioutil.WriteFile(filepath.Join(root, "file"), []byte("x"), 0644), IsNil)
+	_, err = NewRemoteRepo("file", "./file", "squeeze", []string{"main"}, []string{}, false, false)
+	c.Check(err, ErrorMatches, "unable to access local archive: .*not a directory")
+}
+
 func (s *RemoteRepoSuite) TestRefList(c *C) {
 	s.repo.packageRefs = s.reflist
 	c.Check(s.repo.RefList(), Equals, s.reflist)
@@ -146,6 +196,10 @@ func (s *RemoteRepoSuite) TestBinaryURL(c *C) {
 	c.Assert(s.repo.BinaryURL("main", "amd64").String(), Equals, "http://mirror.yandex.ru/debian/dists/squeeze/main/binary-amd64/Packages")
 }
 
+func (s *RemoteRepoSuite) TestUdebURL(c *C) {
+	c.Assert(s.repo.UdebURL("main", "amd64").String(), Equals, "http://mirror.yandex.ru/debian/dists/squeeze/main/debian-installer/binary-amd64/Packages")
+}
+
 func (s *RemoteRepoSuite) TestSourcesURL(c *C) {
 	c.Assert(s.repo.SourcesURL("main").String(), Equals, "http://mirror.yandex.ru/debian/dists/squeeze/main/source/Sources")
 }
@@ -204,17 +258,69 @@ func (s *RemoteRepoSuite) TestFetchNullVerifier2(c *C) {
 }
 
 func (s *RemoteRepoSuite) TestFetchWrongArchitecture(c *C) {
-	s.repo, _ = NewRemoteRepo("s", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{"xyz"}, false)
+	s.repo, _ = NewRemoteRepo("s", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{"xyz"}, false, false)
 	err := s.repo.Fetch(s.downloader, nil)
 	c.Assert(err, ErrorMatches, "architecture xyz not available in repo.*")
 }
 
 func (s *RemoteRepoSuite) TestFetchWrongComponent(c *C) {
-	s.repo, _ = NewRemoteRepo("s", "http://mirror.yandex.ru/debian/", "squeeze", []string{"xyz"}, []string{"i386"}, false)
+	s.repo, _ = NewRemoteRepo("s", "http://mirror.yandex.ru/debian/", "squeeze", []string{"xyz"}, []string{"i386"}, false, false)
 	err := s.repo.Fetch(s.downloader, nil)
 	c.Assert(err, ErrorMatches, "component xyz not available in repo.*")
 }
 
+func (s *RemoteRepoSuite) TestCheckFreshness(c *C) {
+	err := s.repo.Fetch(s.downloader, nil)
+	c.Assert(err, IsNil)
+
+	now := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	released := time.Date(2013, 12, 5, 8, 14, 32, 0, time.UTC)
+
+	c.Assert(s.repo.CheckFreshness(now, false, false), IsNil)
+	c.Check(s.repo.LastReleaseDate.Equal(released), Equals, true)
+
+	// same Release file again is fine
+	c.Check(s.repo.CheckFreshness(now, false, false), IsNil)
+
+	s.repo.LastReleaseDate = released.Add(time.Hour)
+	c.Check(s.repo.CheckFreshness(now, false, false), ErrorMatches,
+		"release file is older than previously accepted one \\(Thu, 05 Dec 2013 08:14:32 UTC < Thu, 05 Dec 2013 09:14:32 UTC\\), possible rollback attack")
+	c.Check(s.repo.LastReleaseDate.Equal(released.Add(time.Hour)), Equals, true)
+
+	c.Check(s.repo.CheckFreshness(now, true, false), IsNil)
+	c.Check(s.repo.LastReleaseDate.Equal(released), Equals, true)
+
+	s.repo.Meta["Valid-Until"] = "Thu, 12 Dec 2013 8:14:32 UTC"
+	c.Check(s.repo.CheckFreshness(now, false, false), ErrorMatches,
+		"release file has expired on Thu, 12 Dec 2013 08:14:32 UTC, mirror might be stale")
+	c.Check(s.repo.CheckFreshness(now, false, true), IsNil)
+	c.Check(s.repo.CheckFreshness(released, false, false), IsNil)
+
+	s.repo.Meta["Valid-Until"] = "tomorrow"
+	c.Check(s.repo.CheckFreshness(now, false, false), ErrorMatches, "malformed Valid-Until in Release file: .*")
+
+	s.repo.Meta["Date"] = "yesterday"
+	c.Check(s.repo.CheckFreshness(now, false, false), ErrorMatches, "malformed Date in Release file: .*")
+
+	repo := &RemoteRepo{}
+	c.Assert(repo.Decode((&RemoteRepo{LastReleaseDate: released}).Encode()), IsNil)
+	c.Check(repo.LastReleaseDate.Equal(released), Equals, true)
+}
+
+func (s *RemoteRepoSuite) TestParseReleaseDate(c *C) {
+	expected := time.Date(2013, 12, 5, 8, 14, 32, 0, time.UTC)
+
+	for _, value := range []string{"Thu, 05 Dec 2013  8:14:32 UTC", "Thu, 5 Dec 2013 08:14:32 UTC",
+		"Thu, 05 Dec 2013 08:14:32 +0000", "5 Dec 2013 08:14:32 UTC"} {
+		date, err := parseReleaseDate(value)
+		c.Check(err, IsNil)
+		c.Check(date.Equal(expected), Equals, true, Commentf("value: %s", value))
+	}
+
+	_, err := parseReleaseDate("2013-12-05")
+	c.Check(err, ErrorMatches, "unable to parse date \"2013-12-05\"")
+}
+
 func (s *RemoteRepoSuite) TestEncodeDecode(c *C) {
 	repo := &RemoteRepo{}
 	err := repo.Decode(s.repo.Encode())
@@ -246,7 +352,7 @@ func (s *RemoteRepoSuite) TestDownload(c *C) {
 	s.downloader.ExpectResponse("http://mirror.yandex.ru/debian/dists/squeeze/main/binary-i386/Packages", examplePackagesFile)
 	s.downloader.ExpectResponse("http://mirror.yandex.ru/debian/pool/main/a/amanda/amanda-client_3.3.1-3~bpo60+1_amd64.deb", "xyz")
 
-	err = s.repo.Download(s.progress, s.downloader, s.packageCollection, s.packagePool, false)
+	err = s.repo.Download(s.progress, s.downloader, s.packageCollection, s.packagePool, "", 0, false)
 	c.Assert(err, IsNil)
 	c.Assert(s.downloader.Empty(), Equals, true)
 	c.Assert(s.repo.packageRefs, NotNil)
@@ -279,7 +385,7 @@ func (s *RemoteRepoSuite) TestDownloadWithSources(c *C) {
 	s.downloader.AnyExpectResponse("http://mirror.yandex.ru/debian/pool/main/a/access-modifier-checker/access-modifier-checker_1.0.orig.tar.gz", "abcd")
 	s.downloader.AnyExpectResponse("http://mirror.yandex.ru/debian/pool/main/a/access-modifier-checker/access-modifier-checker_1.0-4.debian.tar.gz", "abcde")
 
-	err = s.repo.Download(s.progress, s.downloader, s.packageCollection, s.packagePool, false)
+	err = s.repo.Download(s.progress, s.downloader, s.packageCollection, s.packagePool, "", 0, false)
 	c.Assert(err, IsNil)
 	c.Assert(s.downloader.Empty(), Equals, true)
 	c.Assert(s.repo.packageRefs, NotNil)
@@ -303,6 +409,96 @@ func (s *RemoteRepoSuite) TestDownloadWithSources(c *C) {
 	c.Check(pkg.Name, Equals, "access-modifier-checker")
 }
 
+func (s *RemoteRepoSuite) TestDownloadWithFilter(c *C) {
+	s.repo.Architectures = []string{"i386"}
+	s.repo.DownloadSources = true
+	s.repo.Filter = "amanda-client | nginx (>= 1.4)"
+
+	err := s.repo.Fetch(s.downloader, nil)
+	c.Assert(err, IsNil)
+
+	s.downloader.ExpectError("http://mirror.yandex.ru/debian/dists/squeeze/main/binary-i386/Packages.bz2", errors.New("HTTP 404"))
+	s.downloader.ExpectError("http://mirror.yandex.ru/debian/dists/squeeze/main/binary-i386/Packages.gz", errors.New("HTTP 404"))
+	s.downloader.ExpectResponse("http://mirror.yandex.ru/debian/dists/squeeze/main/binary-i386/Packages", examplePackagesFile)
+	s.downloader.ExpectError("http://mirror.yandex.ru/debian/dists/squeeze/main/source/Sources.bz2", errors.New("HTTP 404"))
+	s.downloader.ExpectError("http://mirror.yandex.ru/debian/dists/squeeze/main/source/Sources.gz", errors.New("HTTP 404"))
+	s.downloader.ExpectResponse("http://mirror.yandex.ru/debian/dists/squeeze/main/source/Sources", exampleSourcesFile)
+	s.downloader.ExpectResponse("http://mirror.yandex.ru/debian/pool/main/a/amanda/amanda-client_3.3.1-3~bpo60+1_amd64.deb", "xyz")
+
+	err = s.repo.Download(s.progress, s.downloader, s.packageCollection, s.packagePool, "", 0, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.downloader.Empty(), Equals, true)
+	c.Assert(s.repo.packageRefs.Len(), Equals, 1)
+
+	pkg, err := s.packageCollection.ByKey(s.repo.packageRefs.Refs[0])
+	c.Assert(err, IsNil)
+	c.Check(pkg.Name, Equals, "amanda-client")
+
+	// filtered out packages are not saved
+	c.Check(s.packageCollection.AllPackageRefs().Len(), Equals, 1)
+}
+
+func (s *RemoteRepoSuite) TestApplyFilter(c *C) {
+	s.repo.Filter = "lonely-strangers | mars-invaders"
+
+	result, err := s.repo.ApplyFilter(s.list, 0)
+	c.Assert(err, IsNil)
+	c.Check(result.Len(), Equals, 2)
+
+	s.repo.Filter = "Priority (extra), !lonely-strangers"
+	result, err = s.repo.ApplyFilter(s.list, 0)
+	c.Assert(err, IsNil)
+	c.Check(result.Len(), Equals, 2)
+
+	s.repo.Filter = "nginx 1.4)"
+	_, err = s.repo.ApplyFilter(s.list, 0)
+	c.Check(err, ErrorMatches, "unable to parse query.*")
+}
+
+func (s *RemoteRepoSuite) TestDownloadWithUdebs(c *C) {
+	s.repo.Architectures = []string{"i386"}
+	s.repo.DownloadUdebs = true
+
+	err := s.repo.Fetch(s.downloader, nil)
+	c.Assert(err, IsNil)
+
+	// Release file lists empty debian-installer index, so checksums won't match
+	delete(s.repo.ReleaseFiles, "main/debian-installer/binary-i386/Packages")
+	delete(s.repo.ReleaseFiles, "main/debian-installer/binary-i386/Packages.gz")
+	delete(s.repo.ReleaseFiles, "main/debian-installer/binary-i386/Packages.bz2")
+
+	s.downloader.ExpectError("http://mirror.yandex.ru/debian/dists/squeeze/main/binary-i386/Packages.bz2", errors.New("HTTP 404"))
+	s.downloader.ExpectError("http://mirror.yandex.ru/debian/dists/squeeze/main/binary-i386/Packages.gz", errors.New("HTTP 404"))
+	s.downloader.ExpectResponse("http://mirror.yandex.ru/debian/dists/squeeze/main/binary-i386/Packages", examplePackagesFile)
+	s.downloader.ExpectError("http://mirror.yandex.ru/debian/dists/squeeze/main/debian-installer/binary-i386/Packages.bz2", errors.New("HTTP 404"))
+	s.downloader.ExpectError("http://mirror.yandex.ru/debian/dists/squeeze/main/debian-installer/binary-i386/Packages.gz", errors.New("HTTP 404"))
+	s.downloader.ExpectResponse("http://mirror.yandex.ru/debian/dists/squeeze/main/debian-installer/binary-i386/Packages", exampleUdebPackagesFile)
+	s.downloader.AnyExpectResponse("http://mirror.yandex.ru/debian/pool/main/a/amanda/amanda-client_3.3.1-3~bpo60+1_amd64.deb", "xyz")
+	s.downloader.AnyExpectResponse("http://mirror.yandex.ru/debian/pool/main/d/dpkg/dpkg-udeb_1.15.11_i386.udeb", "udeb")
+
+	err = s.repo.Download(s.progress, s.downloader, s.packageCollection, s.packagePool, "", 0, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.downloader.Empty(), Equals, true)
+	c.Assert(s.repo.packageRefs, NotNil)
+	c.Assert(s.repo.packageRefs.Len(), Equals, 2)
+
+	pkg, err := s.packageCollection.ByKey(s.repo.packageRefs.Refs[0])
+	c.Assert(err, IsNil)
+
+	c.Check(pkg.Name, Equals, "amanda-client")
+	c.Check(pkg.IsUdeb, Equals, false)
+
+	pkg, err = s.packageCollection.ByKey(s.repo.packageRefs.Refs[1])
+	c.Assert(err, IsNil)
+
+	result, err := pkg.VerifyFiles(s.packagePool)
+	c.Check(result, Equals, true)
+	c.Check(err, IsNil)
+
+	c.Check(pkg.Name, Equals, "dpkg-udeb")
+	c.Check(pkg.IsUdeb, Equals, true)
+}
+
 func (s *RemoteRepoSuite) TestDownloadFlat(c *C) {
 	downloader := http.NewFakeDownloader()
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Release", exampleReleaseFile)
@@ -314,7 +510,7 @@ func (s *RemoteRepoSuite) TestDownloadFlat(c *C) {
 	err := s.flat.Fetch(downloader, nil)
 	c.Assert(err, IsNil)
 
-	err = s.flat.Download(s.progress, downloader, s.packageCollection, s.packagePool, false)
+	err = s.flat.Download(s.progress, downloader, s.packageCollection, s.packagePool, "", 0, false)
 	c.Assert(err, IsNil)
 	c.Assert(downloader.Empty(), Equals, true)
 	c.Assert(s.flat.packageRefs, NotNil)
@@ -348,7 +544,7 @@ func (s *RemoteRepoSuite) TestDownloadWithSourcesFlat(c *C) {
 	err := s.flat.Fetch(downloader, nil)
 	c.Assert(err, IsNil)
 
-	err = s.flat.Download(s.progress, downloader, s.packageCollection, s.packagePool, false)
+	err = s.flat.Download(s.progress, downloader, s.packageCollection, s.packagePool, "", 0, false)
 	c.Assert(err, IsNil)
 	c.Assert(downloader.Empty(), Equals, true)
 	c.Assert(s.flat.packageRefs, NotNil)
@@ -394,7 +590,7 @@ func (s *RemoteRepoCollectionSuite) TestAddByName(c *C) {
 	r, err := s.collection.ByName("yandex")
 	c.Assert(err, ErrorMatches, "*.not found")
 
-	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false)
+	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false, false)
 	c.Assert(s.collection.Add(repo), IsNil)
 	c.Assert(s.collection.Add(repo), ErrorMatches, ".*already exists")
 
@@ -412,7 +608,7 @@ func (s *RemoteRepoCollectionSuite) TestByUUID(c *C) {
 	r, err := s.collection.ByUUID("some-uuid")
 	c.Assert(err, ErrorMatches, "*.not found")
 
-	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false)
+	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false, false)
 	c.Assert(s.collection.Add(repo), IsNil)
 
 	r, err = s.collection.ByUUID(repo.UUID)
@@ -421,7 +617,7 @@ func (s *RemoteRepoCollectionSuite) TestByUUID(c *C) {
 }
 
 func (s *RemoteRepoCollectionSuite) TestUpdateLoadComplete(c *C) {
-	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false)
+	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false, false)
 	c.Assert(s.collection.Update(repo), IsNil)
 
 	collection := NewRemoteRepoCollection(s.db)
@@ -442,7 +638,7 @@ func (s *RemoteRepoCollectionSuite) TestUpdateLoadComplete(c *C) {
 }
 
 func (s *RemoteRepoCollectionSuite) TestForEachAndLen(c *C) {
-	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false)
+	repo, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false, false)
 	s.collection.Add(repo)
 
 	count := 0
@@ -464,10 +660,10 @@ func (s *RemoteRepoCollectionSuite) TestForEachAndLen(c *C) {
 }
 
 func (s *RemoteRepoCollectionSuite) TestDrop(c *C) {
-	repo1, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false)
+	repo1, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{}, false, false)
 	s.collection.Add(repo1)
 
-	repo2, _ := NewRemoteRepo("tyndex", "http://mirror.yandex.ru/debian/", "wheezy", []string{"main"}, []string{}, false)
+	repo2, _ := NewRemoteRepo("tyndex", "http://mirror.yandex.ru/debian/", "wheezy", []string{"main"}, []string{}, false, false)
 	s.collection.Add(repo2)
 
 	r1, _ := s.collection.ByUUID(repo1.UUID)
@@ -640,4 +836,18 @@ SHA1: 66b27417d37e024c46526c2f6d358a754fc552f3
 SHA256: 3608bca1e44ea6c4d268eb6db02260269892c0b42b86bbf1e77a6fa16c3c9282
 `
 
+const exampleUdebPackagesFile = `Package: dpkg-udeb
+Source: dpkg
+Version: 1.15.11
+Architecture: i386
+Maintainer: Dpkg Developers <debian-dpkg@lists.debian.org>
+Installed-Size: 1360
+Section: debian-installer
+Priority: extra
+Filename: pool/main/d/dpkg/dpkg-udeb_1.15.11_i386.udeb
+Size: 4
+MD5sum: edfb5e22c3983df5c333e118af21706a
+Description: Debian package management system for debian-installer
+`
+
 const exampleSourcesFile = sourcePackageMeta
@@ -178,6 +178,9 @@ const (
 	VersionEqual
 	VersionGreaterOrEqual
 	VersionGreater
+	// Pattern and regexp relations are used only in package queries
+	VersionPatternMatch
+	VersionRegexp
 )
 
 // Dependency is a parsed version of Debian dependency to package
@@ -1,7 +1,6 @@
 package files
 
 import (
-	"fmt"
 	"github.com/smira/aptly/aptly"
 	"github.com/smira/aptly/utils"
 	"os"
@@ -39,12 +38,20 @@ func (storage *PublishedStorage) CreateFile(path string) (*os.File, error) {
 }
 
 // RemoveDirs removes directory structure under public path
-func (storage *PublishedStorage) RemoveDirs(path string) error {
+func (storage *PublishedStorage) RemoveDirs(path string, progress aptly.Progress) error {
 	filepath := filepath.Join(storage.rootPath, path)
-	fmt.Printf("Removing %s...\n", filepath)
+	if progress != nil {
+		progress.Printf("Removing %s...\n", filepath)
+	}
 	return os.RemoveAll(filepath)
 }
 
+// Remove removes single file under public path
+func (storage *PublishedStorage) Remove(path string) error {
+	filepath := filepath.Join(storage.rootPath, path)
+	return os.Remove(filepath)
+}
+
 // LinkFromPool links package file from pool to dist's pool location
 //
 // prefix is publishing prefix for this repo (e.g. empty or "ppa/")
@@ -52,9 +59,11 @@ func (storage *PublishedStorage) RemoveDirs(path string) error {
 // poolDirectory is desired location in pool (like liba/libav/)
 // sourcePool is instance of aptly.PackagePool
 // sourcePath is filepath to package file in package pool
+// sourceChecksums are checksums of the package file (not used, as file is hardlinked)
 //
 // LinkFromPool returns relative path for the published file to be included in package index
-func (storage *PublishedStorage) LinkFromPool(prefix string, component string, poolDirectory string, sourcePool aptly.PackagePool, sourcePath string) (string, error) {
+func (storage *PublishedStorage) LinkFromPool(prefix string, component string, poolDirectory string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo) (string, error) {
 	// verify that package pool is local pool is filesystem pool
 	_ = sourcePool.(*PackagePool)
 
@@ -81,3 +90,43 @@ func (storage *PublishedStorage) LinkFromPool(prefix string, component string, p
 func (storage *PublishedStorage) ChecksumsForFile(path string) (utils.ChecksumInfo, error) {
 	return utils.ChecksumsForFile(filepath.Join(storage.rootPath, path))
 }
+
+// Filelist returns list of files under prefix
+func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
+	root := filepath.Join(storage.rootPath, prefix)
+	result := []string{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			result = append(result, path[len(root)+1:])
+		}
+		return nil
+	})
+
+	if err != nil && os.IsNotExist(err) {
+		// file path doesn't exist, consider it empty
+		return []string{}, nil
+	}
+
+	return result, err
+}
+
+// RenameFile renames (moves) file
+func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
+	return os.Rename(filepath.Join(storage.rootPath, oldName), filepath.Join(storage.rootPath, newName))
+}
+
+// HardLink creates hardlink newName pointing to oldName, replacing newName if it exists
+func (storage *PublishedStorage) HardLink(oldName, newName string) error {
+	newPath := filepath.Join(storage.rootPath, newName)
+
+	err := os.Remove(newPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Link(filepath.Join(storage.rootPath, oldName), newPath)
+}
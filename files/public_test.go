@@ -1,6 +1,7 @@
 package files
 
 import (
+	"github.com/smira/aptly/utils"
 	"io/ioutil"
 	. "launchpad.net/gocheck"
 	"os"
@@ -52,13 +53,91 @@ func (s *PublishedStorageSuite) TestRemoveDirs(c *C) {
 	c.Assert(err, IsNil)
 	defer file.Close()
 
-	err = s.storage.RemoveDirs("ppa/dists/")
+	err = s.storage.RemoveDirs("ppa/dists/", nil)
 
 	_, err = os.Stat(filepath.Join(s.storage.rootPath, "ppa/dists/squeeze/Release"))
 	c.Assert(err, NotNil)
 	c.Assert(os.IsNotExist(err), Equals, true)
 }
 
+func (s *PublishedStorageSuite) TestRemove(c *C) {
+	err := s.storage.MkDir("ppa/dists/squeeze/")
+	c.Assert(err, IsNil)
+
+	file, err := s.storage.CreateFile("ppa/dists/squeeze/Release")
+	c.Assert(err, IsNil)
+	file.Close()
+
+	err = s.storage.Remove("ppa/dists/squeeze/Release")
+	c.Assert(err, IsNil)
+
+	_, err = os.Stat(filepath.Join(s.storage.rootPath, "ppa/dists/squeeze/Release"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	_, err = os.Stat(filepath.Join(s.storage.rootPath, "ppa/dists/squeeze"))
+	c.Assert(err, IsNil)
+}
+
+func (s *PublishedStorageSuite) TestRenameFile(c *C) {
+	err := s.storage.MkDir("ppa/dists/squeeze/")
+	c.Assert(err, IsNil)
+
+	file, err := s.storage.CreateFile("ppa/dists/squeeze/Release.tmp")
+	c.Assert(err, IsNil)
+	file.Close()
+
+	err = s.storage.RenameFile("ppa/dists/squeeze/Release.tmp", "ppa/dists/squeeze/Release")
+	c.Assert(err, IsNil)
+
+	_, err = os.Stat(filepath.Join(s.storage.rootPath, "ppa/dists/squeeze/Release"))
+	c.Assert(err, IsNil)
+
+	_, err = os.Stat(filepath.Join(s.storage.rootPath, "ppa/dists/squeeze/Release.tmp"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *PublishedStorageSuite) TestHardLink(c *C) {
+	err := s.storage.MkDir("ppa/dists/squeeze/")
+	c.Assert(err, IsNil)
+
+	file, err := s.storage.CreateFile("ppa/dists/squeeze/Release")
+	c.Assert(err, IsNil)
+	file.WriteString("Origin: ppa\n")
+	file.Close()
+
+	err = s.storage.HardLink("ppa/dists/squeeze/Release", "ppa/dists/squeeze/Release.link")
+	c.Assert(err, IsNil)
+
+	// second time, link is replaced
+	err = s.storage.HardLink("ppa/dists/squeeze/Release", "ppa/dists/squeeze/Release.link")
+	c.Assert(err, IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(s.storage.rootPath, "ppa/dists/squeeze/Release.link"))
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "Origin: ppa\n")
+}
+
+func (s *PublishedStorageSuite) TestFilelist(c *C) {
+	list, err := s.storage.Filelist("ppa/pool/main")
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{})
+
+	for _, path := range []string{"ppa/pool/main/a/alien-arena", "ppa/pool/main/m/mars-invaders"} {
+		err = s.storage.MkDir(path)
+		c.Assert(err, IsNil)
+	}
+
+	for _, path := range []string{"ppa/pool/main/a/alien-arena/alien-arena_7.40.deb", "ppa/pool/main/m/mars-invaders/mars-invaders_1.03.deb"} {
+		file, err := s.storage.CreateFile(path)
+		c.Assert(err, IsNil)
+		file.Close()
+	}
+
+	list, err = s.storage.Filelist("ppa/pool/main")
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"a/alien-arena/alien-arena_7.40.deb", "m/mars-invaders/mars-invaders_1.03.deb"})
+}
+
 func (s *PublishedStorageSuite) TestLinkFromPool(c *C) {
 	tests := []struct {
 		prefix           string
@@ -108,7 +187,7 @@ func (s *PublishedStorageSuite) TestLinkFromPool(c *C) {
 		err = ioutil.WriteFile(t.sourcePath, []byte("Contents"), 0644)
 		c.Assert(err, IsNil)
 
-		path, err := s.storage.LinkFromPool(t.prefix, t.component, t.poolDirectory, pool, t.sourcePath)
+		path, err := s.storage.LinkFromPool(t.prefix, t.component, t.poolDirectory, pool, t.sourcePath, utils.ChecksumInfo{})
 		c.Assert(err, IsNil)
 		c.Assert(path, Equals, t.expectedFilename)
 
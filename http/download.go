@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"github.com/smira/aptly/aptly"
 	"github.com/smira/aptly/utils"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Check interface
@@ -28,8 +32,33 @@ type downloaderImpl struct {
 	unpause  chan bool
 	progress aptly.Progress
 	threads  int
+	client   *http.Client
+	netrc    *netrc
+	limiter  *rateLimiter
+	options  DownloaderOptions
 }
 
+// DownloaderOptions controls timeouts and retrying of downloads
+type DownloaderOptions struct {
+	// Retries is number of additional attempts after transient failure
+	Retries int
+	// RetryDelay is delay before first retry, doubled on every next attempt
+	RetryDelay time.Duration
+	// ConnectTimeout limits time to establish connection, 0 means no limit
+	ConnectTimeout time.Duration
+	// ReadTimeout limits time to wait for data from server, 0 means no limit
+	ReadTimeout time.Duration
+	// LinkLocal enables hardlinking of files from file:// archives instead of copying
+	LinkLocal bool
+	// SpeedLimit is bandwidth cap in bytes per second shared by all threads, 0 means no limit
+	SpeedLimit int64
+	// Transport configures proxy, TLS and credentials
+	Transport TransportOptions
+}
+
+// maxRetryDelay caps exponential backoff between retries
+const maxRetryDelay = time.Minute
+
 // downloadTask represents single item in queue
 type downloadTask struct {
 	url            string
@@ -42,6 +71,13 @@ type downloadTask struct {
 // NewDownloader creates new instance of Downloader which specified number
 // of threads
 func NewDownloader(threads int, progress aptly.Progress) aptly.Downloader {
+	downloader, _ := NewDownloaderWithOptions(threads, progress, DownloaderOptions{})
+	return downloader
+}
+
+// NewDownloaderWithOptions creates new instance of Downloader which specified number
+// of threads, retry policy, timeouts and transport settings
+func NewDownloaderWithOptions(threads int, progress aptly.Progress, options DownloaderOptions) (aptly.Downloader, error) {
 	downloader := &downloaderImpl{
 		queue:    make(chan *downloadTask, 1000),
 		stop:     make(chan bool),
@@ -50,13 +86,60 @@ func NewDownloader(threads int, progress aptly.Progress) aptly.Downloader {
 		unpause:  make(chan bool),
 		threads:  threads,
 		progress: progress,
+		options:  options,
+	}
+
+	transport, err := newTransport(options.Transport, downloader.dial)
+	if err != nil {
+		return nil, err
+	}
+	downloader.client = &http.Client{Transport: transport}
+
+	if options.Transport.Netrc != "" {
+		downloader.netrc, err = loadNetrc(options.Transport.Netrc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if options.SpeedLimit > 0 {
+		downloader.limiter = newRateLimiter(options.SpeedLimit)
 	}
 
 	for i := 0; i < downloader.threads; i++ {
 		go downloader.process()
 	}
 
-	return downloader
+	return downloader, nil
+}
+
+// timeoutConn is net.Conn which fails reads if no data arrives within timeout
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+// Read extends read deadline before every read
+func (conn *timeoutConn) Read(b []byte) (int, error) {
+	err := conn.Conn.SetReadDeadline(time.Now().Add(conn.timeout))
+	if err != nil {
+		return 0, err
+	}
+	return conn.Conn.Read(b)
+}
+
+// dial establishes connection applying configured timeouts
+func (downloader *downloaderImpl) dial(network, addr string) (net.Conn, error) {
+	conn, err := net.DialTimeout(network, addr, downloader.options.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if downloader.options.ReadTimeout > 0 {
+		return &timeoutConn{Conn: conn, timeout: downloader.options.ReadTimeout}, nil
+	}
+
+	return conn, nil
 }
 
 // Shutdown stops downloader after current tasks are finished,
@@ -90,6 +173,14 @@ func (downloader *downloaderImpl) GetProgress() aptly.Progress {
 	return downloader.progress
 }
 
+// BarPrefix returns text to display in front of download progress bars: bandwidth limit, if any
+func (downloader *downloaderImpl) BarPrefix() string {
+	if downloader.options.SpeedLimit > 0 {
+		return fmt.Sprintf("[limit %s/s] ", utils.HumanBytes(downloader.options.SpeedLimit))
+	}
+	return ""
+}
+
 // Download starts new download task
 func (downloader *downloaderImpl) Download(url string, destination string, result chan<- error) {
 	downloader.DownloadWithChecksum(url, destination, result, utils.ChecksumInfo{Size: -1}, false)
@@ -101,38 +192,163 @@ func (downloader *downloaderImpl) DownloadWithChecksum(url string, destination s
 	downloader.queue <- &downloadTask{url: url, destination: destination, result: result, expected: expected, ignoreMismatch: ignoreMismatch}
 }
 
-// handleTask processes single download task
+// downloadError is error which might be retried
+type downloadError struct {
+	err       error
+	retryable bool
+}
+
+func (e *downloadError) Error() string {
+	return e.err.Error()
+}
+
+// permanent marks error as not worth retrying
+func permanent(err error) error {
+	return &downloadError{err: err, retryable: false}
+}
+
+// transient marks error as worth retrying
+func transient(err error) error {
+	return &downloadError{err: err, retryable: true}
+}
+
+// isRetryable checks whether download failure should be retried
+func isRetryable(err error) bool {
+	if e, ok := err.(*downloadError); ok {
+		return e.retryable
+	}
+	return false
+}
+
+// unwrap returns original error
+func unwrap(err error) error {
+	if e, ok := err.(*downloadError); ok {
+		return e.err
+	}
+	return err
+}
+
+// handleTask processes single download task, retrying on transient failures
 func (downloader *downloaderImpl) handleTask(task *downloadTask) {
-	downloader.progress.Printf("Downloading %s...\n", task.url)
+	downloader.progress.Printf("Downloading %s...\n", SanitizeURL(task.url))
+
+	delay := downloader.options.RetryDelay
+
+	for attempt := 0; ; attempt++ {
+		err := downloader.download(task, attempt == 0)
+		if err == nil || !isRetryable(err) || attempt >= downloader.options.Retries {
+			if err != nil && attempt > 0 {
+				downloader.progress.Printf("Giving up on %s after %d attempts: %s\n", SanitizeURL(task.url), attempt+1, unwrap(err))
+			}
+			task.result <- unwrap(err)
+			return
+		}
 
-	resp, err := http.Get(task.url)
+		downloader.progress.Printf("Error downloading %s: %s, retrying in %s (%d/%d)...\n", SanitizeURL(task.url), unwrap(err),
+			delay, attempt+1, downloader.options.Retries)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// download makes single attempt to fetch task, resuming partially downloaded
+// file if it's left from previous attempt
+func (downloader *downloaderImpl) download(task *downloadTask, firstAttempt bool) error {
+	err := os.MkdirAll(filepath.Dir(task.destination), 0755)
 	if err != nil {
-		task.result <- err
-		return
+		return permanent(err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		task.result <- fmt.Errorf("HTTP code %d while fetching %s", resp.StatusCode, task.url)
-		return
+	temppath := task.destination + ".down"
+
+	if strings.HasPrefix(task.url, "file://") {
+		return downloader.importLocal(task, temppath)
+	}
+
+	var offset int64
+	st, err := os.Stat(temppath)
+	if err == nil {
+		offset = st.Size()
+		if task.expected.Size != -1 && offset > task.expected.Size {
+			offset = 0
+		}
 	}
 
-	err = os.MkdirAll(filepath.Dir(task.destination), 0755)
+	req, err := http.NewRequest("GET", task.url, nil)
 	if err != nil {
-		task.result <- err
-		return
+		return permanent(err)
+	}
+	if req.URL.User == nil && downloader.netrc != nil {
+		if credentials := downloader.netrc.lookup(req.URL.Host); credentials != nil {
+			req.SetBasicAuth(credentials.login, credentials.password)
+		}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
 	}
 
-	temppath := task.destination + ".down"
+	resp, err := downloader.client.Do(req)
+	if err != nil {
+		return transient(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+		// partial file is stale, start from scratch next time
+		os.Remove(temppath)
+		return transient(fmt.Errorf("HTTP code %d while resuming %s", resp.StatusCode, task.url))
+	}
 
-	outfile, err := os.Create(temppath)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("HTTP code %d while fetching %s", resp.StatusCode, task.url)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == 429 {
+			return transient(err)
+		}
+		return permanent(err)
+	}
+
+	resumed := resp.StatusCode == http.StatusPartialContent
+	if resumed && (offset == 0 || !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset))) {
+		os.Remove(temppath)
+		return transient(fmt.Errorf("unexpected Content-Range %#v while fetching %s", resp.Header.Get("Content-Range"), task.url))
+	}
+
+	var outfile *os.File
+	if resumed {
+		outfile, err = os.OpenFile(temppath, os.O_RDWR, 0644)
+	} else {
+		outfile, err = os.Create(temppath)
+	}
 	if err != nil {
-		task.result <- err
-		return
+		return permanent(err)
 	}
 	defer outfile.Close()
 
 	checksummer := utils.NewChecksumWriter()
+
+	if resumed {
+		if task.expected.Size != -1 {
+			_, err = io.CopyN(checksummer, outfile, offset)
+			if err != nil {
+				return permanent(err)
+			}
+		}
+
+		_, err = outfile.Seek(offset, 0)
+		if err != nil {
+			return permanent(err)
+		}
+
+		if firstAttempt {
+			// bytes downloaded in previous run
+			downloader.progress.AddBar(int(offset))
+		}
+	}
+
 	writers := []io.Writer{outfile, downloader.progress}
 
 	if task.expected.Size != -1 {
@@ -141,45 +357,59 @@ func (downloader *downloaderImpl) handleTask(task *downloadTask) {
 
 	w := io.MultiWriter(writers...)
 
-	_, err = io.Copy(w, resp.Body)
+	var body io.Reader = resp.Body
+	if downloader.limiter != nil {
+		body = &limitedReader{r: resp.Body, limiter: downloader.limiter}
+	}
+
+	_, err = io.Copy(w, body)
 	if err != nil {
-		os.Remove(temppath)
-		task.result <- err
-		return
+		// keep partial file, so that next attempt could resume
+		return transient(err)
 	}
 
 	if task.expected.Size != -1 {
-		actual := checksummer.Sum()
-
-		if actual.Size != task.expected.Size {
-			err = fmt.Errorf("%s: size check mismatch %d != %d", task.url, actual.Size, task.expected.Size)
-		} else if task.expected.MD5 != "" && actual.MD5 != task.expected.MD5 {
-			err = fmt.Errorf("%s: md5 hash mismatch %#v != %#v", task.url, actual.MD5, task.expected.MD5)
-		} else if task.expected.SHA1 != "" && actual.SHA1 != task.expected.SHA1 {
-			err = fmt.Errorf("%s: sha1 hash mismatch %#v != %#v", task.url, actual.SHA1, task.expected.SHA1)
-		} else if task.expected.SHA256 != "" && actual.SHA256 != task.expected.SHA256 {
-			err = fmt.Errorf("%s: sha256 hash mismatch %#v != %#v", task.url, actual.SHA256, task.expected.SHA256)
-		}
-
+		err = downloader.verify(task, checksummer.Sum())
 		if err != nil {
-			if task.ignoreMismatch {
-				downloader.progress.Printf("WARNING: %s\n", err.Error())
-			} else {
-				os.Remove(temppath)
-				task.result <- err
-				return
+			os.Remove(temppath)
+			if resumed {
+				// partial file might have been left from different version of the file
+				return transient(err)
 			}
+			return permanent(err)
 		}
 	}
 
 	err = os.Rename(temppath, task.destination)
 	if err != nil {
 		os.Remove(temppath)
-		task.result <- err
-		return
+		return permanent(err)
+	}
+
+	return nil
+}
+
+// verify compares actual checksums with expected ones, mismatch is
+// reported as warning if task ignores mismatches
+func (downloader *downloaderImpl) verify(task *downloadTask, actual utils.ChecksumInfo) error {
+	var err error
+
+	if actual.Size != task.expected.Size {
+		err = fmt.Errorf("%s: size check mismatch %d != %d", task.url, actual.Size, task.expected.Size)
+	} else if task.expected.MD5 != "" && actual.MD5 != task.expected.MD5 {
+		err = fmt.Errorf("%s: md5 hash mismatch %#v != %#v", task.url, actual.MD5, task.expected.MD5)
+	} else if task.expected.SHA1 != "" && actual.SHA1 != task.expected.SHA1 {
+		err = fmt.Errorf("%s: sha1 hash mismatch %#v != %#v", task.url, actual.SHA1, task.expected.SHA1)
+	} else if task.expected.SHA256 != "" && actual.SHA256 != task.expected.SHA256 {
+		err = fmt.Errorf("%s: sha256 hash mismatch %#v != %#v", task.url, actual.SHA256, task.expected.SHA256)
+	}
+
+	if err != nil && task.ignoreMismatch {
+		downloader.progress.Printf("WARNING: %s\n", err.Error())
+		return nil
 	}
 
-	task.result <- nil
+	return err
 }
 
 // process implements download thread in goroutine
@@ -217,7 +447,7 @@ func DownloadTempWithChecksum(downloader aptly.Downloader, url string, expected
 	tempfile := filepath.Join(tempdir, "buffer")
 
 	if expected.Size != -1 && downloader.GetProgress() != nil {
-		downloader.GetProgress().InitBar(expected.Size, true)
+		downloader.GetProgress().InitBarWithPrefix(expected.Size, true, downloader.BarPrefix())
 		defer downloader.GetProgress().ShutdownBar()
 	}
 
@@ -238,11 +468,20 @@ func DownloadTempWithChecksum(downloader aptly.Downloader, url string, expected
 	return file, nil
 }
 
-// List of extensions + corresponding uncompression support
+// List of extensions + corresponding uncompression support, in order of preference
+// (smallest files first)
 var compressionMethods = []struct {
 	extenstion     string
 	transformation func(io.Reader) (io.Reader, error)
 }{
+	{
+		extenstion:     ".xz",
+		transformation: func(r io.Reader) (io.Reader, error) { return xz.NewReader(r) },
+	},
+	{
+		extenstion:     ".lzma",
+		transformation: func(r io.Reader) (io.Reader, error) { return lzma.NewReader(r) },
+	},
 	{
 		extenstion:     ".bz2",
 		transformation: func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil },
@@ -257,27 +496,38 @@ var compressionMethods = []struct {
 	},
 }
 
-// DownloadTryCompression tries to download from URL .bz2, .gz and raw extension until
+// DownloadTryCompression tries to download from URL .xz, .lzma, .bz2, .gz and raw extension until
 // it finds existing file.
+//
+// If expectedChecksums lists some of the extensions, only those are tried, otherwise
+// every extension is probed.
 func DownloadTryCompression(downloader aptly.Downloader, url string, expectedChecksums map[string]utils.ChecksumInfo, ignoreMismatch bool) (io.Reader, *os.File, error) {
 	var err error
 
+	listed := make(map[string]utils.ChecksumInfo)
 	for _, method := range compressionMethods {
-		var file *os.File
-
 		tryURL := url + method.extenstion
-		foundChecksum := false
 
 		for suffix, expected := range expectedChecksums {
 			if strings.HasSuffix(tryURL, suffix) {
-				file, err = DownloadTempWithChecksum(downloader, tryURL, expected, ignoreMismatch)
-				foundChecksum = true
+				listed[method.extenstion] = expected
 				break
 			}
 		}
+	}
+
+	for _, method := range compressionMethods {
+		var file *os.File
 
-		if !foundChecksum {
+		tryURL := url + method.extenstion
+		expected, foundChecksum := listed[method.extenstion]
+
+		if foundChecksum {
+			file, err = DownloadTempWithChecksum(downloader, tryURL, expected, ignoreMismatch)
+		} else if len(listed) == 0 {
 			file, err = DownloadTemp(downloader, tryURL)
+		} else {
+			continue
 		}
 
 		if err != nil {
@@ -287,6 +537,8 @@ func DownloadTryCompression(downloader aptly.Downloader, url string, expectedChe
 		var uncompressed io.Reader
 		uncompressed, err = method.transformation(file)
 		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
 			continue
 		}
 
@@ -11,8 +11,12 @@ import (
 	. "launchpad.net/gocheck"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -79,6 +83,17 @@ func (s *DownloaderSuite) TestPauseResume(c *C) {
 	d.Resume()
 }
 
+func (s *DownloaderSuite) TestBarPrefix(c *C) {
+	d := NewDownloader(1, s.progress)
+	c.Check(d.BarPrefix(), Equals, "")
+	d.Shutdown()
+
+	d, err := NewDownloaderWithOptions(1, s.progress, DownloaderOptions{SpeedLimit: 2048})
+	c.Assert(err, IsNil)
+	c.Check(d.BarPrefix(), Equals, "[limit 2.00 KiB/s] ")
+	d.Shutdown()
+}
+
 func (s *DownloaderSuite) TestDownloadOK(c *C) {
 	d := NewDownloader(2, s.progress)
 	defer d.Shutdown()
@@ -201,6 +216,8 @@ func (s *DownloaderSuite) TestDownloadTempError(c *C) {
 }
 
 const (
+	xzData   = "\xfd7zXZ\x00\x00\x04\xe6\xd6\xb4F\x02\x00!\x01\x16\x00\x00\x00t/\xe5\xa3\x01\x00\x03test\x00\xa5u\f\xc1\xa7\xfd\x15\xfa\x00\x01\x1c\x04o,\x9c\xc1\x1f\xb6\xf3}\x01\x00\x00\x00\x00\x04YZ"
+	lzmaData = "]\x00\x00\x80\x00\xff\xff\xff\xff\xff\xff\xff\xff\x00:\x19J\xce&r\x83\x9f\xff\xfb\x13\x80\x00"
 	bzipData = "BZh91AY&SY\xcc\xc3q\xd4\x00\x00\x02A\x80\x00\x10\x02\x00\x0c\x00 \x00!\x9ah3M\x19\x97\x8b\xb9\"\x9c(Hfa\xb8\xea\x00"
 	gzipData = "\x1f\x8b\x08\x00\xc8j\xb0R\x00\x03+I-.\xe1\x02\x00\xc65\xb9;\x05\x00\x00\x00"
 	rawData  = "test"
@@ -210,15 +227,17 @@ func (s *DownloaderSuite) TestDownloadTryCompression(c *C) {
 	var buf []byte
 
 	expectedChecksums := map[string]utils.ChecksumInfo{
-		"file.bz2": utils.ChecksumInfo{Size: int64(len(bzipData))},
-		"file.gz":  utils.ChecksumInfo{Size: int64(len(gzipData))},
-		"file":     utils.ChecksumInfo{Size: int64(len(rawData))},
+		"file.xz":   utils.ChecksumInfo{Size: int64(len(xzData))},
+		"file.lzma": utils.ChecksumInfo{Size: int64(len(lzmaData))},
+		"file.bz2":  utils.ChecksumInfo{Size: int64(len(bzipData))},
+		"file.gz":   utils.ChecksumInfo{Size: int64(len(gzipData))},
+		"file":      utils.ChecksumInfo{Size: int64(len(rawData))},
 	}
 
-	// bzip2 only available
+	// xz available
 	buf = make([]byte, 4)
 	d := NewFakeDownloader()
-	d.ExpectResponse("http://example.com/file.bz2", bzipData)
+	d.ExpectResponse("http://example.com/file.xz", xzData)
 	r, file, err := DownloadTryCompression(d, "http://example.com/file", expectedChecksums, false)
 	c.Assert(err, IsNil)
 	defer file.Close()
@@ -226,9 +245,46 @@ func (s *DownloaderSuite) TestDownloadTryCompression(c *C) {
 	c.Assert(string(buf), Equals, rawData)
 	c.Assert(d.Empty(), Equals, true)
 
+	// xz not available, but lzma is
+	buf = make([]byte, 4)
+	d = NewFakeDownloader()
+	d.ExpectError("http://example.com/file.xz", errors.New("404"))
+	d.ExpectResponse("http://example.com/file.lzma", lzmaData)
+	r, file, err = DownloadTryCompression(d, "http://example.com/file", expectedChecksums, false)
+	c.Assert(err, IsNil)
+	defer file.Close()
+	io.ReadFull(r, buf)
+	c.Assert(string(buf), Equals, rawData)
+	c.Assert(d.Empty(), Equals, true)
+
+	// bzip2 only available
+	buf = make([]byte, 4)
+	d = NewFakeDownloader()
+	d.ExpectError("http://example.com/file.xz", errors.New("404"))
+	d.ExpectError("http://example.com/file.lzma", errors.New("404"))
+	d.ExpectResponse("http://example.com/file.bz2", bzipData)
+	r, file, err = DownloadTryCompression(d, "http://example.com/file", expectedChecksums, false)
+	c.Assert(err, IsNil)
+	defer file.Close()
+	io.ReadFull(r, buf)
+	c.Assert(string(buf), Equals, rawData)
+	c.Assert(d.Empty(), Equals, true)
+
+	// xz available, but doesn't match checksum from Release file
+	d = NewFakeDownloader()
+	d.ExpectResponse("http://example.com/file.xz", gzipData)
+	d.ExpectError("http://example.com/file.lzma", errors.New("404"))
+	d.ExpectResponse("http://example.com/file.bz2", bzipData)
+	r, file, err = DownloadTryCompression(d, "http://example.com/file", expectedChecksums, false)
+	c.Assert(err, IsNil)
+	defer file.Close()
+	c.Assert(d.Empty(), Equals, true)
+
 	// bzip2 not available, but gz is
 	buf = make([]byte, 4)
 	d = NewFakeDownloader()
+	d.ExpectError("http://example.com/file.xz", errors.New("404"))
+	d.ExpectError("http://example.com/file.lzma", errors.New("404"))
 	d.ExpectError("http://example.com/file.bz2", errors.New("404"))
 	d.ExpectResponse("http://example.com/file.gz", gzipData)
 	r, file, err = DownloadTryCompression(d, "http://example.com/file", expectedChecksums, false)
@@ -241,6 +297,8 @@ func (s *DownloaderSuite) TestDownloadTryCompression(c *C) {
 	// bzip2 & gzip not available, but raw is
 	buf = make([]byte, 4)
 	d = NewFakeDownloader()
+	d.ExpectError("http://example.com/file.xz", errors.New("404"))
+	d.ExpectError("http://example.com/file.lzma", errors.New("404"))
 	d.ExpectError("http://example.com/file.bz2", errors.New("404"))
 	d.ExpectError("http://example.com/file.gz", errors.New("404"))
 	d.ExpectResponse("http://example.com/file", rawData)
@@ -254,6 +312,8 @@ func (s *DownloaderSuite) TestDownloadTryCompression(c *C) {
 	// gzip available, but broken
 	buf = make([]byte, 4)
 	d = NewFakeDownloader()
+	d.ExpectError("http://example.com/file.xz", errors.New("404"))
+	d.ExpectError("http://example.com/file.lzma", errors.New("404"))
 	d.ExpectError("http://example.com/file.bz2", errors.New("404"))
 	d.ExpectResponse("http://example.com/file.gz", "x")
 	d.ExpectResponse("http://example.com/file", "recovered")
@@ -271,6 +331,8 @@ func (s *DownloaderSuite) TestDownloadTryCompressionErrors(c *C) {
 	c.Assert(err, ErrorMatches, "unexpected request.*")
 
 	d = NewFakeDownloader()
+	d.ExpectError("http://example.com/file.xz", errors.New("404"))
+	d.ExpectError("http://example.com/file.lzma", errors.New("404"))
 	d.ExpectError("http://example.com/file.bz2", errors.New("404"))
 	d.ExpectError("http://example.com/file.gz", errors.New("404"))
 	d.ExpectError("http://example.com/file", errors.New("403"))
@@ -278,9 +340,239 @@ func (s *DownloaderSuite) TestDownloadTryCompressionErrors(c *C) {
 	c.Assert(err, ErrorMatches, "403")
 
 	d = NewFakeDownloader()
-	d.ExpectError("http://example.com/file.bz2", errors.New("404"))
-	d.ExpectError("http://example.com/file.gz", errors.New("404"))
 	d.ExpectResponse("http://example.com/file", rawData)
 	_, _, err = DownloadTryCompression(d, "http://example.com/file", map[string]utils.ChecksumInfo{"file": utils.ChecksumInfo{Size: 7}}, false)
 	c.Assert(err, ErrorMatches, "checksums don't match.*")
+
+	d = NewFakeDownloader()
+	d.ExpectError("http://example.com/file.gz", errors.New("404"))
+	_, _, err = DownloadTryCompression(d, "http://example.com/file", map[string]utils.ChecksumInfo{"file.gz": utils.ChecksumInfo{Size: 7}}, false)
+	c.Assert(err, ErrorMatches, "404")
+	c.Assert(d.Empty(), Equals, true)
+}
+
+func (s *DownloaderSuite) TestDownloadTryCompressionListed(c *C) {
+	var buf []byte
+
+	// only extensions listed in Release file are tried
+	buf = make([]byte, 4)
+	d := NewFakeDownloader()
+	d.ExpectError("http://example.com/file.gz", errors.New("404"))
+	d.ExpectResponse("http://example.com/file", rawData)
+	r, file, err := DownloadTryCompression(d, "http://example.com/file", map[string]utils.ChecksumInfo{
+		"file.gz": utils.ChecksumInfo{Size: int64(len(gzipData))},
+		"file":    utils.ChecksumInfo{Size: int64(len(rawData))},
+	}, false)
+	c.Assert(err, IsNil)
+	defer file.Close()
+	io.ReadFull(r, buf)
+	c.Assert(string(buf), Equals, rawData)
+	c.Assert(d.Empty(), Equals, true)
+
+	// other files from Release don't affect the choice
+	buf = make([]byte, 4)
+	d = NewFakeDownloader()
+	d.ExpectResponse("http://example.com/file.bz2", bzipData)
+	r, file, err = DownloadTryCompression(d, "http://example.com/file", map[string]utils.ChecksumInfo{
+		"file.bz2":  utils.ChecksumInfo{Size: int64(len(bzipData))},
+		"other.xz":  utils.ChecksumInfo{Size: 5},
+		"other.gz":  utils.ChecksumInfo{Size: 5},
+		"other.bz2": utils.ChecksumInfo{Size: 5},
+	}, false)
+	c.Assert(err, IsNil)
+	defer file.Close()
+	io.ReadFull(r, buf)
+	c.Assert(string(buf), Equals, rawData)
+	c.Assert(d.Empty(), Equals, true)
+
+	// nothing listed for the file, every extension is probed
+	buf = make([]byte, 4)
+	d = NewFakeDownloader()
+	d.ExpectError("http://example.com/file.xz", errors.New("404"))
+	d.ExpectError("http://example.com/file.lzma", errors.New("404"))
+	d.ExpectResponse("http://example.com/file.bz2", bzipData)
+	r, file, err = DownloadTryCompression(d, "http://example.com/file", map[string]utils.ChecksumInfo{
+		"other": utils.ChecksumInfo{Size: 5},
+	}, false)
+	c.Assert(err, IsNil)
+	defer file.Close()
+	io.ReadFull(r, buf)
+	c.Assert(string(buf), Equals, rawData)
+	c.Assert(d.Empty(), Equals, true)
+}
+
+type DownloaderRetrySuite struct {
+	server   *httptest.Server
+	handler  func(w http.ResponseWriter, r *http.Request, attempt int)
+	attempts int
+	ranges   []string
+	dest     string
+	progress aptly.Progress
+	options  DownloaderOptions
+}
+
+var _ = Suite(&DownloaderRetrySuite{})
+
+const retryContent = "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt"
+
+var retryChecksum = utils.ChecksumInfo{Size: int64(len(retryContent)), MD5: "d0b795915de6ec4630bf2a0d0bd8ecd1"}
+
+func (s *DownloaderRetrySuite) SetUpTest(c *C) {
+	s.attempts = 0
+	s.ranges = nil
+	s.handler = nil
+	s.dest = filepath.Join(c.MkDir(), "file")
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.attempts++
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.handler(w, r, s.attempts)
+	}))
+
+	s.options = DownloaderOptions{Retries: 3, RetryDelay: time.Millisecond}
+
+	s.progress = console.NewProgress()
+	s.progress.Start()
+}
+
+func (s *DownloaderRetrySuite) TearDownTest(c *C) {
+	s.progress.Shutdown()
+	s.server.Close()
+}
+
+func (s *DownloaderRetrySuite) download(expected utils.ChecksumInfo) error {
+	d, err := NewDownloaderWithOptions(1, s.progress, s.options)
+	if err != nil {
+		return err
+	}
+	defer d.Shutdown()
+
+	ch := make(chan error)
+	d.DownloadWithChecksum(s.server.URL+"/file", s.dest, ch, expected, false)
+	return <-ch
+}
+
+func serveContent(w http.ResponseWriter, r *http.Request) {
+	http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(retryContent))
+}
+
+func serveTruncated(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(retryContent)))
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, retryContent[:30])
+}
+
+func (s *DownloaderRetrySuite) checkDestination(c *C) {
+	content, err := ioutil.ReadFile(s.dest)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, retryContent)
+
+	_, err = os.Stat(s.dest + ".down")
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *DownloaderRetrySuite) TestRetryServerError(c *C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request, attempt int) {
+		if attempt < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		serveContent(w, r)
+	}
+
+	c.Assert(s.download(retryChecksum), IsNil)
+	c.Check(s.attempts, Equals, 3)
+	s.checkDestination(c)
+}
+
+func (s *DownloaderRetrySuite) TestRetryExhausted(c *C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request, attempt int) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	}
+
+	c.Check(s.download(retryChecksum), ErrorMatches, "HTTP code 500 while fetching .*")
+	c.Check(s.attempts, Equals, 4)
+}
+
+func (s *DownloaderRetrySuite) TestNoRetryNotFound(c *C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request, attempt int) {
+		http.NotFound(w, r)
+	}
+
+	c.Check(s.download(retryChecksum), ErrorMatches, "HTTP code 404 while fetching .*")
+	c.Check(s.attempts, Equals, 1)
+}
+
+func (s *DownloaderRetrySuite) TestResumeAfterTruncation(c *C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request, attempt int) {
+		if attempt == 1 {
+			serveTruncated(w, r)
+			return
+		}
+		serveContent(w, r)
+	}
+
+	c.Assert(s.download(retryChecksum), IsNil)
+	c.Check(s.ranges, DeepEquals, []string{"", "bytes=30-"})
+	s.checkDestination(c)
+}
+
+func (s *DownloaderRetrySuite) TestPartialFileKeptOnFailure(c *C) {
+	s.options.Retries = 0
+	s.handler = func(w http.ResponseWriter, r *http.Request, attempt int) {
+		if attempt == 1 {
+			serveTruncated(w, r)
+			return
+		}
+		serveContent(w, r)
+	}
+
+	c.Check(s.download(retryChecksum), NotNil)
+
+	st, err := os.Stat(s.dest + ".down")
+	c.Assert(err, IsNil)
+	c.Check(st.Size(), Equals, int64(30))
+
+	// next run resumes download
+	c.Assert(s.download(retryChecksum), IsNil)
+	c.Check(s.ranges, DeepEquals, []string{"", "bytes=30-"})
+	s.checkDestination(c)
+}
+
+func (s *DownloaderRetrySuite) TestResumeStalePartialFile(c *C) {
+	c.Assert(ioutil.WriteFile(s.dest+".down", []byte("garbage"), 0644), IsNil)
+
+	s.handler = func(w http.ResponseWriter, r *http.Request, attempt int) {
+		serveContent(w, r)
+	}
+
+	c.Assert(s.download(retryChecksum), IsNil)
+	c.Check(s.ranges, DeepEquals, []string{"bytes=7-", ""})
+	s.checkDestination(c)
+}
+
+func (s *DownloaderRetrySuite) TestResumeNotSupported(c *C) {
+	c.Assert(ioutil.WriteFile(s.dest+".down", []byte(retryContent[:10]), 0644), IsNil)
+
+	s.handler = func(w http.ResponseWriter, r *http.Request, attempt int) {
+		io.WriteString(w, retryContent)
+	}
+
+	c.Assert(s.download(retryChecksum), IsNil)
+	c.Check(s.attempts, Equals, 1)
+	s.checkDestination(c)
+}
+
+func (s *DownloaderRetrySuite) TestReadTimeout(c *C) {
+	s.options.ReadTimeout = 50 * time.Millisecond
+	s.handler = func(w http.ResponseWriter, r *http.Request, attempt int) {
+		if attempt == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		serveContent(w, r)
+	}
+
+	c.Assert(s.download(retryChecksum), IsNil)
+	c.Check(s.attempts, Equals, 2)
+	s.checkDestination(c)
 }
@@ -135,3 +135,8 @@ func (f *FakeDownloader) Resume() {
 func (f *FakeDownloader) GetProgress() aptly.Progress {
 	return nil
 }
+
+// BarPrefix returns empty prefix
+func (f *FakeDownloader) BarPrefix() string {
+	return ""
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"fmt"
+	"github.com/smira/aptly/utils"
+	"io"
+	"net/url"
+	"os"
+)
+
+// LocalPathToURL converts path to local archive into file:// URL
+func LocalPathToURL(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// importLocal fetches file from local archive (file:// URL) by hardlinking
+// or copying it, checksums are verified the same way as for downloads
+func (downloader *downloaderImpl) importLocal(task *downloadTask, temppath string) error {
+	u, err := url.Parse(task.url)
+	if err != nil {
+		return permanent(err)
+	}
+
+	source := u.Path
+
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return permanent(fmt.Errorf("file %s doesn't exist", source))
+		}
+		return permanent(err)
+	}
+	if sourceInfo.IsDir() {
+		return permanent(fmt.Errorf("%s is a directory", source))
+	}
+
+	os.Remove(temppath)
+
+	linked := false
+	if downloader.options.LinkLocal {
+		// hardlinking fails across filesystems, fall back to copying then
+		linked = os.Link(source, temppath) == nil
+	}
+
+	if linked {
+		downloader.progress.AddBar(int(sourceInfo.Size()))
+	} else {
+		err = copyLocal(source, temppath, downloader.progress)
+		if err != nil {
+			os.Remove(temppath)
+			return permanent(err)
+		}
+	}
+
+	if task.expected.Size != -1 {
+		var actual utils.ChecksumInfo
+
+		actual, err = utils.ChecksumsForFile(temppath)
+		if err != nil {
+			os.Remove(temppath)
+			return permanent(err)
+		}
+
+		err = downloader.verify(task, actual)
+		if err != nil {
+			os.Remove(temppath)
+			return permanent(err)
+		}
+	}
+
+	err = os.Rename(temppath, task.destination)
+	if err != nil {
+		os.Remove(temppath)
+		return permanent(err)
+	}
+
+	return nil
+}
+
+// copyLocal copies file reporting progress
+func copyLocal(source, destination string, progress io.Writer) error {
+	infile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer infile.Close()
+
+	outfile, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+
+	_, err = io.Copy(io.MultiWriter(outfile, progress), infile)
+	return err
+}
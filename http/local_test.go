@@ -0,0 +1,110 @@
+package http
+
+import (
+	"github.com/smira/aptly/aptly"
+	"github.com/smira/aptly/console"
+	"github.com/smira/aptly/utils"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"os"
+	"path/filepath"
+)
+
+type LocalSuite struct {
+	archive  string
+	dest     string
+	progress aptly.Progress
+}
+
+var _ = Suite(&LocalSuite{})
+
+const localContent = "Package: aptly\nVersion: 0.5\n"
+
+var localChecksum = utils.ChecksumInfo{Size: int64(len(localContent)), MD5: "b57fd753490906a6a257e9471bf8e99b"}
+
+func (s *LocalSuite) SetUpTest(c *C) {
+	s.archive = filepath.Join(c.MkDir(), "dvd")
+	os.MkdirAll(filepath.Join(s.archive, "dists", "stable"), 0755)
+	ioutil.WriteFile(filepath.Join(s.archive, "dists", "stable", "Release"), []byte(localContent), 0644)
+
+	s.dest = filepath.Join(c.MkDir(), "pool", "Release")
+
+	s.progress = console.NewProgress()
+	s.progress.Start()
+}
+
+func (s *LocalSuite) TearDownTest(c *C) {
+	s.progress.Shutdown()
+}
+
+func (s *LocalSuite) download(options DownloaderOptions, path string, expected utils.ChecksumInfo) error {
+	d, err := NewDownloaderWithOptions(1, s.progress, options)
+	if err != nil {
+		return err
+	}
+	defer d.Shutdown()
+
+	ch := make(chan error)
+	d.DownloadWithChecksum(LocalPathToURL(filepath.Join(s.archive, path)), s.dest, ch, expected, false)
+	return <-ch
+}
+
+func (s *LocalSuite) TestLocalPathToURL(c *C) {
+	c.Check(LocalPathToURL("/media/cdrom"), Equals, "file:///media/cdrom")
+	c.Check(LocalPathToURL("/mnt/repo #1"), Equals, "file:///mnt/repo%20%231")
+}
+
+func (s *LocalSuite) TestCopy(c *C) {
+	c.Assert(s.download(DownloaderOptions{}, "dists/stable/Release", localChecksum), IsNil)
+
+	content, err := ioutil.ReadFile(s.dest)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, localContent)
+
+	source, _ := os.Stat(filepath.Join(s.archive, "dists", "stable", "Release"))
+	target, _ := os.Stat(s.dest)
+	c.Check(os.SameFile(source, target), Equals, false)
+}
+
+func (s *LocalSuite) TestHardlink(c *C) {
+	c.Assert(s.download(DownloaderOptions{LinkLocal: true}, "dists/stable/Release", localChecksum), IsNil)
+
+	source, _ := os.Stat(filepath.Join(s.archive, "dists", "stable", "Release"))
+	target, err := os.Stat(s.dest)
+	c.Assert(err, IsNil)
+	c.Check(os.SameFile(source, target), Equals, true)
+}
+
+func (s *LocalSuite) TestMissingFile(c *C) {
+	c.Check(s.download(DownloaderOptions{}, "dists/stable/InRelease", localChecksum), ErrorMatches, "file .*/InRelease doesn't exist")
+	c.Check(s.download(DownloaderOptions{}, "dists/stable", localChecksum), ErrorMatches, ".*/stable is a directory")
+}
+
+func (s *LocalSuite) TestChecksumMismatch(c *C) {
+	for _, options := range []DownloaderOptions{{}, {LinkLocal: true}} {
+		err := s.download(options, "dists/stable/Release", utils.ChecksumInfo{Size: localChecksum.Size, MD5: "abcdef"})
+		c.Check(err, ErrorMatches, ".*md5 hash mismatch .*")
+
+		_, err = os.Stat(s.dest)
+		c.Check(os.IsNotExist(err), Equals, true)
+		_, err = os.Stat(s.dest + ".down")
+		c.Check(os.IsNotExist(err), Equals, true)
+	}
+
+	// source file isn't touched
+	content, err := ioutil.ReadFile(filepath.Join(s.archive, "dists", "stable", "Release"))
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, localContent)
+}
+
+func (s *LocalSuite) TestDownloadTemp(c *C) {
+	d := NewDownloader(1, s.progress)
+	defer d.Shutdown()
+
+	f, err := DownloadTempWithChecksum(d, LocalPathToURL(filepath.Join(s.archive, "dists", "stable", "Release")), localChecksum, false)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	content, _ := ioutil.ReadAll(f)
+	c.Check(string(content), Equals, localContent)
+}
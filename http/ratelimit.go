@@ -0,0 +1,80 @@
+package http
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is token bucket shared by all download threads
+type rateLimiter struct {
+	sync.Mutex
+	// rate in bytes per second
+	rate int64
+	// bytes which could be read without waiting, negative means debt
+	available float64
+	last      time.Time
+	// sleep is replaced in tests
+	sleep func(time.Duration)
+	now   func() time.Time
+}
+
+// newRateLimiter creates limiter with allowed rate in bytes per second
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate, last: time.Now(), sleep: time.Sleep, now: time.Now}
+}
+
+// chunkSize is maximum number of bytes read at once, so that
+// threads share bandwidth evenly
+func (limiter *rateLimiter) chunkSize() int {
+	chunk := limiter.rate / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+	if chunk > 32*1024 {
+		chunk = 32 * 1024
+	}
+	return int(chunk)
+}
+
+// take accounts for n bytes transferred, sleeping if rate is exceeded
+func (limiter *rateLimiter) take(n int) {
+	limiter.Lock()
+	now := limiter.now()
+	limiter.available += now.Sub(limiter.last).Seconds() * float64(limiter.rate)
+	// allow bursts no longer than one second
+	if limiter.available > float64(limiter.rate) {
+		limiter.available = float64(limiter.rate)
+	}
+	limiter.last = now
+	limiter.available -= float64(n)
+
+	var wait time.Duration
+	if limiter.available < 0 {
+		wait = time.Duration(-limiter.available / float64(limiter.rate) * float64(time.Second))
+	}
+	limiter.Unlock()
+
+	if wait > 0 {
+		limiter.sleep(wait)
+	}
+}
+
+// limitedReader is io.Reader which obeys rate limit
+type limitedReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+// Read reads data in small chunks, waiting for limiter
+func (reader *limitedReader) Read(p []byte) (int, error) {
+	if chunk := reader.limiter.chunkSize(); len(p) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := reader.r.Read(p)
+	if n > 0 {
+		reader.limiter.take(n)
+	}
+	return n, err
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"bytes"
+	"github.com/smira/aptly/console"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type RateLimiterSuite struct {
+	limiter *rateLimiter
+	clock   time.Time
+	slept   time.Duration
+}
+
+var _ = Suite(&RateLimiterSuite{})
+
+func (s *RateLimiterSuite) SetUpTest(c *C) {
+	s.clock = time.Date(2014, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.slept = 0
+
+	s.limiter = newRateLimiter(1000)
+	s.limiter.last = s.clock
+	s.limiter.now = func() time.Time { return s.clock }
+	s.limiter.sleep = func(d time.Duration) {
+		s.slept += d
+		s.clock = s.clock.Add(d)
+	}
+}
+
+func (s *RateLimiterSuite) TestTake(c *C) {
+	s.limiter.take(500)
+	c.Check(s.slept, Equals, 500*time.Millisecond)
+
+	s.limiter.take(1000)
+	c.Check(s.slept, Equals, 1500*time.Millisecond)
+
+	// idle time is credited, but no more than one second
+	s.clock = s.clock.Add(5 * time.Second)
+	s.limiter.take(1000)
+	c.Check(s.slept, Equals, 1500*time.Millisecond)
+	s.limiter.take(250)
+	c.Check(s.slept, Equals, 1750*time.Millisecond)
+}
+
+func (s *RateLimiterSuite) TestChunkSize(c *C) {
+	c.Check(s.limiter.chunkSize(), Equals, 100)
+	c.Check(newRateLimiter(5).chunkSize(), Equals, 1)
+	c.Check(newRateLimiter(10*1024*1024).chunkSize(), Equals, 32*1024)
+}
+
+func (s *RateLimiterSuite) TestLimitedReader(c *C) {
+	content := strings.Repeat("x", 2500)
+
+	data, err := ioutil.ReadAll(&limitedReader{r: strings.NewReader(content), limiter: s.limiter})
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, content)
+	c.Check(s.slept, Equals, 2500*time.Millisecond)
+}
+
+func (s *RateLimiterSuite) TestDownloaderSharedLimit(c *C) {
+	content := bytes.Repeat([]byte("y"), 2000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	progress := console.NewProgress()
+	progress.Start()
+	defer progress.Shutdown()
+
+	d, err := NewDownloaderWithOptions(2, progress, DownloaderOptions{SpeedLimit: 10000})
+	c.Assert(err, IsNil)
+	defer d.Shutdown()
+
+	dir := c.MkDir()
+	ch := make(chan error, 2)
+
+	start := time.Now()
+	d.Download(server.URL+"/a", filepath.Join(dir, "a"), ch)
+	d.Download(server.URL+"/b", filepath.Join(dir, "b"), ch)
+	c.Assert(<-ch, IsNil)
+	c.Assert(<-ch, IsNil)
+
+	// 4000 bytes at 10000 bytes/sec shared by both threads
+	c.Check(time.Since(start) >= 350*time.Millisecond, Equals, true)
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "b"))
+	c.Check(data, DeepEquals, content)
+}
@@ -0,0 +1,233 @@
+package http
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// TransportOptions configures HTTP transport used to download files
+type TransportOptions struct {
+	// Proxy is URL of HTTP proxy, if empty proxy is taken from environment
+	Proxy string
+	// CABundle is path to PEM file with CA certificates, if set only these
+	// CAs are trusted
+	CABundle string
+	// ClientCert & ClientKey are paths to PEM-encoded TLS client certificate and key
+	ClientCert string
+	ClientKey  string
+	// Netrc is path to netrc-style file with credentials
+	Netrc string
+}
+
+// IsEmpty checks whether no option is set
+func (options TransportOptions) IsEmpty() bool {
+	return options == TransportOptions{}
+}
+
+// Merge returns options with unset fields taken from defaults
+func (options TransportOptions) Merge(defaults TransportOptions) TransportOptions {
+	if options.Proxy == "" {
+		options.Proxy = defaults.Proxy
+	}
+	if options.CABundle == "" {
+		options.CABundle = defaults.CABundle
+	}
+	if options.ClientCert == "" && options.ClientKey == "" {
+		options.ClientCert, options.ClientKey = defaults.ClientCert, defaults.ClientKey
+	}
+	if options.Netrc == "" {
+		options.Netrc = defaults.Netrc
+	}
+	return options
+}
+
+// newTransport builds HTTP transport according to options
+func newTransport(options TransportOptions, dial func(network, addr string) (net.Conn, error)) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial:  dial,
+	}
+
+	if options.Proxy != "" {
+		proxyURL, err := url.Parse(options.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse proxy URL: %s", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if options.CABundle != "" || options.ClientCert != "" || options.ClientKey != "" {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	if options.CABundle != "" {
+		pem, err := ioutil.ReadFile(options.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %s", err)
+		}
+
+		transport.TLSClientConfig.RootCAs = x509.NewCertPool()
+		if !transport.TLSClientConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", options.CABundle)
+		}
+	}
+
+	if options.ClientCert != "" || options.ClientKey != "" {
+		if options.ClientCert == "" || options.ClientKey == "" {
+			return nil, fmt.Errorf("both client certificate and key should be specified")
+		}
+
+		cert, err := tls.LoadX509KeyPair(options.ClientCert, options.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %s", err)
+		}
+
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return transport, nil
+}
+
+// netrcEntry is login & password for single machine
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// netrc holds credentials parsed from netrc file
+type netrc struct {
+	machines map[string]netrcEntry
+	fallback *netrcEntry
+}
+
+// loadNetrc reads netrc-style file
+func loadNetrc(filename string) (*netrc, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read netrc file: %s", err)
+	}
+	defer f.Close()
+
+	return parseNetrc(f)
+}
+
+// parseNetrc parses netrc format: machine, default, login & password
+// tokens are understood, macro definitions are skipped
+func parseNetrc(r io.Reader) (*netrc, error) {
+	result := &netrc{machines: make(map[string]netrcEntry)}
+
+	var (
+		tokens  []string
+		current *netrcEntry
+		machine string
+		inMacro bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			// macro definition ends with empty line
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for _, field := range fields {
+			if field == "macdef" {
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, field)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read netrc file: %s", err)
+	}
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if machine == "" {
+			result.fallback = current
+		} else {
+			result.machines[machine] = *current
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "default":
+			flush()
+			current, machine = &netrcEntry{}, ""
+			continue
+		}
+
+		if i+1 >= len(tokens) {
+			return nil, fmt.Errorf("malformed netrc file: missing value for %s", tokens[i])
+		}
+		value := tokens[i+1]
+
+		switch tokens[i] {
+		case "machine":
+			flush()
+			current, machine = &netrcEntry{}, value
+		case "login":
+			if current == nil {
+				return nil, fmt.Errorf("malformed netrc file: login outside of machine")
+			}
+			current.login = value
+		case "password":
+			if current == nil {
+				return nil, fmt.Errorf("malformed netrc file: password outside of machine")
+			}
+			current.password = value
+		}
+		i++
+	}
+	flush()
+
+	return result, nil
+}
+
+// lookup finds credentials for host (possibly with port)
+func (n *netrc) lookup(host string) *netrcEntry {
+	if entry, ok := n.machines[host]; ok {
+		return &entry
+	}
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		if entry, ok := n.machines[hostname]; ok {
+			return &entry
+		}
+	}
+
+	return n.fallback
+}
+
+// SanitizeURL hides password in URL, so that it could be displayed
+func SanitizeURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+
+	return u.String()
+}
@@ -0,0 +1,325 @@
+package s3
+
+import (
+	"fmt"
+	"github.com/minio/minio-go"
+	"github.com/smira/aptly/aptly"
+	"github.com/smira/aptly/utils"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PublishedStorage abstract file system with published files (actually hosted on S3)
+type PublishedStorage struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	stageDir string
+	// pool files already in the bucket: key -> size & ETag, filled by listing
+	// pool of each publishing prefix once
+	poolCache  map[string]minio.ObjectInfo
+	poolListed map[string]bool
+}
+
+// Check interface
+var (
+	_ aptly.PublishedStorage = (*PublishedStorage)(nil)
+)
+
+// NewPublishedStorage creates new instance of PublishedStorage publishing to bucket under prefix
+//
+// endpoint is host[:port] of S3 API (defaults to s3.amazonaws.com), region could be left empty for
+// auto-detection, empty credentials are taken from AWS_ACCESS_KEY_ID & AWS_SECRET_ACCESS_KEY
+func NewPublishedStorage(endpoint, region, accessKeyID, secretAccessKey, bucket, prefix string, useSSL bool) (*PublishedStorage, error) {
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	if accessKeyID == "" {
+		accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if secretAccessKey == "" {
+		secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+
+	client, err := minio.NewWithRegion(endpoint, accessKeyID, secretAccessKey, useSSL, region)
+	if err != nil {
+		return nil, err
+	}
+
+	stageDir, err := ioutil.TempDir("", "aptly-s3")
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublishedStorage{
+		client:     client,
+		bucket:     bucket,
+		prefix:     strings.Trim(prefix, "/"),
+		stageDir:   stageDir,
+		poolCache:  make(map[string]minio.ObjectInfo),
+		poolListed: make(map[string]bool),
+	}, nil
+}
+
+// String returns storage location as URL
+func (storage *PublishedStorage) String() string {
+	return fmt.Sprintf("s3://%s/%s", storage.bucket, storage.prefix)
+}
+
+// PublicPath returns root of public part
+func (storage *PublishedStorage) PublicPath() string {
+	return storage.String()
+}
+
+// Close removes local staging directory
+func (storage *PublishedStorage) Close() error {
+	return os.RemoveAll(storage.stageDir)
+}
+
+// key converts path in published storage to object name in the bucket
+func (storage *PublishedStorage) key(p string) string {
+	key := path.Join(storage.prefix, filepath.ToSlash(p))
+	if key == "." {
+		return ""
+	}
+	return strings.TrimPrefix(key, "/")
+}
+
+// stagePath converts path in published storage to path in local staging directory
+func (storage *PublishedStorage) stagePath(p string) string {
+	return filepath.Join(storage.stageDir, p)
+}
+
+// isStaged checks whether file has been created locally and not uploaded yet
+func (storage *PublishedStorage) isStaged(p string) bool {
+	info, err := os.Stat(storage.stagePath(p))
+	return err == nil && !info.IsDir()
+}
+
+// putFile uploads local file to the bucket
+func (storage *PublishedStorage) putFile(p string, sourceFilename string, md5 string) error {
+	options := minio.PutObjectOptions{}
+	if md5 != "" {
+		// ETag is not MD5 for multipart uploads, so keep it in metadata as well
+		options.UserMetadata = map[string]string{"Md5": md5}
+	}
+
+	_, err := storage.client.FPutObject(storage.bucket, storage.key(p), sourceFilename, options)
+	if err != nil {
+		return fmt.Errorf("error uploading %s to %s: %s", sourceFilename, storage, err)
+	}
+	return nil
+}
+
+// MkDir creates directory recursively under public path
+//
+// S3 has no directories, so only local staging directory is created
+func (storage *PublishedStorage) MkDir(path string) error {
+	return os.MkdirAll(storage.stagePath(path), 0755)
+}
+
+// CreateFile creates file for writing under public path
+//
+// File is created in local staging directory and uploaded when it's renamed or linked
+func (storage *PublishedStorage) CreateFile(path string) (*os.File, error) {
+	return os.Create(storage.stagePath(path))
+}
+
+// RemoveDirs removes directory structure under public path
+func (storage *PublishedStorage) RemoveDirs(path string, progress aptly.Progress) error {
+	filelist, err := storage.Filelist(path)
+	if err != nil {
+		return err
+	}
+
+	if progress != nil {
+		progress.Printf("Removing s3://%s/%s...\n", storage.bucket, storage.key(path))
+	}
+
+	for _, filename := range filelist {
+		key := storage.key(filepath.Join(path, filename))
+		err = storage.client.RemoveObject(storage.bucket, key)
+		if err != nil {
+			return fmt.Errorf("error deleting %s from %s: %s", filename, storage, err)
+		}
+		delete(storage.poolCache, key)
+	}
+
+	return os.RemoveAll(storage.stagePath(path))
+}
+
+// Remove removes single file under public path
+func (storage *PublishedStorage) Remove(path string) error {
+	if storage.isStaged(path) {
+		return os.Remove(storage.stagePath(path))
+	}
+
+	err := storage.client.RemoveObject(storage.bucket, storage.key(path))
+	if err != nil {
+		return fmt.Errorf("error deleting %s from %s: %s", path, storage, err)
+	}
+	delete(storage.poolCache, storage.key(path))
+	return nil
+}
+
+// LinkFromPool uploads package file from pool to dist's pool location
+//
+// prefix is publishing prefix for this repo (e.g. empty or "ppa/")
+// component is component name when publishing (e.g. main)
+// poolDirectory is desired location in pool (like liba/libav/)
+// sourcePool is instance of aptly.PackagePool
+// sourcePath is filepath to package file in package pool
+// sourceChecksums are checksums of the package file, if MD5 is empty, they're calculated
+//
+// File is uploaded only if it's missing in the bucket or its contents differ. Pool of the
+// publishing prefix is listed once, so that files already published are not queried one by one.
+//
+// LinkFromPool returns relative path for the published file to be included in package index
+func (storage *PublishedStorage) LinkFromPool(prefix string, component string, poolDirectory string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo) (string, error) {
+	baseName := filepath.Base(sourcePath)
+	relPath := filepath.Join("pool", component, poolDirectory, baseName)
+	poolPath := filepath.Join(prefix, relPath)
+
+	var err error
+	if sourceChecksums.MD5 == "" {
+		sourceChecksums, err = utils.ChecksumsForFile(sourcePath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !storage.poolListed[prefix] {
+		err = storage.listPool(prefix)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	key := storage.key(poolPath)
+	if info, ok := storage.poolCache[key]; ok && info.Size == sourceChecksums.Size {
+		if info.ETag == sourceChecksums.MD5 {
+			// already exists and matches, skip
+			return relPath, nil
+		}
+
+		if strings.Contains(info.ETag, "-") {
+			// ETag of multipart upload is not MD5, look at metadata instead
+			info, err = storage.client.StatObject(storage.bucket, key, minio.StatObjectOptions{})
+			if err != nil {
+				return "", fmt.Errorf("error getting information about %s from %s: %s", poolPath, storage, err)
+			}
+			if info.Metadata.Get("X-Amz-Meta-Md5") == sourceChecksums.MD5 {
+				return relPath, nil
+			}
+		}
+	}
+
+	err = storage.putFile(poolPath, sourcePath, sourceChecksums.MD5)
+	if err != nil {
+		return "", err
+	}
+
+	storage.poolCache[key] = minio.ObjectInfo{Key: key, Size: sourceChecksums.Size, ETag: sourceChecksums.MD5}
+
+	return relPath, nil
+}
+
+// listPool fills cache of files in the pool under publishing prefix
+func (storage *PublishedStorage) listPool(prefix string) error {
+	keyPrefix := storage.key(filepath.Join(prefix, "pool")) + "/"
+
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	for object := range storage.client.ListObjects(storage.bucket, keyPrefix, true, doneCh) {
+		if object.Err != nil {
+			return fmt.Errorf("error listing pool under prefix %s in %s: %s", prefix, storage, object.Err)
+		}
+
+		// ETags in listing come quoted
+		object.ETag = strings.Trim(object.ETag, "\"")
+		storage.poolCache[object.Key] = object
+	}
+
+	storage.poolListed[prefix] = true
+	return nil
+}
+
+// ChecksumsForFile proxies requests to utils.ChecksumsForFile, for files in local staging directory
+func (storage *PublishedStorage) ChecksumsForFile(path string) (utils.ChecksumInfo, error) {
+	return utils.ChecksumsForFile(storage.stagePath(path))
+}
+
+// Filelist returns list of files under prefix
+func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
+	result := []string{}
+
+	keyPrefix := storage.key(prefix)
+	if keyPrefix != "" {
+		keyPrefix += "/"
+	}
+
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	for object := range storage.client.ListObjects(storage.bucket, keyPrefix, true, doneCh) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("error listing under prefix %s in %s: %s", prefix, storage, object.Err)
+		}
+
+		result = append(result, object.Key[len(keyPrefix):])
+	}
+
+	return result, nil
+}
+
+// RenameFile renames (moves) file
+//
+// Files from local staging directory are uploaded under new name, other
+// files are copied within the bucket
+func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
+	if storage.isStaged(oldName) {
+		err := storage.putFile(newName, storage.stagePath(oldName), "")
+		if err != nil {
+			return err
+		}
+
+		return os.Remove(storage.stagePath(oldName))
+	}
+
+	err := storage.copyObject(oldName, newName)
+	if err != nil {
+		return err
+	}
+
+	return storage.Remove(oldName)
+}
+
+// HardLink creates hardlink newName pointing to oldName, replacing newName if it exists
+//
+// S3 has no links, so contents of oldName is stored under newName
+func (storage *PublishedStorage) HardLink(oldName, newName string) error {
+	if storage.isStaged(oldName) {
+		return storage.putFile(newName, storage.stagePath(oldName), "")
+	}
+
+	return storage.copyObject(oldName, newName)
+}
+
+// copyObject does server-side copy of the object within the bucket
+func (storage *PublishedStorage) copyObject(oldName, newName string) error {
+	destination, err := minio.NewDestinationInfo(storage.bucket, storage.key(newName), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	err = storage.client.CopyObject(destination, minio.NewSourceInfo(storage.bucket, storage.key(oldName), nil))
+	if err != nil {
+		return fmt.Errorf("error copying %s -> %s in %s: %s", oldName, newName, storage, err)
+	}
+	return nil
+}
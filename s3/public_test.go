@@ -0,0 +1,186 @@
+package s3
+
+import (
+	"github.com/smira/aptly/utils"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"os"
+	"path/filepath"
+)
+
+type PublishedStorageSuite struct {
+	server  *fakeServer
+	storage *PublishedStorage
+}
+
+var _ = Suite(&PublishedStorageSuite{})
+
+func (s *PublishedStorageSuite) SetUpTest(c *C) {
+	var err error
+
+	s.server = newFakeServer("repo")
+	s.storage, err = NewPublishedStorage(s.server.Endpoint(), "us-east-1", "aa", "bb", "repo", "/debian/", false)
+	c.Assert(err, IsNil)
+}
+
+func (s *PublishedStorageSuite) TearDownTest(c *C) {
+	s.storage.Close()
+	s.server.Close()
+}
+
+func (s *PublishedStorageSuite) GetFile(c *C, path string) []byte {
+	object, ok := s.server.objects[path]
+	c.Assert(ok, Equals, true, Commentf("object %s not found", path))
+	return object.data
+}
+
+func (s *PublishedStorageSuite) PutFile(c *C, path string, data []byte) {
+	stagePath := filepath.Join(c.MkDir(), "file")
+	c.Assert(ioutil.WriteFile(stagePath, data, 0644), IsNil)
+	c.Assert(s.storage.putFile(path, stagePath, ""), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestPublicPath(c *C) {
+	c.Check(s.storage.PublicPath(), Equals, "s3://repo/debian")
+}
+
+func (s *PublishedStorageSuite) TestCreateFileRename(c *C) {
+	c.Assert(s.storage.MkDir("ppa/dists/squeeze/"), IsNil)
+
+	file, err := s.storage.CreateFile("ppa/dists/squeeze/Release.tmp")
+	c.Assert(err, IsNil)
+	file.WriteString("Origin: ppa\n")
+	file.Close()
+
+	checksums, err := s.storage.ChecksumsForFile("ppa/dists/squeeze/Release.tmp")
+	c.Assert(err, IsNil)
+	c.Check(checksums.Size, Equals, int64(12))
+
+	c.Check(s.server.objects, HasLen, 0)
+
+	c.Assert(s.storage.HardLink("ppa/dists/squeeze/Release.tmp", "ppa/dists/squeeze/by-hash/SHA256/"+checksums.SHA256), IsNil)
+	c.Assert(s.storage.RenameFile("ppa/dists/squeeze/Release.tmp", "ppa/dists/squeeze/Release"), IsNil)
+
+	c.Check(s.GetFile(c, "debian/ppa/dists/squeeze/Release"), DeepEquals, []byte("Origin: ppa\n"))
+	c.Check(s.GetFile(c, "debian/ppa/dists/squeeze/by-hash/SHA256/"+checksums.SHA256), DeepEquals, []byte("Origin: ppa\n"))
+	c.Check(s.storage.isStaged("ppa/dists/squeeze/Release.tmp"), Equals, false)
+}
+
+func (s *PublishedStorageSuite) TestRenameCopy(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	c.Assert(s.storage.HardLink("a/b", "a/c"), IsNil)
+	c.Check(s.GetFile(c, "debian/a/c"), DeepEquals, []byte("test"))
+
+	c.Assert(s.storage.RenameFile("a/c", "a/d"), IsNil)
+	c.Check(s.GetFile(c, "debian/a/d"), DeepEquals, []byte("test"))
+
+	list, err := s.storage.Filelist("a")
+	c.Assert(err, IsNil)
+	c.Check(list, DeepEquals, []string{"b", "d"})
+}
+
+func (s *PublishedStorageSuite) TestFilelist(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.PutFile(c, path, []byte("test"))
+	}
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "test/a", "test/b", "testa"})
+
+	list, err = s.storage.Filelist("test")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b"})
+
+	list, err = s.storage.Filelist("test2")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{})
+}
+
+func (s *PublishedStorageSuite) TestRemove(c *C) {
+	s.PutFile(c, "a/b", []byte("test"))
+
+	c.Assert(s.storage.Remove("a/b"), IsNil)
+	c.Check(s.server.objects, HasLen, 0)
+
+	c.Assert(s.storage.MkDir("c"), IsNil)
+	file, err := s.storage.CreateFile("c/d")
+	c.Assert(err, IsNil)
+	file.Close()
+
+	c.Assert(s.storage.Remove("c/d"), IsNil)
+	c.Check(s.storage.isStaged("c/d"), Equals, false)
+}
+
+func (s *PublishedStorageSuite) TestRemoveDirs(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.PutFile(c, path, []byte("test"))
+	}
+
+	c.Assert(s.storage.RemoveDirs("test", nil), IsNil)
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "testa"})
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPool(c *C) {
+	root := c.MkDir()
+
+	sourcePath := filepath.Join(root, "pool/c7/6b/mars-invaders_1.03.deb")
+	c.Assert(os.MkdirAll(filepath.Dir(sourcePath), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(sourcePath, []byte("Contents"), 0644), IsNil)
+
+	checksums, err := utils.ChecksumsForFile(sourcePath)
+	c.Assert(err, IsNil)
+
+	relPath, err := s.storage.LinkFromPool("ppa", "main", "m/mars-invaders", nil, sourcePath, checksums)
+	c.Assert(err, IsNil)
+	c.Check(relPath, Equals, "pool/main/m/mars-invaders/mars-invaders_1.03.deb")
+	c.Check(s.GetFile(c, "debian/ppa/pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+	c.Check(s.server.puts, Equals, 1)
+	c.Check(s.server.lists, Equals, 1)
+
+	// second time, file is not uploaded again, pool is not listed again
+	_, err = s.storage.LinkFromPool("ppa", "main", "m/mars-invaders", nil, sourcePath, checksums)
+	c.Assert(err, IsNil)
+	c.Check(s.server.puts, Equals, 1)
+	c.Check(s.server.lists, Equals, 1)
+
+	// new storage finds file by listing the pool, without querying each file
+	storage, err := NewPublishedStorage(s.server.Endpoint(), "us-east-1", "aa", "bb", "repo", "/debian/", false)
+	c.Assert(err, IsNil)
+	defer storage.Close()
+
+	_, err = storage.LinkFromPool("ppa", "main", "m/mars-invaders", nil, sourcePath, checksums)
+	c.Assert(err, IsNil)
+	c.Check(s.server.puts, Equals, 1)
+	c.Check(s.server.lists, Equals, 2)
+	c.Check(s.server.heads, Equals, 0)
+
+	// file has changed, it's uploaded, checksums are calculated if missing
+	c.Assert(ioutil.WriteFile(sourcePath, []byte("Spam"), 0644), IsNil)
+	_, err = storage.LinkFromPool("ppa", "main", "m/mars-invaders", nil, sourcePath, utils.ChecksumInfo{})
+	c.Assert(err, IsNil)
+	c.Check(s.server.puts, Equals, 2)
+	c.Check(s.GetFile(c, "debian/ppa/pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Spam"))
+
+	// multipart uploads have ETag which is not MD5, MD5 is looked up in metadata
+	checksums, err = utils.ChecksumsForFile(sourcePath)
+	c.Assert(err, IsNil)
+
+	object := s.server.objects["debian/ppa/pool/main/m/mars-invaders/mars-invaders_1.03.deb"]
+	object.etag = "d41d8cd98f00b204e9800998ecf8427e-2"
+
+	storage, err = NewPublishedStorage(s.server.Endpoint(), "us-east-1", "aa", "bb", "repo", "/debian/", false)
+	c.Assert(err, IsNil)
+	defer storage.Close()
+
+	_, err = storage.LinkFromPool("ppa", "main", "m/mars-invaders", nil, sourcePath, checksums)
+	c.Assert(err, IsNil)
+	c.Check(s.server.puts, Equals, 2)
+	c.Check(s.server.heads, Equals, 1)
+}
@@ -0,0 +1,17 @@
+// Package s3 handles publishing to Amazon S3 and S3-compatible object storages
+package s3
+
+// Published repositories are stored in the bucket under prefix with the same
+// layout as local published storage (see package files):
+// <bucket>/<prefix>
+// \- dists
+//    \- squeeze
+//       \- Release
+//       \- main
+//          \- binary-i386
+//             \- Packages.bz2
+// \- pool
+//    contains copies of package files uploaded from main pool
+//
+// Index files are generated in local staging directory first and uploaded
+// when they're renamed into their final place.
@@ -0,0 +1,200 @@
+package s3
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeObject is an object stored in fakeServer
+type fakeObject struct {
+	data     []byte
+	etag     string
+	metadata http.Header
+}
+
+// fakeServer is minimal in-memory S3 API implementation, enough to test PublishedStorage
+type fakeServer struct {
+	sync.Mutex
+	*httptest.Server
+
+	bucket  string
+	objects map[string]*fakeObject
+	puts    int
+	heads   int
+	lists   int
+}
+
+func newFakeServer(bucket string) *fakeServer {
+	server := &fakeServer{bucket: bucket, objects: make(map[string]*fakeObject)}
+	server.Server = httptest.NewServer(server)
+	return server
+}
+
+// Endpoint returns host:port of the server
+func (server *fakeServer) Endpoint() string {
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func (server *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.Lock()
+	defer server.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != server.bucket {
+		server.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	key := ""
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+
+	switch {
+	case r.Method == "GET" && key == "":
+		server.lists++
+		server.list(w, r)
+	case r.Method == "HEAD":
+		server.heads++
+		object, ok := server.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range object.metadata {
+			w.Header()[k] = v
+		}
+		w.Header().Set("ETag", "\""+object.etag+"\"")
+		w.Header().Set("Last-Modified", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+	case r.Method == "GET":
+		object, ok := server.objects[key]
+		if !ok {
+			server.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(object.data)
+	case r.Method == "PUT" && r.Header.Get("X-Amz-Copy-Source") != "":
+		source := strings.TrimPrefix(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"), server.bucket+"/")
+		object, ok := server.objects[source]
+		if !ok {
+			server.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		server.objects[key] = object
+		fmt.Fprintf(w, "<CopyObjectResult><ETag>\"%s\"</ETag><LastModified>%s</LastModified></CopyObjectResult>",
+			object.etag, time.Unix(0, 0).UTC().Format(time.RFC3339))
+	case r.Method == "PUT":
+		var (
+			data []byte
+			err  error
+		)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data, err = decodeChunked(r.Body)
+		} else {
+			data, err = ioutil.ReadAll(r.Body)
+		}
+		if err != nil {
+			server.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+
+		object := &fakeObject{data: data, etag: fmt.Sprintf("%x", md5.Sum(data)), metadata: http.Header{}}
+		for k, v := range r.Header {
+			if strings.HasPrefix(k, "X-Amz-Meta-") {
+				object.metadata[k] = v
+			}
+		}
+		server.objects[key] = object
+		server.puts++
+
+		w.Header().Set("ETag", "\""+object.etag+"\"")
+	case r.Method == "DELETE":
+		delete(server.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		server.error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (server *fakeServer) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (server *fakeServer) list(w http.ResponseWriter, r *http.Request) {
+	type content struct {
+		Key          string
+		Size         int
+		ETag         string
+		LastModified string
+	}
+
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		IsTruncated bool
+		Contents    []content
+	}{Name: server.bucket, Prefix: r.URL.Query().Get("prefix")}
+
+	keys := []string{}
+	for key := range server.objects {
+		if strings.HasPrefix(key, result.Prefix) && key > r.URL.Query().Get("marker") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		object := server.objects[key]
+		result.Contents = append(result.Contents, content{Key: key, Size: len(object.data), ETag: "\"" + object.etag + "\"",
+			LastModified: time.Unix(0, 0).UTC().Format(time.RFC3339)})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// decodeChunked decodes aws-chunked encoded body of streaming signature V4 upload
+func decodeChunked(body io.Reader) ([]byte, error) {
+	reader := bufio.NewReader(body)
+	result := []byte{}
+
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(header), ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		chunk := make([]byte, size+2)
+		_, err = io.ReadFull(reader, chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		if size == 0 {
+			return result, nil
+		}
+
+		result = append(result, chunk[:size]...)
+	}
+}
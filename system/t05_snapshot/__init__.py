@@ -9,4 +9,5 @@ from .verify import *
 from .pull import *
 from .diff import *
 from .merge import *
+from .filter import *
 from .drop import *
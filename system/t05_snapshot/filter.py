@@ -0,0 +1,81 @@
+from lib import BaseTest
+import re
+
+
+def remove_created_at(s):
+    return re.sub(r"Created At: [0-9:A-Za-z -]+\n", "", s)
+
+
+class FilterSnapshot1Test(BaseTest):
+    """
+    filter snapshot: simple query
+    """
+    fixtureCmds = [
+        "aptly repo create local-repo",
+        "aptly repo add local-repo ${files}",
+        "aptly snapshot create snap1 from repo local-repo",
+    ]
+    runCmd = "aptly snapshot filter snap1 snap2 libboost-program-options-dev"
+
+    def check(self):
+        self.check_output()
+        self.check_cmd_output("aptly snapshot show -with-packages snap2", "snapshot_show", match_prepare=remove_created_at)
+
+
+class FilterSnapshot2Test(BaseTest):
+    """
+    filter snapshot: with dependencies
+    """
+    fixtureCmds = [
+        "aptly repo create local-repo",
+        "aptly repo add local-repo ${files} ${testfiles}",
+        "aptly snapshot create snap1 from repo local-repo",
+    ]
+    runCmd = "aptly snapshot filter -with-deps snap1 snap2 libboost-program-options-dev"
+
+    def check(self):
+        self.check_output()
+        self.check_cmd_output("aptly snapshot show -with-packages snap2", "snapshot_show", match_prepare=remove_created_at)
+
+
+class FilterSnapshot3Test(BaseTest):
+    """
+    filter snapshot: invalid query
+    """
+    fixtureCmds = [
+        "aptly repo create local-repo",
+        "aptly repo add local-repo ${files}",
+        "aptly snapshot create snap1 from repo local-repo",
+    ]
+    runCmd = "aptly snapshot filter snap1 snap2 'Name (~ libboost'"
+    expectedCode = 1
+
+    def check(self):
+        self.check_output()
+        self.check_cmd_output("aptly snapshot show snap2", "snapshot_show", expected_code=1)
+
+
+class FilterSnapshot4Test(BaseTest):
+    """
+    filter snapshot: no such source snapshot
+    """
+    runCmd = "aptly snapshot filter snap1 snap2 libboost-program-options-dev"
+    expectedCode = 1
+
+
+class FilterSnapshot5Test(BaseTest):
+    """
+    filter snapshot: source snapshot is recorded
+    """
+    fixtureCmds = [
+        "aptly repo create local-repo",
+        "aptly repo add local-repo ${files}",
+        "aptly snapshot create snap1 from repo local-repo",
+        "aptly snapshot filter snap1 snap2 pyspi 'Name (~ ^libboost)'",
+    ]
+    runCmd = "aptly snapshot drop snap1"
+    expectedCode = 1
+
+    def check(self):
+        self.check_output()
+        self.check_cmd_output("aptly snapshot show snap2", "snapshot_show", match_prepare=remove_created_at)
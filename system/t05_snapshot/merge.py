@@ -1,6 +1,27 @@
 from lib import BaseTest
+import os
 import re
 
+mergeFiles = os.path.join(os.path.dirname(os.path.abspath(__file__)), "MergeSnapshotFiles")
+
+# snap1 has libboost-program-options-dev 1.49.0.1, snap2 has 1.49.0.2
+localSnapshots = [
+    "aptly repo create repo1",
+    "aptly repo add repo1 ${files}",
+    "aptly snapshot create snap1 from repo repo1",
+    "aptly repo create repo2",
+    "aptly repo add repo2 " + mergeFiles,
+    "aptly snapshot create snap2 from repo repo2",
+]
+
+
+def remove_created_at(s):
+    return re.sub(r"Created At: [0-9:A-Za-z -]+\n", "", s)
+
+
+def remove_testfiles(s):
+    return remove_created_at(s).replace(os.path.dirname(os.path.abspath(__file__)), "")
+
 
 class MergeSnapshot1Test(BaseTest):
     """
@@ -78,3 +99,95 @@ class MergeSnapshot5Test(BaseTest):
     ]
     runCmd = "aptly snapshot merge snap1 snap1"
     expectedCode = 1
+
+
+class MergeSnapshot6Test(BaseTest):
+    """
+    merge snapshots: -latest and -no-remove are exclusive
+    """
+    runCmd = "aptly snapshot merge -latest -no-remove snap3 snap1 snap2"
+    expectedCode = 1
+
+
+class MergeSnapshot7Test(BaseTest):
+    """
+    merge snapshots: no such snapshot, local repos
+    """
+    fixtureCmds = localSnapshots
+    runCmd = "aptly snapshot merge snap3 snap1 snap4"
+    expectedCode = 1
+
+
+class MergeSnapshot8Test(BaseTest):
+    """
+    merge snapshots: latest versions
+    """
+    fixtureCmds = localSnapshots
+    runCmd = "aptly snapshot merge -latest snap3 snap2 snap1"
+
+    def check(self):
+        self.check_output()
+        self.check_cmd_output("aptly snapshot show -with-packages snap3", "snapshot_show", match_prepare=remove_created_at)
+
+
+class MergeSnapshot9Test(BaseTest):
+    """
+    merge snapshots: keep all versions
+    """
+    fixtureCmds = localSnapshots
+    runCmd = "aptly snapshot merge -no-remove snap3 snap1 snap2"
+
+    def check(self):
+        self.check_output()
+        self.check_cmd_output("aptly snapshot show -with-packages snap3", "snapshot_show", match_prepare=remove_created_at)
+
+
+class MergeSnapshot10Test(BaseTest):
+    """
+    merge snapshots: precedence file overrides latest version
+    """
+    fixtureCmds = localSnapshots
+    runCmd = "aptly snapshot merge -latest -precedence=${testfiles}/precedence snap3 snap1 snap2"
+
+    def check(self):
+        self.check_output()
+        self.check_cmd_output("aptly snapshot show -with-packages snap3", "snapshot_show", match_prepare=remove_testfiles)
+
+
+class MergeSnapshot11Test(BaseTest):
+    """
+    merge snapshots: malformed precedence file
+    """
+    fixtureCmds = localSnapshots
+    runCmd = "aptly snapshot merge -precedence=${testfiles}/precedence snap3 snap1 snap2"
+    outputMatchPrepare = lambda self, s: remove_testfiles(s)
+    expectedCode = 1
+
+
+class MergeSnapshot12Test(BaseTest):
+    """
+    merge snapshots: duplicate package in precedence file
+    """
+    fixtureCmds = localSnapshots
+    runCmd = "aptly snapshot merge -precedence=${testfiles}/precedence snap3 snap1 snap2"
+    outputMatchPrepare = lambda self, s: remove_testfiles(s)
+    expectedCode = 1
+
+
+class MergeSnapshot13Test(BaseTest):
+    """
+    merge snapshots: precedence file refers to snapshot which is not merged
+    """
+    fixtureCmds = localSnapshots
+    runCmd = "aptly snapshot merge -precedence=${testfiles}/precedence snap3 snap1"
+    expectedCode = 1
+
+
+class MergeSnapshot14Test(BaseTest):
+    """
+    merge snapshots: no precedence file
+    """
+    fixtureCmds = localSnapshots
+    runCmd = "aptly snapshot merge -precedence=${testfiles}/precedence snap3 snap1 snap2"
+    outputMatchPrepare = lambda self, s: remove_testfiles(s)
+    expectedCode = 1
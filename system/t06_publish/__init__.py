@@ -5,3 +5,4 @@ Testing publishing snapshots
 from .snapshot import *
 from .list import *
 from .drop import *
+from .switch import *
@@ -1,4 +1,5 @@
 import os
+import gzip
 import hashlib
 import inspect
 from lib import BaseTest
@@ -73,7 +74,8 @@ class PublishSnapshot1Test(BaseTest):
                 raise Exception("file hash doesn't match for %s: %s != %s" % (path, fileHash, h.hexdigest()))
 
         if pathsSeen != set(['main/binary-amd64/Packages', 'main/binary-i386/Packages', 'main/binary-i386/Packages.gz',
-                             'main/binary-amd64/Packages.gz', 'main/binary-amd64/Packages.bz2', 'main/binary-i386/Packages.bz2']):
+                             'main/binary-amd64/Packages.gz', 'main/binary-amd64/Packages.bz2', 'main/binary-i386/Packages.bz2',
+                             'main/Contents-amd64.gz', 'main/Contents-i386.gz']):
             raise Exception("path seen wrong: %r" % (pathsSeen, ))
 
 
@@ -483,3 +485,29 @@ class PublishSnapshot19Test(BaseTest):
     ]
     runCmd = "aptly publish snapshot -skip-signing snap5"
     gold_processor = BaseTest.expand_environ
+
+
+class PublishSnapshot20Test(BaseTest):
+    """
+    publish snapshot: Contents index
+    """
+    fixtureCmds = [
+        "aptly repo create local-repo",
+        "aptly repo add local-repo ${files}",
+        "aptly snapshot create snap20 from repo local-repo",
+    ]
+    runCmd = "aptly publish snapshot -skip-signing -distribution=maverick snap20"
+    gold_processor = BaseTest.expand_environ
+
+    def check(self):
+        super(PublishSnapshot20Test, self).check()
+
+        self.check_exists('public/dists/maverick/main/Contents-i386.gz')
+        self.check_not_exists('public/dists/maverick/main/Contents-source.gz')
+
+        with gzip.open(os.path.join(os.environ["HOME"], ".aptly", 'public/dists/maverick/main/Contents-i386.gz')) as f:
+            self.verify_match(self.get_gold('contents'), f.read())
+
+        release = self.read_file('public/dists/maverick/Release').split("\n")
+        if len([l for l in release if l.startswith(" ") and l.endswith(" main/Contents-i386.gz")]) != 3:
+            raise Exception("Contents-i386.gz is not listed in Release: %r" % (release, ))
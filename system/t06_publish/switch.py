@@ -0,0 +1,124 @@
+import os
+import hashlib
+import inspect
+from lib import BaseTest
+
+
+def strip_processor(output):
+    return "\n".join([l for l in output.split("\n") if not l.startswith(' ') and not l.startswith('Date:')])
+
+
+class PublishSwitch1Test(BaseTest):
+    """
+    publish switch: indexes replaced atomically, unreferenced files removed from pool
+    """
+    fixtureCmds = [
+        "aptly repo create local-repo",
+        "aptly repo add local-repo ${files}",
+        "aptly snapshot create snap1 from repo local-repo",
+        "aptly publish snapshot -keyring=${files}/aptly.pub -secret-keyring=${files}/aptly.sec -distribution=maverick snap1",
+        "aptly repo remove local-repo pyspi_0.6.1-1.3_source",
+        "aptly snapshot create snap2 from repo local-repo",
+    ]
+    runCmd = "aptly publish switch -keyring=${files}/aptly.pub -secret-keyring=${files}/aptly.sec maverick snap2"
+    gold_processor = BaseTest.expand_environ
+
+    def check(self):
+        super(PublishSwitch1Test, self).check()
+
+        # no temporary files are left behind
+        for root, dirs, files in os.walk(os.path.join(os.environ["HOME"], ".aptly", "public")):
+            for name in files:
+                if name.endswith(".tmp"):
+                    raise Exception("temporary file left: %s" % (os.path.join(root, name), ))
+
+        self.check_exists('public/dists/maverick/InRelease')
+        self.check_exists('public/dists/maverick/Release')
+        self.check_exists('public/dists/maverick/Release.gpg')
+
+        # file referenced only by removed package is gone, files shared with remaining version are kept
+        self.check_not_exists('public/pool/main/p/pyspi/pyspi_0.6.1-1.3.dsc')
+        self.check_exists('public/pool/main/p/pyspi/pyspi-0.6.1-1.3.stripped.dsc')
+        self.check_exists('public/pool/main/p/pyspi/pyspi_0.6.1-1.3.diff.gz')
+        self.check_exists('public/pool/main/p/pyspi/pyspi_0.6.1.orig.tar.gz')
+        self.check_exists('public/pool/main/b/boost-defaults/libboost-program-options-dev_1.49.0.1_i386.deb')
+
+        self.check_file_contents('public/dists/maverick/Release', 'release', match_prepare=strip_processor)
+        self.check_file_contents('public/dists/maverick/main/source/Sources', 'sources', match_prepare=lambda s: "\n".join(sorted(s.split("\n"))))
+
+        # verify signatures
+        self.run_cmd(["gpg", "--keyring", os.path.join(os.path.dirname(inspect.getsourcefile(BaseTest)), "files", "aptly.pub"),
+                      "--verify", os.path.join(os.environ["HOME"], ".aptly", 'public/dists/maverick/InRelease')])
+        self.run_cmd(["gpg",  "--keyring", os.path.join(os.path.dirname(inspect.getsourcefile(BaseTest)), "files", "aptly.pub"),
+                      "--verify", os.path.join(os.environ["HOME"], ".aptly", 'public/dists/maverick/Release.gpg'),
+                      os.path.join(os.environ["HOME"], ".aptly", 'public/dists/maverick/Release')])
+
+        # Release matches indexes which were put in place
+        release = self.read_file('public/dists/maverick/Release').split("\n")
+        release = [l for l in release if l.startswith(" ")]
+        for l in release:
+            fileHash, fileSize, path = l.split()
+
+            st = os.stat(os.path.join(os.environ["HOME"], ".aptly", 'public/dists/maverick/', path))
+            if int(fileSize) != st.st_size:
+                raise Exception("file size doesn't match for %s: %s != %d" % (path, fileSize, st.st_size))
+
+            if len(fileHash) == 32:
+                h = hashlib.md5()
+            elif len(fileHash) == 40:
+                h = hashlib.sha1()
+            else:
+                h = hashlib.sha256()
+
+            h.update(self.read_file(os.path.join('public/dists/maverick', path)))
+
+            if h.hexdigest() != fileHash:
+                raise Exception("file hash doesn't match for %s: %s != %s" % (path, fileHash, h.hexdigest()))
+
+
+class PublishSwitch2Test(BaseTest):
+    """
+    publish switch: no such snapshot, published repository is left intact
+    """
+    fixtureCmds = [
+        "aptly repo create local-repo",
+        "aptly repo add local-repo ${files}",
+        "aptly snapshot create snap1 from repo local-repo",
+        "aptly publish snapshot -skip-signing -distribution=maverick snap1",
+    ]
+    runCmd = "aptly publish switch -skip-signing maverick snap2"
+    expectedCode = 1
+
+    def check(self):
+        super(PublishSwitch2Test, self).check()
+
+        self.check_exists('public/dists/maverick/Release')
+        self.check_exists('public/pool/main/p/pyspi/pyspi_0.6.1-1.3.dsc')
+        self.check_cmd_output("aptly publish list", "publish_list")
+
+
+class PublishSwitch3Test(BaseTest):
+    """
+    publish switch: not published
+    """
+    fixtureCmds = [
+        "aptly repo create local-repo",
+        "aptly repo add local-repo ${files}",
+        "aptly snapshot create snap1 from repo local-repo",
+    ]
+    runCmd = "aptly publish switch -skip-signing maverick snap1"
+    expectedCode = 1
+
+
+class PublishSwitch4Test(BaseTest):
+    """
+    publish switch: published local repo can't be switched
+    """
+    fixtureCmds = [
+        "aptly repo create local-repo",
+        "aptly repo add local-repo ${files}",
+        "aptly snapshot create snap1 from repo local-repo",
+        "aptly publish repo -skip-signing -distribution=maverick local-repo",
+    ]
+    runCmd = "aptly publish switch -skip-signing maverick snap1"
+    expectedCode = 1
@@ -0,0 +1,6 @@
+"""
+Testing package search and show
+"""
+
+from .search import *
+from .show import *
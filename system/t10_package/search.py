@@ -0,0 +1,55 @@
+from lib import BaseTest
+
+
+class SearchPackage1Test(BaseTest):
+    """
+    search packages: by name
+    """
+    fixtureCmds = [
+        "aptly repo create repo1",
+        "aptly repo add repo1 ${files}",
+    ]
+    runCmd = "aptly package search pyspi"
+
+
+class SearchPackage2Test(BaseTest):
+    """
+    search packages: field query
+    """
+    fixtureCmds = [
+        "aptly repo create repo1",
+        "aptly repo add repo1 ${files}",
+    ]
+    runCmd = "aptly package search '$$Architecture (i386) | Version (>= 0.6.1-1.4)'"
+
+
+class SearchPackage3Test(BaseTest):
+    """
+    search packages: packages dropped from all repos are still found
+    """
+    fixtureCmds = [
+        "aptly repo create repo1",
+        "aptly repo add repo1 ${files}",
+        "aptly repo drop repo1",
+    ]
+    runCmd = "aptly package search libboost-program-options-dev"
+
+
+class SearchPackage4Test(BaseTest):
+    """
+    search packages: no results
+    """
+    fixtureCmds = [
+        "aptly repo create repo1",
+        "aptly repo add repo1 ${files}",
+    ]
+    runCmd = "aptly package search nginx"
+    expectedCode = 1
+
+
+class SearchPackage5Test(BaseTest):
+    """
+    search packages: invalid query
+    """
+    runCmd = "aptly package search 'Name (~ pyspi'"
+    expectedCode = 1
@@ -0,0 +1,50 @@
+from lib import BaseTest
+
+
+class ShowPackage1Test(BaseTest):
+    """
+    show package: files in the pool and references
+    """
+    fixtureCmds = [
+        "aptly repo create -comment=Repo1 repo1",
+        "aptly repo add repo1 ${files}",
+        "aptly snapshot create snap1 from repo repo1",
+        "aptly publish snapshot -skip-signing -distribution=maverick snap1",
+    ]
+    runCmd = "aptly package show libboost-program-options-dev"
+    gold_processor = BaseTest.expand_environ
+
+
+class ShowPackage2Test(BaseTest):
+    """
+    show package: source package, several versions, referenced by snapshot only
+    """
+    fixtureCmds = [
+        "aptly repo create -comment=Repo1 repo1",
+        "aptly repo add repo1 ${files}",
+        "aptly snapshot create snap1 from repo repo1",
+        "aptly repo remove repo1 pyspi",
+    ]
+    runCmd = "aptly package show '$$Source (pyspi)'"
+    gold_processor = BaseTest.expand_environ
+
+
+class ShowPackage3Test(BaseTest):
+    """
+    show package: not referenced anywhere
+    """
+    fixtureCmds = [
+        "aptly repo create repo1",
+        "aptly repo add repo1 ${files}",
+        "aptly repo drop repo1",
+    ]
+    runCmd = "aptly package show libboost-program-options-dev"
+    gold_processor = BaseTest.expand_environ
+
+
+class ShowPackage4Test(BaseTest):
+    """
+    show package: no results
+    """
+    runCmd = "aptly package show nginx"
+    expectedCode = 1
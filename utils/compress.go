@@ -2,32 +2,107 @@ package utils
 
 import (
 	"compress/gzip"
+	"fmt"
+	"github.com/dsnet/compress/bzip2"
+	"github.com/ulikunitz/xz"
 	"io"
 	"os"
-	"os/exec"
 )
 
-// CompressFile compresses file specified by source to .gz & .bz2
+// Compression formats supported for published indexes
+const (
+	CompressionNone  = "none"
+	CompressionGzip  = "gz"
+	CompressionBzip2 = "bz2"
+	CompressionXz    = "xz"
+)
+
+// CompressionFormats is list of all supported compression formats in preferred order
+var CompressionFormats = []string{CompressionNone, CompressionGzip, CompressionBzip2, CompressionXz}
+
+// CompressionExtension returns file extension (with leading dot) for compression format
+func CompressionExtension(format string) string {
+	if format == CompressionNone {
+		return ""
+	}
+	return "." + format
+}
+
+// ValidateCompressionFormats checks that list of compression formats is non-empty and
+// contains only supported formats
+func ValidateCompressionFormats(formats []string) error {
+	if len(formats) == 0 {
+		return fmt.Errorf("list of compression formats is empty")
+	}
+
+	for _, format := range formats {
+		if !StrSliceHasItem(CompressionFormats, format) {
+			return fmt.Errorf("unknown compression format: %s", format)
+		}
+	}
+
+	return nil
+}
+
+// NewCompressWriter creates writer which compresses data into w using format
+func NewCompressWriter(format string, w io.Writer) (io.WriteCloser, error) {
+	switch format {
+	case CompressionGzip:
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	case CompressionBzip2:
+		return bzip2.NewWriter(w, &bzip2.WriterConfig{Level: bzip2.BestCompression})
+	case CompressionXz:
+		return xz.NewWriter(w)
+	}
+
+	return nil, fmt.Errorf("unsupported compression format: %s", format)
+}
+
+// CompressFile compresses file specified by source into every format listed,
+// compressed files are named after source with format extension appended
 //
-// It uses internal gzip and external bzip2, see:
-// https://code.google.com/p/go/issues/detail?id=4828
-func CompressFile(source *os.File) error {
-	gzPath := source.Name() + ".gz"
-	gzFile, err := os.Create(gzPath)
+// Format "none" is skipped, as source is already uncompressed.
+func CompressFile(source *os.File, formats []string) error {
+	for _, format := range formats {
+		if format == CompressionNone {
+			continue
+		}
+
+		err := compressFileTo(source, format)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func compressFileTo(source *os.File, format string) error {
+	file, err := os.Create(source.Name() + CompressionExtension(format))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer, err := NewCompressWriter(format, file)
+	if err != nil {
+		return err
+	}
+
+	_, err = source.Seek(0, 0)
 	if err != nil {
 		return err
 	}
-	defer gzFile.Close()
 
-	gzWriter := gzip.NewWriter(gzFile)
-	defer gzWriter.Close()
+	_, err = io.Copy(writer, source)
+	if err != nil {
+		return err
+	}
 
-	source.Seek(0, 0)
-	_, err = io.Copy(gzWriter, source)
+	err = writer.Close()
 	if err != nil {
 		return err
 	}
 
-	cmd := exec.Command("bzip2", "-k", "-f", source.Name())
-	return cmd.Run()
+	return file.Close()
 }
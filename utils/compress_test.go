@@ -3,6 +3,8 @@ package utils
 import (
 	"compress/bzip2"
 	"compress/gzip"
+	"github.com/ulikunitz/xz"
+	"io"
 	"io/ioutil"
 	. "launchpad.net/gocheck"
 	"os"
@@ -25,35 +27,49 @@ func (s *CompressSuite) TearDownTest(c *C) {
 	s.tempfile.Close()
 }
 
-func (s *CompressSuite) TestCompress(c *C) {
-	err := CompressFile(s.tempfile)
+func (s *CompressSuite) readCompressed(c *C, ext string, decompress func(r io.Reader) (io.Reader, error)) string {
+	file, err := os.Open(s.tempfile.Name() + ext)
 	c.Assert(err, IsNil)
+	defer file.Close()
 
-	buf := make([]byte, len(testString))
-
-	file, err := os.Open(s.tempfile.Name() + ".gz")
+	reader, err := decompress(file)
 	c.Assert(err, IsNil)
 
-	gzReader, err := gzip.NewReader(file)
+	buf, err := ioutil.ReadAll(reader)
 	c.Assert(err, IsNil)
 
-	_, err = gzReader.Read(buf)
-	c.Assert(err, IsNil)
+	return string(buf)
+}
 
-	gzReader.Close()
-	file.Close()
+func (s *CompressSuite) TestCompress(c *C) {
+	err := CompressFile(s.tempfile, []string{"none", "gz", "bz2", "xz"})
+	c.Assert(err, IsNil)
 
-	c.Check(string(buf), Equals, testString)
+	c.Check(s.readCompressed(c, ".gz", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }), Equals, testString)
+	c.Check(s.readCompressed(c, ".bz2", func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil }), Equals, testString)
+	c.Check(s.readCompressed(c, ".xz", func(r io.Reader) (io.Reader, error) { return xz.NewReader(r) }), Equals, testString)
+}
 
-	file, err = os.Open(s.tempfile.Name() + ".bz2")
+func (s *CompressSuite) TestCompressOnlySome(c *C) {
+	err := CompressFile(s.tempfile, []string{"gz"})
 	c.Assert(err, IsNil)
 
-	bzReader := bzip2.NewReader(file)
+	c.Check(s.readCompressed(c, ".gz", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }), Equals, testString)
 
-	_, err = bzReader.Read(buf)
-	c.Assert(err, IsNil)
+	_, err = os.Stat(s.tempfile.Name() + ".bz2")
+	c.Check(os.IsNotExist(err), Equals, true)
+	_, err = os.Stat(s.tempfile.Name() + ".xz")
+	c.Check(os.IsNotExist(err), Equals, true)
+}
 
-	file.Close()
+func (s *CompressSuite) TestCompressionExtension(c *C) {
+	c.Check(CompressionExtension("none"), Equals, "")
+	c.Check(CompressionExtension("gz"), Equals, ".gz")
+	c.Check(CompressionExtension("xz"), Equals, ".xz")
+}
 
-	c.Check(string(buf), Equals, testString)
+func (s *CompressSuite) TestValidateCompressionFormats(c *C) {
+	c.Check(ValidateCompressionFormats([]string{"none", "gz", "bz2", "xz"}), IsNil)
+	c.Check(ValidateCompressionFormats([]string{}), ErrorMatches, "list of compression formats is empty")
+	c.Check(ValidateCompressionFormats([]string{"gz", "lzma"}), ErrorMatches, "unknown compression format: lzma")
 }
@@ -8,24 +8,61 @@ import (
 
 // ConfigStructure is structure of main configuration
 type ConfigStructure struct {
-	RootDir                string   `json:"rootDir"`
-	DownloadConcurrency    int      `json:"downloadConcurrency"`
-	Architectures          []string `json:"architectures"`
-	DepFollowSuggests      bool     `json:"dependencyFollowSuggests"`
-	DepFollowRecommends    bool     `json:"dependencyFollowRecommends"`
-	DepFollowAllVariants   bool     `json:"dependencyFollowAllVariants"`
-	DepFollowSource        bool     `json:"dependencyFollowSource"`
-	GpgDisableSign         bool     `json:"gpgDisableSign"`
-	GpgDisableVerify       bool     `json:"gpgDisableVerify"`
-	DownloadSourcePackages bool     `json:"downloadSourcePackages"`
-	PpaDistributorID       string   `json:"ppaDistributorID"`
-	PpaCodename            string   `json:"ppaCodename"`
+	RootDir                string                       `json:"rootDir"`
+	DownloadConcurrency    int                          `json:"downloadConcurrency"`
+	DownloadSpeedLimit     int64                        `json:"downloadSpeedLimit"`
+	DownloadRetries        int                          `json:"downloadRetries"`
+	DownloadConnectTimeout int                          `json:"downloadConnectTimeout"`
+	DownloadReadTimeout    int                          `json:"downloadReadTimeout"`
+	DownloadProxy          string                       `json:"downloadProxy"`
+	DownloadCABundle       string                       `json:"downloadCABundle"`
+	DownloadClientCert     string                       `json:"downloadClientCert"`
+	DownloadClientKey      string                       `json:"downloadClientKey"`
+	DownloadNetrc          string                       `json:"downloadNetrc"`
+	Architectures          []string                     `json:"architectures"`
+	DepFollowSuggests      bool                         `json:"dependencyFollowSuggests"`
+	DepFollowRecommends    bool                         `json:"dependencyFollowRecommends"`
+	DepFollowAllVariants   bool                         `json:"dependencyFollowAllVariants"`
+	DepFollowSource        bool                         `json:"dependencyFollowSource"`
+	GpgDisableSign         bool                         `json:"gpgDisableSign"`
+	GpgDisableVerify       bool                         `json:"gpgDisableVerify"`
+	GpgProvider            string                       `json:"gpgProvider"`
+	DownloadSourcePackages bool                         `json:"downloadSourcePackages"`
+	PpaDistributorID       string                       `json:"ppaDistributorID"`
+	PpaCodename            string                       `json:"ppaCodename"`
+	PublishCompression     []string                     `json:"publishCompression"`
+	PublishByHashKeep      int                          `json:"publishByHashKeep"`
+	S3PublishEndpoints     map[string]S3PublishEndpoint `json:"s3PublishEndpoints"`
+}
+
+// S3PublishEndpoint describes single S3 publishing entry point
+type S3PublishEndpoint struct {
+	// Endpoint is host[:port] of S3 API, e.g. s3.amazonaws.com
+	Endpoint string `json:"endpoint"`
+	// Region of the bucket, if empty it's detected automatically
+	Region string `json:"region"`
+	Bucket string `json:"bucket"`
+	// Prefix in the bucket to publish under
+	Prefix          string `json:"prefix"`
+	AccessKeyID     string `json:"awsAccessKeyID"`
+	SecretAccessKey string `json:"awsSecretAccessKey"`
+	// DisableSSL switches to plain HTTP, e.g. for local S3 stand-ins
+	DisableSSL bool `json:"disableSSL"`
 }
 
 // Config is configuration for aptly, shared by all modules
 var Config = ConfigStructure{
 	RootDir:                filepath.Join(os.Getenv("HOME"), ".aptly"),
 	DownloadConcurrency:    4,
+	DownloadSpeedLimit:     0,
+	DownloadRetries:        3,
+	DownloadConnectTimeout: 30,
+	DownloadReadTimeout:    60,
+	DownloadProxy:          "",
+	DownloadCABundle:       "",
+	DownloadClientCert:     "",
+	DownloadClientKey:      "",
+	DownloadNetrc:          "",
 	Architectures:          []string{},
 	DepFollowSuggests:      false,
 	DepFollowRecommends:    false,
@@ -33,9 +70,13 @@ var Config = ConfigStructure{
 	DepFollowSource:        false,
 	GpgDisableSign:         false,
 	GpgDisableVerify:       false,
+	GpgProvider:            "gpg",
 	DownloadSourcePackages: false,
 	PpaDistributorID:       "ubuntu",
 	PpaCodename:            "",
+	PublishCompression:     []string{CompressionNone, CompressionGzip, CompressionBzip2},
+	PublishByHashKeep:      3,
+	S3PublishEndpoints:     map[string]S3PublishEndpoint{},
 }
 
 // LoadConfig loads configuration from json file
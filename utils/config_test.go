@@ -44,6 +44,15 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 		"{\n"+
 		"  \"rootDir\": \"/tmp/aptly\",\n"+
 		"  \"downloadConcurrency\": 5,\n"+
+		"  \"downloadSpeedLimit\": 0,\n"+
+		"  \"downloadRetries\": 0,\n"+
+		"  \"downloadConnectTimeout\": 0,\n"+
+		"  \"downloadReadTimeout\": 0,\n"+
+		"  \"downloadProxy\": \"\",\n"+
+		"  \"downloadCABundle\": \"\",\n"+
+		"  \"downloadClientCert\": \"\",\n"+
+		"  \"downloadClientKey\": \"\",\n"+
+		"  \"downloadNetrc\": \"\",\n"+
 		"  \"architectures\": null,\n"+
 		"  \"dependencyFollowSuggests\": false,\n"+
 		"  \"dependencyFollowRecommends\": false,\n"+
@@ -51,9 +60,13 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 		"  \"dependencyFollowSource\": false,\n"+
 		"  \"gpgDisableSign\": false,\n"+
 		"  \"gpgDisableVerify\": false,\n"+
+		"  \"gpgProvider\": \"\",\n"+
 		"  \"downloadSourcePackages\": false,\n"+
 		"  \"ppaDistributorID\": \"\",\n"+
-		"  \"ppaCodename\": \"\"\n"+
+		"  \"ppaCodename\": \"\",\n"+
+		"  \"publishCompression\": null,\n"+
+		"  \"publishByHashKeep\": 0,\n"+
+		"  \"s3PublishEndpoints\": null\n"+
 		"}")
 }
 
@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ParseEpoch parses number of seconds since Unix epoch (as in SOURCE_DATE_EPOCH) into UTC time
+func ParseEpoch(epoch string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse epoch %#v: %s", epoch, err)
+	}
+
+	return time.Unix(seconds, 0).UTC(), nil
+}
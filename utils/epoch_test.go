@@ -0,0 +1,19 @@
+package utils
+
+import (
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+type EpochSuite struct{}
+
+var _ = Suite(&EpochSuite{})
+
+func (s *EpochSuite) TestParseEpoch(c *C) {
+	t, err := ParseEpoch("1400000000")
+	c.Assert(err, IsNil)
+	c.Check(t, Equals, time.Date(2014, 5, 13, 16, 53, 20, 0, time.UTC))
+
+	_, err = ParseEpoch("yesterday")
+	c.Check(err, ErrorMatches, "unable to parse epoch \"yesterday\": .*")
+}
@@ -12,12 +12,15 @@ import (
 )
 
 // Signer interface describes facility implementing signing of files
+//
+// name is how source file is presented to the user, source might be temporary file
+// which is renamed to name later
 type Signer interface {
 	Init() error
-	SetKey(keyRef string)
+	SetKeys(keyRefs []string)
 	SetKeyRing(keyring, secretKeyring string)
-	DetachedSign(source string, destination string) error
-	ClearSign(source string, destination string) error
+	DetachedSign(source string, destination string, name string) error
+	ClearSign(source string, destination string, name string) error
 }
 
 // Verifier interface describes signature verification factility
@@ -37,13 +40,13 @@ var (
 
 // GpgSigner is implementation of Signer interface using gpg
 type GpgSigner struct {
-	keyRef                 string
+	keyRefs                []string
 	keyring, secretKeyring string
 }
 
-// SetKey sets key ID to use when signing files
-func (g *GpgSigner) SetKey(keyRef string) {
-	g.keyRef = keyRef
+// SetKeys sets key IDs to use when signing files, each key produces its own signature
+func (g *GpgSigner) SetKeys(keyRefs []string) {
+	g.keyRefs = keyRefs
 }
 
 // SetKeyRing allows to set custom keyring and secretkeyring
@@ -60,8 +63,8 @@ func (g *GpgSigner) gpgArgs() []string {
 		args = append(args, "--secret-keyring", g.secretKeyring)
 	}
 
-	if g.keyRef != "" {
-		args = append(args, "-u", g.keyRef)
+	for _, keyRef := range g.keyRefs {
+		args = append(args, "-u", keyRef)
 	}
 
 	return args
@@ -82,8 +85,8 @@ func (g *GpgSigner) Init() error {
 }
 
 // DetachedSign signs file with detached signature in ASCII format
-func (g *GpgSigner) DetachedSign(source string, destination string) error {
-	fmt.Printf("Signing file '%s' with gpg, please enter your passphrase when prompted:\n", source)
+func (g *GpgSigner) DetachedSign(source string, destination string, name string) error {
+	fmt.Printf("Signing file '%s' with gpg, please enter your passphrase when prompted:\n", name)
 
 	args := []string{"-o", destination, "--armor", "--yes"}
 	args = append(args, g.gpgArgs()...)
@@ -96,8 +99,8 @@ func (g *GpgSigner) DetachedSign(source string, destination string) error {
 }
 
 // ClearSign clear-signs the file
-func (g *GpgSigner) ClearSign(source string, destination string) error {
-	fmt.Printf("Clearsigning file '%s' with gpg, please enter your passphrase when prompted:\n", source)
+func (g *GpgSigner) ClearSign(source string, destination string, name string) error {
+	fmt.Printf("Clearsigning file '%s' with gpg, please enter your passphrase when prompted:\n", name)
 	args := []string{"-o", destination, "--yes"}
 	args = append(args, g.gpgArgs()...)
 	args = append(args, "--clearsign", source)
@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"bufio"
+	"code.google.com/p/go.crypto/openpgp"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Keyring is a set of trusted public keys stored in a file
+type Keyring struct {
+	filename string
+	entities openpgp.EntityList
+}
+
+// NewKeyring loads keyring from file, missing file means empty keyring
+func NewKeyring(filename string) (*Keyring, error) {
+	keyring := &Keyring{filename: filename}
+
+	entities, err := loadKeyRing(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return keyring, nil
+		}
+		return nil, err
+	}
+
+	keyring.entities = entities
+	return keyring, nil
+}
+
+// KeyFingerprint returns fingerprint of the key as uppercase hex string
+func KeyFingerprint(entity *openpgp.Entity) string {
+	return fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+}
+
+// KeyDescription returns description of the key: primary user ID
+func KeyDescription(entity *openpgp.Entity) string {
+	names := make([]string, 0, len(entity.Identities))
+	for name, identity := range entity.Identities {
+		if identity.SelfSignature != nil && identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId {
+			return name
+		}
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	if len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// Filename returns location of keyring file
+func (k *Keyring) Filename() string {
+	return k.filename
+}
+
+// Keys returns all keys in the keyring
+func (k *Keyring) Keys() openpgp.EntityList {
+	return k.entities
+}
+
+// Find looks up key by fingerprint, key ID or part of user ID
+func (k *Keyring) Find(keyRef string) (*openpgp.Entity, error) {
+	var result *openpgp.Entity
+
+	for _, entity := range k.entities {
+		if keyMatches(entity, keyRef) {
+			if result != nil {
+				return nil, fmt.Errorf("key reference %s is ambiguous, please specify fingerprint", keyRef)
+			}
+			result = entity
+		}
+	}
+
+	if result == nil {
+		return nil, fmt.Errorf("key %s not found in keyring", keyRef)
+	}
+
+	return result, nil
+}
+
+// Import adds keys from reader (armored or binary) to the keyring,
+// keys with the same fingerprint are replaced
+func (k *Keyring) Import(r io.Reader) (openpgp.EntityList, error) {
+	reader := bufio.NewReader(r)
+	header, _ := reader.Peek(len(armorHeader))
+
+	var (
+		imported openpgp.EntityList
+		err      error
+	)
+	if string(header) == armorHeader {
+		imported, err = openpgp.ReadArmoredKeyRing(reader)
+	} else {
+		imported, err = openpgp.ReadKeyRing(reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read keys: %s", err)
+	}
+
+	for _, entity := range imported {
+		// only public part is stored
+		entity.PrivateKey = nil
+		for i := range entity.Subkeys {
+			entity.Subkeys[i].PrivateKey = nil
+		}
+
+		k.remove(KeyFingerprint(entity))
+		k.entities = append(k.entities, entity)
+	}
+
+	return imported, nil
+}
+
+// remove drops key by fingerprint
+func (k *Keyring) remove(fingerprint string) {
+	for i, entity := range k.entities {
+		if KeyFingerprint(entity) == fingerprint {
+			k.entities = append(k.entities[:i], k.entities[i+1:]...)
+			return
+		}
+	}
+}
+
+// Remove drops key from the keyring
+func (k *Keyring) Remove(keyRef string) (*openpgp.Entity, error) {
+	entity, err := k.Find(keyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	k.remove(KeyFingerprint(entity))
+	return entity, nil
+}
+
+// Export writes keys with specified fingerprints in binary format, all keys
+// are exported if fingerprints are empty
+func (k *Keyring) Export(w io.Writer, fingerprints []string) error {
+	normalized := make([]string, len(fingerprints))
+	for i := range fingerprints {
+		normalized[i] = strings.ToUpper(fingerprints[i])
+	}
+	fingerprints = normalized
+
+	for _, fingerprint := range fingerprints {
+		found := false
+		for _, entity := range k.entities {
+			if KeyFingerprint(entity) == fingerprint {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("key %s not found in keyring", fingerprint)
+		}
+	}
+
+	for _, entity := range k.entities {
+		if len(fingerprints) > 0 && !StrSliceHasItem(fingerprints, KeyFingerprint(entity)) {
+			continue
+		}
+
+		err := entity.Serialize(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportTemp exports keys with specified fingerprints to temporary keyring file,
+// which could be used with Verifier
+func (k *Keyring) ExportTemp(fingerprints []string) (string, error) {
+	f, err := ioutil.TempFile("", "aptly-keyring")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	err = k.Export(f, fingerprints)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// Save writes keyring back to file
+func (k *Keyring) Save() error {
+	err := os.MkdirAll(filepath.Dir(k.filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(k.filename + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	err = k.Export(f, nil)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), k.filename)
+}
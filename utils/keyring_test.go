@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"bytes"
+	"code.google.com/p/go.crypto/openpgp"
+	"code.google.com/p/go.crypto/openpgp/armor"
+	. "launchpad.net/gocheck"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type KeyringSuite struct {
+	keyring      *Keyring
+	key1, key2   *openpgp.Entity
+	armoredKeys  []byte
+	binaryKeys   []byte
+	keyringFile  string
+	fingerprint1 string
+	fingerprint2 string
+}
+
+var _ = Suite(&KeyringSuite{})
+
+func (s *KeyringSuite) SetUpTest(c *C) {
+	var err error
+
+	s.key1, err = openpgp.NewEntity("Debian Archive", "", "archive@debian.org", nil)
+	c.Assert(err, IsNil)
+	s.key2, err = openpgp.NewEntity("Vendor Repo", "", "repo@vendor.com", nil)
+	c.Assert(err, IsNil)
+
+	s.fingerprint1, s.fingerprint2 = KeyFingerprint(s.key1), KeyFingerprint(s.key2)
+
+	buf := &bytes.Buffer{}
+	c.Assert(s.key1.SerializePrivate(buf, nil), IsNil)
+	s.binaryKeys = buf.Bytes()
+
+	buf = &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	c.Assert(err, IsNil)
+	c.Assert(s.key2.Serialize(w), IsNil)
+	w.Close()
+	s.armoredKeys = buf.Bytes()
+
+	s.keyringFile = filepath.Join(c.MkDir(), "keyring", "trustedkeys.gpg")
+	s.keyring, err = NewKeyring(s.keyringFile)
+	c.Assert(err, IsNil)
+}
+
+func (s *KeyringSuite) TestImport(c *C) {
+	c.Check(s.keyring.Keys(), HasLen, 0)
+
+	imported, err := s.keyring.Import(bytes.NewReader(s.binaryKeys))
+	c.Assert(err, IsNil)
+	c.Check(imported, HasLen, 1)
+	c.Check(imported[0].PrivateKey, IsNil)
+
+	imported, err = s.keyring.Import(bytes.NewReader(s.armoredKeys))
+	c.Assert(err, IsNil)
+	c.Check(imported, HasLen, 1)
+	c.Check(KeyDescription(imported[0]), Equals, "Vendor Repo <repo@vendor.com>")
+
+	// importing again replaces the key
+	_, err = s.keyring.Import(bytes.NewReader(s.armoredKeys))
+	c.Assert(err, IsNil)
+	c.Check(s.keyring.Keys(), HasLen, 2)
+
+	_, err = s.keyring.Import(strings.NewReader("garbage"))
+	c.Check(err, ErrorMatches, "unable to read keys: .*")
+}
+
+func (s *KeyringSuite) TestSaveLoad(c *C) {
+	s.keyring.Import(bytes.NewReader(s.binaryKeys))
+	s.keyring.Import(bytes.NewReader(s.armoredKeys))
+	c.Assert(s.keyring.Save(), IsNil)
+
+	keyring, err := NewKeyring(s.keyringFile)
+	c.Assert(err, IsNil)
+	c.Assert(keyring.Keys(), HasLen, 2)
+	c.Check(KeyFingerprint(keyring.Keys()[0]), Equals, s.fingerprint1)
+	c.Check(KeyFingerprint(keyring.Keys()[1]), Equals, s.fingerprint2)
+	c.Check(keyring.Keys()[0].PrivateKey, IsNil)
+}
+
+func (s *KeyringSuite) TestFindRemove(c *C) {
+	s.keyring.Import(bytes.NewReader(s.binaryKeys))
+	s.keyring.Import(bytes.NewReader(s.armoredKeys))
+
+	entity, err := s.keyring.Find(s.fingerprint1)
+	c.Assert(err, IsNil)
+	c.Check(KeyFingerprint(entity), Equals, s.fingerprint1)
+
+	entity, err = s.keyring.Find(s.key2.PrimaryKey.KeyIdShortString())
+	c.Assert(err, IsNil)
+	c.Check(KeyFingerprint(entity), Equals, s.fingerprint2)
+
+	entity, err = s.keyring.Find("vendor.com")
+	c.Assert(err, IsNil)
+	c.Check(KeyFingerprint(entity), Equals, s.fingerprint2)
+
+	_, err = s.keyring.Find("@")
+	c.Check(err, ErrorMatches, "key reference @ is ambiguous.*")
+
+	_, err = s.keyring.Find("DEADBEEF")
+	c.Check(err, ErrorMatches, "key DEADBEEF not found in keyring")
+
+	entity, err = s.keyring.Remove("archive@debian.org")
+	c.Assert(err, IsNil)
+	c.Check(KeyFingerprint(entity), Equals, s.fingerprint1)
+	c.Check(s.keyring.Keys(), HasLen, 1)
+
+	_, err = s.keyring.Remove("archive@debian.org")
+	c.Check(err, ErrorMatches, "key archive@debian.org not found in keyring")
+}
+
+func (s *KeyringSuite) TestExportTempVerify(c *C) {
+	s.keyring.Import(bytes.NewReader(s.binaryKeys))
+	s.keyring.Import(bytes.NewReader(s.armoredKeys))
+
+	_, err := s.keyring.ExportTemp([]string{"0000000000000000000000000000000000000000"})
+	c.Check(err, ErrorMatches, "key 0000000000000000000000000000000000000000 not found in keyring")
+
+	trusted, err := s.keyring.ExportTemp([]string{strings.ToLower(s.fingerprint2)})
+	c.Assert(err, IsNil)
+	defer os.Remove(trusted)
+
+	verifier := &GoVerifier{}
+	verifier.AddKeyring(trusted)
+	c.Assert(verifier.InitKeyring(), IsNil)
+
+	// signature by bound key is accepted, by other key from aptly keyring is not
+	signature := &bytes.Buffer{}
+	c.Assert(openpgp.ArmoredDetachSign(signature, s.key2, strings.NewReader(testRelease), nil), IsNil)
+	c.Check(verifier.VerifyDetachedSignature(signature, strings.NewReader(testRelease)), IsNil)
+
+	signature.Reset()
+	c.Assert(openpgp.ArmoredDetachSign(signature, s.key1, strings.NewReader(testRelease), nil), IsNil)
+	c.Check(verifier.VerifyDetachedSignature(signature, strings.NewReader(testRelease)), ErrorMatches, "verification .* failed: .*unknown entity")
+}
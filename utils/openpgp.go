@@ -0,0 +1,519 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/go.crypto/openpgp"
+	"code.google.com/p/go.crypto/openpgp/armor"
+	"code.google.com/p/go.crypto/openpgp/clearsign"
+	openpgperrors "code.google.com/p/go.crypto/openpgp/errors"
+	"code.google.com/p/go.crypto/openpgp/packet"
+	"crypto"
+	_ "crypto/sha256" // register SHA256 for signatures
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Test interface
+var (
+	_ Signer   = &GoSigner{}
+	_ Verifier = &GoVerifier{}
+)
+
+// PassphraseEnvVar is environment variable with passphrase for the signing key
+const PassphraseEnvVar = "APTLY_GPG_PASSPHRASE"
+
+// Config for signatures: apt doesn't accept SHA1 signatures anymore
+var signatureConfig = &packet.Config{DefaultHash: crypto.SHA256}
+
+// gnupgHome returns location of default gpg keyrings
+func gnupgHome() string {
+	if home := os.Getenv("GNUPGHOME"); home != "" {
+		return home
+	}
+	return filepath.Join(os.Getenv("HOME"), ".gnupg")
+}
+
+// loadKeyRing reads keyring from file, keyring could be armored or binary
+func loadKeyRing(filename string) (openpgp.EntityList, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	header, _ := reader.Peek(len(armorHeader))
+
+	var keyring openpgp.EntityList
+	if string(header) == armorHeader {
+		keyring, err = openpgp.ReadArmoredKeyRing(reader)
+	} else {
+		keyring, err = openpgp.ReadKeyRing(reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read keyring %s: %s", filename, err)
+	}
+	return keyring, nil
+}
+
+const armorHeader = "-----BEGIN"
+
+// keyMatches checks whether entity matches key reference: key ID,
+// fingerprint or part of user ID
+func keyMatches(entity *openpgp.Entity, keyRef string) bool {
+	fingerprint := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+	hexRef := strings.ToUpper(strings.Replace(strings.TrimPrefix(keyRef, "0x"), " ", "", -1))
+	if len(hexRef) >= 8 && strings.HasSuffix(fingerprint, hexRef) {
+		return true
+	}
+
+	for name := range entity.Identities {
+		if strings.Contains(name, keyRef) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GoSigner is implementation of Signer interface using Go OpenPGP library
+type GoSigner struct {
+	keyRefs                []string
+	keyring, secretKeyring string
+	passphrase             string
+	passphraseFile         string
+
+	signers []*openpgp.Entity
+}
+
+// SetKeys sets key IDs to use when signing files, each key produces its own signature
+func (g *GoSigner) SetKeys(keyRefs []string) {
+	g.keyRefs = keyRefs
+}
+
+// SetKeyRing allows to set custom keyring and secretkeyring
+func (g *GoSigner) SetKeyRing(keyring, secretKeyring string) {
+	g.keyring, g.secretKeyring = keyring, secretKeyring
+}
+
+// SetPassphrase sets passphrase to unlock the key, either literally or
+// as file to read passphrase from
+func (g *GoSigner) SetPassphrase(passphrase, passphraseFile string) {
+	g.passphrase, g.passphraseFile = passphrase, passphraseFile
+}
+
+// Init loads secret keyring, locates signing keys and unlocks them
+func (g *GoSigner) Init() error {
+	secretKeyring := g.secretKeyring
+	if secretKeyring == "" {
+		secretKeyring = filepath.Join(gnupgHome(), "secring.gpg")
+	}
+
+	keyring, err := loadKeyRing(secretKeyring)
+	if err != nil {
+		return err
+	}
+
+	g.signers = nil
+
+	if len(g.keyRefs) == 0 {
+		// use first available secret key
+		for _, entity := range keyring {
+			if entity.PrivateKey != nil {
+				g.signers = append(g.signers, entity)
+				break
+			}
+		}
+
+		if len(g.signers) == 0 {
+			return fmt.Errorf("no secret keys found in %s", secretKeyring)
+		}
+	}
+
+	for _, keyRef := range g.keyRefs {
+		var signer *openpgp.Entity
+		for _, entity := range keyring {
+			if entity.PrivateKey != nil && keyMatches(entity, keyRef) {
+				signer = entity
+				break
+			}
+		}
+
+		if signer == nil {
+			return fmt.Errorf("secret key %s not found in %s", keyRef, secretKeyring)
+		}
+		g.signers = append(g.signers, signer)
+	}
+
+	var passphrase []byte
+	for _, signer := range g.signers {
+		err = g.unlock(signer, &passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unlock decrypts private keys of the signer, passphrase is requested once
+func (g *GoSigner) unlock(signer *openpgp.Entity, passphrase *[]byte) error {
+	privateKeys := []*packet.PrivateKey{signer.PrivateKey}
+	for _, subkey := range signer.Subkeys {
+		if subkey.PrivateKey != nil {
+			privateKeys = append(privateKeys, subkey.PrivateKey)
+		}
+	}
+
+	for _, privateKey := range privateKeys {
+		if !privateKey.Encrypted {
+			continue
+		}
+
+		if *passphrase == nil {
+			var err error
+			*passphrase, err = g.getPassphrase(signer)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := privateKey.Decrypt(*passphrase)
+		if err != nil {
+			return fmt.Errorf("unable to unlock key %s: %s", privateKey.KeyIdShortString(), err)
+		}
+	}
+
+	return nil
+}
+
+// getPassphrase returns passphrase from file, options or environment
+func (g *GoSigner) getPassphrase(signer *openpgp.Entity) ([]byte, error) {
+	if g.passphraseFile != "" {
+		contents, err := ioutil.ReadFile(g.passphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read passphrase: %s", err)
+		}
+		return bytes.TrimRight(contents, "\r\n"), nil
+	}
+
+	if g.passphrase != "" {
+		return []byte(g.passphrase), nil
+	}
+
+	if passphrase := os.Getenv(PassphraseEnvVar); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	return nil, fmt.Errorf("key %s is protected with passphrase, please specify passphrase file or set %s",
+		signer.PrimaryKey.KeyIdShortString(), PassphraseEnvVar)
+}
+
+// keyExpired checks whether key bound with self-signature sig has expired at the moment now
+func keyExpired(sig *packet.Signature, now time.Time) bool {
+	if sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return false
+	}
+	return now.After(sig.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second))
+}
+
+// signingKey returns private key used to sign: signing subkey or primary key
+func signingKey(signer *openpgp.Entity) *packet.PrivateKey {
+	for _, subkey := range signer.Subkeys {
+		if subkey.PrivateKey != nil && subkey.Sig.FlagsValid && subkey.Sig.FlagSign && !keyExpired(subkey.Sig, time.Now()) {
+			return subkey.PrivateKey
+		}
+	}
+	return signer.PrivateKey
+}
+
+// keyIDs returns list of short key IDs of signers
+func (g *GoSigner) keyIDs() string {
+	keyIDs := make([]string, len(g.signers))
+	for i, signer := range g.signers {
+		keyIDs[i] = signer.PrimaryKey.KeyIdShortString()
+	}
+	return strings.Join(keyIDs, ", ")
+}
+
+// DetachedSign signs file with detached signature in ASCII format
+func (g *GoSigner) DetachedSign(source string, destination string, name string) error {
+	fmt.Printf("Signing file '%s' with keys %s\n", filepath.Base(name), g.keyIDs())
+
+	message, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer message.Close()
+
+	signature, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer signature.Close()
+
+	armored, err := armor.Encode(signature, openpgp.SignatureType, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, signer := range g.signers {
+		_, err = message.Seek(0, 0)
+		if err != nil {
+			return err
+		}
+
+		// DetachSign signs with entity's private key, so substitute signing subkey
+		key := *signer
+		key.PrivateKey = signingKey(signer)
+
+		err = openpgp.DetachSign(armored, &key, message, signatureConfig)
+		if err != nil {
+			return fmt.Errorf("error signing file %s: %s", source, err)
+		}
+	}
+
+	return armored.Close()
+}
+
+// ClearSign clear-signs the file
+//
+// Every key clear-signs message separately, then signatures are merged into single
+// signature block following the cleartext, so that any of the keys could verify it
+func (g *GoSigner) ClearSign(source string, destination string, name string) error {
+	fmt.Printf("Clearsigning file '%s' with keys %s\n", filepath.Base(name), g.keyIDs())
+
+	message, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	var (
+		cleartext  []byte
+		signatures bytes.Buffer
+	)
+
+	for _, signer := range g.signers {
+		var clearsigned bytes.Buffer
+
+		plaintext, err := clearsign.Encode(&clearsigned, signingKey(signer), signatureConfig)
+		if err != nil {
+			return fmt.Errorf("error clearsigning file %s: %s", source, err)
+		}
+
+		_, err = plaintext.Write(message)
+		if err != nil {
+			plaintext.Close()
+			return fmt.Errorf("error clearsigning file %s: %s", source, err)
+		}
+
+		err = plaintext.Close()
+		if err != nil {
+			return fmt.Errorf("error clearsigning file %s: %s", source, err)
+		}
+
+		block, _ := clearsign.Decode(clearsigned.Bytes())
+		if block == nil {
+			return fmt.Errorf("error clearsigning file %s: unable to decode signed message", source)
+		}
+
+		// cleartext is the same for every key, as it depends only on message & hash
+		if cleartext == nil {
+			end := bytes.Index(clearsigned.Bytes(), []byte("\n-----BEGIN PGP SIGNATURE-----"))
+			if end == -1 {
+				return fmt.Errorf("error clearsigning file %s: signature block not found", source)
+			}
+			cleartext = clearsigned.Bytes()[:end+1]
+		}
+
+		_, err = io.Copy(&signatures, block.ArmoredSignature.Body)
+		if err != nil {
+			return fmt.Errorf("error clearsigning file %s: %s", source, err)
+		}
+	}
+
+	output, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	_, err = output.Write(cleartext)
+	if err != nil {
+		return err
+	}
+
+	armored, err := armor.Encode(output, openpgp.SignatureType, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = armored.Write(signatures.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return armored.Close()
+}
+
+// GoVerifier is implementation of Verifier interface using Go OpenPGP library
+type GoVerifier struct {
+	keyRingFiles []string
+	keyring      openpgp.EntityList
+}
+
+// AddKeyring adds keyring file to the list of trusted keyrings
+func (g *GoVerifier) AddKeyring(keyring string) {
+	g.keyRingFiles = append(g.keyRingFiles, keyring)
+}
+
+// InitKeyring loads trusted keys from keyrings
+func (g *GoVerifier) InitKeyring() error {
+	g.keyring = nil
+
+	if len(g.keyRingFiles) == 0 {
+		// using default keyring
+		keyring, err := loadKeyRing(filepath.Join(gnupgHome(), "trustedkeys.gpg"))
+		if err == nil {
+			g.keyring = keyring
+		}
+
+		if len(g.keyring) == 0 {
+			fmt.Printf("\nLooks like your keyring with trusted keys is empty. You might consider importing some keys.\n")
+			fmt.Printf("If you're running Debian or Ubuntu, it's a good idea to import current archive keys by running:\n\n")
+			fmt.Printf("  gpg --keyring /usr/share/keyrings/debian-archive-keyring.gpg --export | gpg --no-default-keyring --keyring trustedkeys.gpg --import\n")
+			fmt.Printf("\n(for Ubuntu, use /usr/share/keyrings/ubuntu-archive-keyring.gpg)\n\n")
+		}
+
+		return nil
+	}
+
+	for _, keyRingFile := range g.keyRingFiles {
+		keyring, err := loadKeyRing(keyRingFile)
+		if err != nil {
+			return err
+		}
+		g.keyring = append(g.keyring, keyring...)
+	}
+
+	return nil
+}
+
+// checkSignature verifies signature against the trusted keys
+func (g *GoVerifier) checkSignature(signature io.Reader, cleartext io.Reader, context string) error {
+	signatureBytes, err := ioutil.ReadAll(signature)
+	if err != nil {
+		return err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(signatureBytes), []byte(armorHeader)) {
+		block, err := armor.Decode(bytes.NewReader(signatureBytes))
+		if err != nil {
+			return fmt.Errorf("verification of %s failed: %s", context, err)
+		}
+		signatureBytes, err = ioutil.ReadAll(block.Body)
+		if err != nil {
+			return fmt.Errorf("verification of %s failed: %s", context, err)
+		}
+	}
+
+	signer, err := openpgp.CheckDetachedSignature(g.keyring, cleartext, bytes.NewReader(signatureBytes))
+	if err != nil {
+		if err == openpgperrors.ErrUnknownIssuer && len(g.keyRingFiles) == 0 {
+			keyIDs := signatureKeyIDs(signatureBytes)
+
+			fmt.Printf("\nLooks like some keys are missing in your trusted keyring, you may consider importing them from keyserver:\n\n")
+			fmt.Printf("gpg --no-default-keyring --keyring trustedkeys.gpg --keyserver keys.gnupg.net --recv-keys %s\n\n",
+				strings.Join(keyIDs, " "))
+
+			fmt.Printf("Sometimes keys are stored in repository root in file named Release.key, to import such key:\n\n")
+			fmt.Printf("wget -O - http://some.repo/repository/Release.key | gpg --no-default-keyring --keyring trustedkeys.gpg --import\n\n")
+		}
+		return fmt.Errorf("verification of %s failed: %s", context, err)
+	}
+
+	for name := range signer.Identities {
+		fmt.Printf("Good signature from \"%s\"\n", name)
+	}
+
+	return nil
+}
+
+// signatureKeyIDs returns list of issuer key IDs for signature packets
+func signatureKeyIDs(signature []byte) (keyIDs []string) {
+	packets := packet.NewReader(bytes.NewReader(signature))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			return
+		}
+
+		switch sig := p.(type) {
+		case *packet.Signature:
+			if sig.IssuerKeyId != nil {
+				keyIDs = append(keyIDs, fmt.Sprintf("%08X", uint32(*sig.IssuerKeyId)))
+			}
+		case *packet.SignatureV3:
+			keyIDs = append(keyIDs, fmt.Sprintf("%08X", uint32(sig.IssuerKeyId)))
+		}
+	}
+}
+
+// VerifyDetachedSignature verifies combination of signature and cleartext
+func (g *GoVerifier) VerifyDetachedSignature(signature, cleartext io.Reader) error {
+	return g.checkSignature(signature, cleartext, "detached signature")
+}
+
+// VerifyClearsigned verifies clearsigned file
+func (g *GoVerifier) VerifyClearsigned(clearsigned io.Reader) error {
+	data, err := ioutil.ReadAll(clearsigned)
+	if err != nil {
+		return err
+	}
+
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		return fmt.Errorf("verification of clearsigned file failed: no clearsigned message found")
+	}
+
+	return g.checkSignature(block.ArmoredSignature.Body, bytes.NewReader(block.Bytes), "clearsigned file")
+}
+
+// ExtractClearsigned extracts cleartext from clearsigned file WITHOUT signature verification
+func (g *GoVerifier) ExtractClearsigned(clearsigned io.Reader) (text *os.File, err error) {
+	data, err := ioutil.ReadAll(clearsigned)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("extraction of clearsigned file failed: no clearsigned message found")
+	}
+
+	text, err = ioutil.TempFile("", "aptly-gpg")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(text.Name())
+
+	_, err = text.Write(block.Plaintext)
+	if err != nil {
+		text.Close()
+		return nil, err
+	}
+
+	_, err = text.Seek(0, 0)
+	if err != nil {
+		text.Close()
+		return nil, err
+	}
+
+	return text, nil
+}